@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"nosql_db/internal/query"
+	"nosql_db/pkg/api"
+	"os"
+	"sort"
+	"strings"
+)
+
+// runExport выгружает документы коллекции, подходящие под фильтр. Документы
+// читаются страницами по -batch в порядке _id, каждая страница пишется
+// в файл до запроса следующей
+func runExport(s *session, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	collection := fs.String("collection", "", "Source collection")
+	file := fs.String("file", "-", "Output file, - for stdout")
+	format := fs.String("format", "ndjson", "Output format: ndjson, json, csv")
+	filter := fs.String("query", "", "Optional JSON query filter")
+	fields := fs.String("fields", "", "CSV columns, comma separated (default: all fields)")
+	batchSize := fs.Int("batch", 1000, "Documents per find request")
+	_ = fs.Parse(args)
+
+	if *collection == "" {
+		return fmt.Errorf("-collection is required")
+	}
+	if *batchSize <= 0 {
+		return fmt.Errorf("-batch must be positive")
+	}
+
+	q, err := query.Parse(*filter)
+	if err != nil {
+		return err
+	}
+	pages := func() pageFunc { return exportPages(s, *collection, q.Conditions, *batchSize) }
+
+	var columns []string
+	if *format == "csv" {
+		if *fields != "" {
+			columns = strings.Split(*fields, ",")
+		} else if columns, err = collectColumns(pages()); err != nil {
+			return err
+		}
+	}
+
+	out, err := openOutput(*file)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+
+	progress := newProgress("exported")
+	switch *format {
+	case "ndjson":
+		err = writeNDJSON(w, pages(), progress)
+	case "json":
+		err = writeJSONArray(w, pages(), progress)
+	case "csv":
+		err = writeCSV(w, pages(), columns, progress)
+	default:
+		err = fmt.Errorf("unknown format: %s", *format)
+	}
+	if err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	progress.done()
+	return out.Close()
+}
+
+// pageFunc возвращает следующую страницу документов, пустую — когда они кончились
+type pageFunc func() ([]map[string]any, error)
+
+// exportPages читает коллекцию страницами по limit документов: следующая
+// страница запрашивается от _id последнего документа предыдущей
+func exportPages(s *session, collection string, filter map[string]any, limit int) pageFunc {
+	after, done := "", false
+	return func() ([]map[string]any, error) {
+		if done {
+			return nil, nil
+		}
+		page := map[string]any{"_id": map[string]any{"$gt": after}}
+		q := page
+		if len(filter) > 0 {
+			q = map[string]any{"$and": []any{page, filter}}
+		}
+		resp, err := s.roundTrip(&api.Request{
+			Database: collection,
+			Command:  api.CmdFind,
+			Query:    q,
+			Limit:    limit,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		done = len(resp.Data) < limit
+		if len(resp.Data) > 0 {
+			last, ok := resp.Data[len(resp.Data)-1]["_id"].(string)
+			if !ok || last <= after {
+				return nil, fmt.Errorf("server returned documents out of _id order")
+			}
+			after = last
+		}
+		return resp.Data, nil
+	}
+}
+
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func writeNDJSON(w io.Writer, next pageFunc, p *progress) error {
+	encoder := json.NewEncoder(w)
+	for {
+		docs, err := next()
+		if err != nil || len(docs) == 0 {
+			return err
+		}
+		for _, doc := range docs {
+			if err := encoder.Encode(doc); err != nil {
+				return err
+			}
+			p.add(1)
+		}
+	}
+}
+
+func writeJSONArray(w io.Writer, next pageFunc, p *progress) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	sep := "\n"
+	for {
+		docs, err := next()
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			break
+		}
+		for _, doc := range docs {
+			line, err := json.Marshal(doc)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "%s  %s", sep, line); err != nil {
+				return err
+			}
+			sep = ",\n"
+			p.add(1)
+		}
+	}
+	_, err := io.WriteString(w, "\n]\n")
+	return err
+}
+
+// collectColumns собирает все поля документов отдельным проходом по страницам,
+// _id идёт первым
+func collectColumns(next pageFunc) ([]string, error) {
+	seen := make(map[string]bool)
+	for {
+		docs, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if len(docs) == 0 {
+			break
+		}
+		for _, doc := range docs {
+			for field := range doc {
+				seen[field] = true
+			}
+		}
+	}
+	delete(seen, "_id")
+
+	columns := make([]string, 0, len(seen)+1)
+	for field := range seen {
+		columns = append(columns, field)
+	}
+	sort.Strings(columns)
+	return append([]string{"_id"}, columns...), nil
+}
+
+// writeCSV пишет строки как есть, остальные значения — в виде json
+func writeCSV(w io.Writer, next pageFunc, columns []string, p *progress) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+
+	record := make([]string, len(columns))
+	for {
+		docs, err := next()
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			break
+		}
+		for _, doc := range docs {
+			for i, column := range columns {
+				switch v := doc[column].(type) {
+				case nil:
+					record[i] = ""
+				case string:
+					record[i] = v
+				default:
+					raw, err := json.Marshal(v)
+					if err != nil {
+						return err
+					}
+					record[i] = string(raw)
+				}
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+			p.add(1)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"nosql_db/pkg/api"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runImport читает документы из файла и вставляет их пачками
+func runImport(s *session, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	collection := fs.String("collection", "", "Target collection")
+	file := fs.String("file", "-", "Input file, - for stdin")
+	format := fs.String("format", "auto", "Input format: auto, ndjson, json, csv")
+	batchSize := fs.Int("batch", 500, "Documents per insert request")
+	types := fs.String("types", "", "CSV column types, e.g. age:int,score:float,active:bool,tags:json,other:auto")
+	_ = fs.Parse(args)
+
+	if *collection == "" {
+		return fmt.Errorf("-collection is required")
+	}
+	if *batchSize <= 0 {
+		return fmt.Errorf("-batch must be positive")
+	}
+
+	in, err := openInput(*file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	reader := bufio.NewReader(in)
+	if *format == "auto" {
+		*format = detectFormat(*file, reader)
+	}
+
+	var next func() (map[string]any, error)
+	switch *format {
+	case "ndjson", "json":
+		next, err = jsonSource(reader)
+	case "csv":
+		var columnTypes map[string]string
+		if columnTypes, err = parseColumnTypes(*types); err == nil {
+			next, err = csvSource(reader, columnTypes)
+		}
+	default:
+		err = fmt.Errorf("unknown format: %s", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	progress := newProgress("imported")
+	batch := make([]map[string]any, 0, *batchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		resp, err := s.roundTrip(&api.Request{
+			Database: *collection,
+			Command:  api.CmdInsert,
+			Data:     batch,
+		})
+		if err != nil {
+			return err
+		}
+		progress.add(resp.Count)
+		batch = make([]map[string]any, 0, *batchSize)
+		return nil
+	}
+
+	for {
+		doc, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		batch = append(batch, doc)
+		if len(batch) == *batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	progress.done()
+	return nil
+}
+
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// detectFormat определяет формат по расширению, а для json — по первому символу
+func detectFormat(path string, r *bufio.Reader) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return "csv"
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	}
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return "ndjson"
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = r.ReadByte()
+			continue
+		case '[':
+			return "json"
+		default:
+			return "ndjson"
+		}
+	}
+}
+
+// jsonSource читает массив документов или поток документов (NDJSON)
+func jsonSource(r io.Reader) (func() (map[string]any, error), error) {
+	decoder := json.NewDecoder(r)
+
+	inArray := false
+	if br, ok := r.(*bufio.Reader); ok {
+		if b, err := br.Peek(1); err == nil && b[0] == '[' {
+			if _, err := decoder.Token(); err != nil {
+				return nil, err
+			}
+			inArray = true
+		}
+	}
+
+	n := 0
+	return func() (map[string]any, error) {
+		if inArray && !decoder.More() {
+			return nil, io.EOF
+		}
+		var doc map[string]any
+		if err := decoder.Decode(&doc); err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("document %d: %w", n+1, err)
+		}
+		n++
+		return doc, nil
+	}, nil
+}
+
+// parseColumnTypes разбирает спецификацию вида "age:int,active:bool"
+func parseColumnTypes(spec string) (map[string]string, error) {
+	types := make(map[string]string)
+	if spec == "" {
+		return types, nil
+	}
+	for _, part := range strings.Split(spec, ",") {
+		field, typ, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || field == "" {
+			return nil, fmt.Errorf("invalid type spec: %q", part)
+		}
+		switch typ {
+		case "string", "int", "float", "bool", "json", "auto":
+			types[field] = typ
+		default:
+			return nil, fmt.Errorf("unknown type %q for field %s", typ, field)
+		}
+	}
+	return types, nil
+}
+
+// csvSource читает csv с заголовком, приводя колонки к заданным типам
+func csvSource(r io.Reader, types map[string]string) (func() (map[string]any, error), error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+	header = append([]string(nil), header...)
+	for field := range types {
+		if !slices.Contains(header, field) {
+			return nil, fmt.Errorf("type given for unknown column %s", field)
+		}
+	}
+
+	return func() (map[string]any, error) {
+		record, err := reader.Read()
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("read csv: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		doc := make(map[string]any, len(header))
+		for i, column := range header {
+			if i >= len(record) {
+				break
+			}
+			value, keep, err := coerce(record[i], types[column])
+			if err != nil {
+				return nil, fmt.Errorf("line %d, column %s: %w", line, column, err)
+			}
+			if keep {
+				doc[column] = value
+			}
+		}
+		return doc, nil
+	}, nil
+}
+
+// coerce приводит строку из csv к типу; пустые типизированные значения пропускаются
+func coerce(raw, typ string) (any, bool, error) {
+	if typ == "" || typ == "string" {
+		return raw, true, nil
+	}
+	if raw == "" {
+		return nil, false, nil
+	}
+
+	switch typ {
+	case "int":
+		v, err := strconv.ParseInt(raw, 10, 64)
+		return v, err == nil, err
+	case "float":
+		v, err := strconv.ParseFloat(raw, 64)
+		return v, err == nil, err
+	case "bool":
+		v, err := strconv.ParseBool(raw)
+		return v, err == nil, err
+	case "json":
+		var v any
+		err := json.Unmarshal([]byte(raw), &v)
+		return v, err == nil, err
+	default: // auto
+		if v, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			return v, true, nil
+		}
+		if v, err := strconv.ParseFloat(raw, 64); err == nil {
+			return v, true, nil
+		}
+		if v, err := strconv.ParseBool(raw); err == nil {
+			return v, true, nil
+		}
+		return raw, true, nil
+	}
+}
+
+// progress печатает ход импорта/экспорта в stderr не чаще раза в секунду
+type progress struct {
+	verb    string
+	count   int
+	started time.Time
+	printed time.Time
+}
+
+func newProgress(verb string) *progress {
+	now := time.Now()
+	return &progress{verb: verb, started: now, printed: now}
+}
+
+func (p *progress) add(n int) {
+	p.count += n
+	if time.Since(p.printed) >= time.Second {
+		p.print()
+	}
+}
+
+func (p *progress) done() {
+	p.print()
+}
+
+func (p *progress) print() {
+	p.printed = time.Now()
+	elapsed := p.printed.Sub(p.started).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(p.count) / elapsed
+	}
+	log.Printf("%s %d document(s) (%.0f docs/s)", p.verb, p.count, rate)
+}
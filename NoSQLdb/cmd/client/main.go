@@ -8,9 +8,10 @@ import (
 	"io"
 	"log"
 	"net"
-	"nosql_db/internal/api"
 	"nosql_db/internal/query"
+	"nosql_db/pkg/api"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -20,9 +21,10 @@ var (
 )
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
 
-	addr := fmt.Sprintf("%s:%s", *host, *port)
+	addr := net.JoinHostPort(*host, *port)
 
 	conn, err := net.Dial("tcp", addr)
 	if err != nil {
@@ -32,7 +34,25 @@ func main() {
 
 	log.Printf("Connected to server %s", addr)
 
-	runREPL(conn)
+	switch flag.Arg(0) {
+	case "":
+		runREPL(conn)
+	case "import":
+		err = runImport(newSession(conn), flag.Args()[1:])
+	case "export":
+		err = runExport(newSession(conn), flag.Args()[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("%s failed: %v", flag.Arg(0), err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [import|export [subcommand flags]]\n", os.Args[0])
+	flag.PrintDefaults()
 }
 
 func runREPL(conn net.Conn) {
@@ -40,7 +60,7 @@ func runREPL(conn net.Conn) {
 	decoder := json.NewDecoder(conn)
 	encoder := json.NewEncoder(conn)
 
-	fmt.Println("\nAvailable commands: INSERT, FIND, DELETE, CREATE_INDEX")
+	fmt.Println("\nAvailable commands: INSERT, FIND, DELETE, DELETE_ONE, SAMPLE, CREATE_INDEX, INDEX_BUILDS, CANCEL_INDEX_BUILD, STATS, CONFIGURE, SET_VALIDATOR, VALIDATE")
 	fmt.Print("> ")
 
 	for {
@@ -100,12 +120,59 @@ func parseLineToRequest(line string) (*api.Request, error) {
 
 	if cmd == "CREATE_INDEX" {
 		if len(fields) < 3 {
-			return nil, fmt.Errorf("usage: CREATE_INDEX <collection> <field_name>")
+			return nil, fmt.Errorf("usage: CREATE_INDEX <collection> <field_name> [ip]")
 		}
 		fieldName := fields[2]
 		req.Query = map[string]any{
 			fieldName: nil,
 		}
+		if len(fields) > 3 {
+			req.Query[fieldName] = fields[3]
+		}
+		return req, nil
+	}
+
+	if cmd == "CANCEL_INDEX_BUILD" {
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("usage: CANCEL_INDEX_BUILD <collection> <field_name>")
+		}
+		req.Query = map[string]any{"field": fields[2]}
+		return req, nil
+	}
+
+	// SAMPLE <collection> <size> [query]
+	if cmd == "SAMPLE" {
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("usage: SAMPLE <collection> <size> [query]")
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("sample size must be a positive number")
+		}
+		req.Limit = size
+		if len(fields) > 3 {
+			q, err := query.Parse(strings.Join(fields[3:], " "))
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSON query: %v", err)
+			}
+			req.Query = q.Conditions
+		}
+		return req, nil
+	}
+
+	// VALIDATE <collection> [repair]
+	if cmd == "VALIDATE" {
+		if len(fields) > 2 {
+			if !strings.EqualFold(fields[2], "repair") {
+				return nil, fmt.Errorf("usage: VALIDATE <collection> [repair]")
+			}
+			req.Query = map[string]any{"repair": true}
+		}
+		return req, nil
+	}
+
+	// SET_VALIDATOR без схемы снимает проверку
+	if cmd == "STATS" || cmd == "INDEX_BUILDS" || (cmd == "SET_VALIDATOR" && len(fields) == 2) {
 		return req, nil
 	}
 
@@ -135,10 +202,12 @@ func parseLineToRequest(line string) (*api.Request, error) {
 func printResponse(resp api.Response) {
 	if resp.Status == api.StatusError {
 		fmt.Printf("ERROR: %s\n", resp.Message)
+		printViolations(resp.Violations)
 		return
 	}
 
 	fmt.Printf("SUCCESS: %s (Count: %d)\n", resp.Message, resp.Count)
+	printViolations(resp.Violations)
 
 	if len(resp.Data) > 0 {
 		output, err := json.MarshalIndent(resp.Data, "", "  ")
@@ -148,3 +217,38 @@ func printResponse(resp api.Response) {
 		fmt.Println(string(output))
 	}
 }
+
+// printViolations печатает нарушения схемы по документам
+func printViolations(violations []api.Violation) {
+	for _, v := range violations {
+		fmt.Printf("  document %d: %s\n", v.Index, strings.Join(v.Errors, "; "))
+	}
+}
+
+// session — соединение с сервером для пакетных подкоманд
+type session struct {
+	encoder *json.Encoder
+	decoder *json.Decoder
+}
+
+func newSession(conn net.Conn) *session {
+	return &session{
+		encoder: json.NewEncoder(conn),
+		decoder: json.NewDecoder(conn),
+	}
+}
+
+// roundTrip отправляет один запрос и читает ответ
+func (s *session) roundTrip(req *api.Request) (api.Response, error) {
+	var resp api.Response
+	if err := s.encoder.Encode(req); err != nil {
+		return resp, fmt.Errorf("encode request: %w", err)
+	}
+	if err := s.decoder.Decode(&resp); err != nil {
+		return resp, fmt.Errorf("decode response: %w", err)
+	}
+	if resp.Status == api.StatusError {
+		return resp, fmt.Errorf("server error: %s", resp.Message)
+	}
+	return resp, nil
+}
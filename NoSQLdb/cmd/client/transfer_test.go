@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"nosql_db/pkg/api"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeCollection — сервер на одном соединении: insert складывает документы,
+// find отдаёт страницу после _id из запроса и запоминает запросы
+type fakeCollection struct {
+	docs    []map[string]any
+	batches []int
+	queries []map[string]any
+}
+
+func newTestSession(t *testing.T) (*session, *fakeCollection) {
+	t.Helper()
+	// tcp, а не net.Pipe: у Pipe нет буфера, и хвост ответа блокирует
+	// сервер, пока клиент пишет следующий запрос
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	coll := &fakeCollection{}
+	go func() {
+		defer server.Close()
+		decoder := json.NewDecoder(server)
+		encoder := json.NewEncoder(server)
+		for {
+			var req api.Request
+			if err := decoder.Decode(&req); err != nil {
+				return
+			}
+			resp := api.Response{Status: api.StatusSuccess}
+			switch req.Command {
+			case api.CmdInsert:
+				coll.batches = append(coll.batches, len(req.Data))
+				coll.docs = append(coll.docs, req.Data...)
+				resp.Count = len(req.Data)
+			case api.CmdFind:
+				coll.queries = append(coll.queries, req.Query)
+				resp.Data = coll.page(req.Query, req.Limit)
+				resp.Count = len(resp.Data)
+			}
+			if err := encoder.Encode(resp); err != nil {
+				return
+			}
+		}
+	}()
+	return newSession(client), coll
+}
+
+// page — документы с _id больше $gt из запроса экспорта, не больше limit
+func (c *fakeCollection) page(query map[string]any, limit int) []map[string]any {
+	if and, ok := query["$and"].([]any); ok {
+		query = and[0].(map[string]any)
+	}
+	after := query["_id"].(map[string]any)["$gt"].(string)
+	var out []map[string]any
+	for _, doc := range c.docs {
+		if doc["_id"].(string) > after && len(out) < limit {
+			out = append(out, doc)
+		}
+	}
+	return out
+}
+
+// pagesOf отдаёт документы страницами по size
+func pagesOf(size int, docs ...map[string]any) pageFunc {
+	return func() ([]map[string]any, error) {
+		n := min(size, len(docs))
+		page := docs[:n]
+		docs = docs[n:]
+		return page, nil
+	}
+}
+
+func writeTemp(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestImportBatchesNDJSON(t *testing.T) {
+	s, coll := newTestSession(t)
+	path := writeTemp(t, "events.ndjson", `{"n": 1}
+{"n": 2}
+{"n": 3}
+{"n": 4}
+{"n": 5}
+`)
+	if err := runImport(s, []string{"-collection", "events", "-file", path, "-batch", "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(coll.batches, []int{2, 2, 1}) || len(coll.docs) != 5 {
+		t.Fatalf("batches %v, %d documents", coll.batches, len(coll.docs))
+	}
+}
+
+func TestImportCSVWithTypes(t *testing.T) {
+	s, coll := newTestSession(t)
+	path := writeTemp(t, "events.csv", "host,port,active,score,tags\nweb-1,22,true,1.5,\"[\"\"ssh\"\"]\"\nweb-2,,false,2,[]\n")
+	err := runImport(s, []string{"-collection", "events", "-file", path, "-types", "port:int,active:bool,score:float,tags:json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// числа проходят через json, как на сервере
+	want := []map[string]any{
+		{"host": "web-1", "port": 22.0, "active": true, "score": 1.5, "tags": []any{"ssh"}},
+		{"host": "web-2", "active": false, "score": 2.0, "tags": []any{}},
+	}
+	if !reflect.DeepEqual(coll.docs, want) {
+		t.Fatalf("imported %v", coll.docs)
+	}
+}
+
+func TestImportCSVReportsBadValue(t *testing.T) {
+	s, _ := newTestSession(t)
+	path := writeTemp(t, "events.csv", "host,port\nweb-1,22\nweb-2,ssh\n")
+	err := runImport(s, []string{"-collection", "events", "-file", path, "-types", "port:int"})
+	if err == nil || !strings.Contains(err.Error(), "line 3, column port") {
+		t.Fatalf("got %v, want the bad line and column", err)
+	}
+}
+
+func TestJSONSourceReadsArrayAndStream(t *testing.T) {
+	for name, input := range map[string]string{
+		"array":  ` [{"n": 1}, {"n": 2}]`,
+		"ndjson": "{\"n\": 1}\n{\"n\": 2}\n",
+	} {
+		r := bufio.NewReader(strings.NewReader(input))
+		if format := detectFormat("-", r); (format == "json") != (name == "array") {
+			t.Fatalf("%s detected as %s", name, format)
+		}
+		next, err := jsonSource(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []map[string]any
+		for {
+			doc, err := next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			got = append(got, doc)
+		}
+		if len(got) != 2 || got[1]["n"] != 2.0 {
+			t.Fatalf("%s: read %v", name, got)
+		}
+	}
+}
+
+func TestCoerce(t *testing.T) {
+	cases := []struct {
+		raw, typ string
+		want     any
+		keep     bool
+	}{
+		{"42", "int", int64(42), true},
+		{"", "int", nil, false},
+		{"", "string", "", true},
+		{"1.5", "float", 1.5, true},
+		{"true", "bool", true, true},
+		{"7", "auto", int64(7), true},
+		{"7.5", "auto", 7.5, true},
+		{"web-1", "auto", "web-1", true},
+	}
+	for _, c := range cases {
+		got, keep, err := coerce(c.raw, c.typ)
+		if err != nil || keep != c.keep || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("coerce(%q, %s) = %v, %v, %v", c.raw, c.typ, got, keep, err)
+		}
+	}
+	if _, _, err := coerce("yes", "bool"); err == nil {
+		t.Error("bad bool accepted")
+	}
+}
+
+func TestExportSendsFilter(t *testing.T) {
+	s, coll := newTestSession(t)
+	coll.docs = []map[string]any{
+		{"_id": "1", "host": "web-1", "port": 22.0},
+		{"_id": "2", "host": "web-2", "tags": []any{"ssh"}},
+	}
+
+	path := filepath.Join(t.TempDir(), "out.csv")
+	err := runExport(s, []string{"-collection", "events", "-file", path, "-format", "csv", "-query", `{"port": {"$gt": 0}}`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"$and": []any{
+		map[string]any{"_id": map[string]any{"$gt": ""}},
+		map[string]any{"port": map[string]any{"$gt": 0.0}},
+	}}
+	if !reflect.DeepEqual(coll.queries[0], want) {
+		t.Fatalf("export filter sent as %v", coll.queries[0])
+	}
+	out, _ := os.ReadFile(path)
+	wantCSV := "_id,host,port,tags\n1,web-1,22,\n2,web-2,,\"[\"\"ssh\"\"]\"\n"
+	if string(out) != wantCSV {
+		t.Fatalf("csv export:\n%s\nwant:\n%s", out, wantCSV)
+	}
+}
+
+func TestExportPagesByID(t *testing.T) {
+	s, coll := newTestSession(t)
+	for _, id := range []string{"1", "2", "3", "4"} {
+		coll.docs = append(coll.docs, map[string]any{"_id": id})
+	}
+
+	path := filepath.Join(t.TempDir(), "out.ndjson")
+	if err := runExport(s, []string{"-collection", "events", "-file", path, "-batch", "2"}); err != nil {
+		t.Fatal(err)
+	}
+	// две полные страницы и пустая
+	var after []any
+	for _, q := range coll.queries {
+		after = append(after, q["_id"].(map[string]any)["$gt"])
+	}
+	if !reflect.DeepEqual(after, []any{"", "2", "4"}) {
+		t.Fatalf("pages requested after %v", after)
+	}
+	out, _ := os.ReadFile(path)
+	if want := "{\"_id\":\"1\"}\n{\"_id\":\"2\"}\n{\"_id\":\"3\"}\n{\"_id\":\"4\"}\n"; string(out) != want {
+		t.Fatalf("ndjson export %q", out)
+	}
+}
+
+func TestExportJSONFormats(t *testing.T) {
+	docs := []map[string]any{{"n": 1.0}, {"n": 2.0}}
+
+	var nd bytes.Buffer
+	if err := writeNDJSON(&nd, pagesOf(1, docs...), newProgress("exported")); err != nil {
+		t.Fatal(err)
+	}
+	if nd.String() != "{\"n\":1}\n{\"n\":2}\n" {
+		t.Fatalf("ndjson %q", nd.String())
+	}
+
+	var arr bytes.Buffer
+	if err := writeJSONArray(&arr, pagesOf(1, docs...), newProgress("exported")); err != nil {
+		t.Fatal(err)
+	}
+	var back []map[string]any
+	if err := json.Unmarshal(arr.Bytes(), &back); err != nil || !reflect.DeepEqual(back, docs) {
+		t.Fatalf("json array %q: %v", arr.String(), err)
+	}
+}
@@ -1,18 +1,153 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"math"
 	"nosql_db/internal/config"
+	"nosql_db/internal/handlers"
+	"nosql_db/internal/profiler"
 	"nosql_db/internal/server"
+	"nosql_db/internal/storage"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var (
+	restorePath = flag.String("restore", "", "Restore data directory from a backup archive before start")
+	restoreOnly = flag.Bool("restore-only", false, "Exit after restoring the archive")
 )
 
 func main() {
+	flag.Parse()
+
 	log.Println("Starting NoSQLdb server...")
 	cfg := config.Load()
 
+	compression, err := storage.ParseCompression(cfg.Compression)
+	if err != nil {
+		log.Fatal(err)
+	}
+	storage.DefaultCompression = compression
+	storage.DataDir = cfg.DataDir
+	if cfg.NodeID >= 0 {
+		if cfg.NodeID > math.MaxUint16 {
+			log.Fatalf("DB_NODE_ID must be between 0 and %d", math.MaxUint16)
+		}
+		storage.NodeID = uint16(cfg.NodeID)
+	}
+	storage.BackupDir = cfg.BackupDir
+	storage.WriteQueueSize = max(cfg.WriteQueueSize, 1)
+	storage.QueueTimeout = time.Duration(cfg.WriteQueueTimeoutMS) * time.Millisecond
+	storage.MaxGroupSize = max(cfg.GroupCommitMax, 1)
+	storage.QueueIdleTimeout = time.Duration(cfg.WriteQueueIdleMS) * time.Millisecond
+	storage.DedupWindow = time.Duration(cfg.DedupWindowMS) * time.Millisecond
+	handlers.DefaultMaxTime = time.Duration(cfg.MaxTimeMS) * time.Millisecond
+	handlers.MaxResultBytes = cfg.MaxResultBytes
+
+	if *restorePath != "" {
+		manifest, err := storage.RestoreArchive(*restorePath, cfg.DataDir)
+		if err != nil {
+			log.Fatalf("restore failed: %v", err)
+		}
+		log.Printf("restored %d collection(s) from %s into %s", len(manifest.Collections), *restorePath, cfg.DataDir)
+		if *restoreOnly {
+			return
+		}
+	}
+
+	// с неверным ключом сервер не стартует, а не загружает мусор
+	storage.EncryptionKeys = storage.KeySource{File: cfg.EncryptionKeyFile, Keys: cfg.EncryptionKey}
+	keys, err := storage.LoadKeyRing(storage.EncryptionKeys)
+	if err != nil {
+		log.Fatalf("encryption keys: %v", err)
+	}
+	storage.SetKeyRing(keys)
+	stale, err := storage.CheckEncryption()
+	if err != nil {
+		log.Fatalf("refusing to start: %v", err)
+	}
+	if id, ok := keys.ActiveID(); ok {
+		log.Printf("encryption at rest enabled, active key %s", id)
+	}
+
+	// маркер остался — прошлый процесс не остановился штатно, индексы могли
+	// разойтись с документами
+	unclean, err := storage.MarkRunning()
+	if err != nil {
+		log.Fatalf("failed to create running marker: %v", err)
+	}
+	if unclean {
+		log.Println("unclean shutdown detected, validating indexes...")
+		reports, err := storage.GlobalManager.RepairAll()
+		if err != nil {
+			log.Fatalf("index repair failed: %v", err)
+		}
+		repaired := 0
+		for _, r := range reports {
+			if r.Repaired {
+				repaired++
+				log.Printf("repaired index %s.%s: missing %d, dangling %d, duplicates %d, structure %v",
+					r.Collection, r.Field, r.MissingCount, r.DanglingCount, r.DuplicateCount, r.Structure)
+			}
+		}
+		log.Printf("%d index(es) checked, %d repaired", len(reports), repaired)
+	}
+
+	// файлы под прежним ключом или без шифрования перезаписываются в фоне
+	if stale > 0 {
+		rekey, err := storage.GlobalManager.StartRekey()
+		if err != nil {
+			log.Fatalf("failed to start re-encryption: %v", err)
+		}
+		log.Printf("re-encrypting %d file(s) in the background", stale)
+		go func() {
+			<-rekey.Done()
+			p := rekey.Progress()
+			if p.Error != "" {
+				log.Printf("re-encryption failed: %s", p.Error)
+				return
+			}
+			log.Printf("re-encryption finished: %d collection(s) in %s", p.Rewritten, p.Elapsed)
+		}()
+	}
+
+	if cfg.ProfileThresholdMS >= 0 {
+		err := profiler.Start(profiler.Options{
+			Threshold:  time.Duration(cfg.ProfileThresholdMS) * time.Millisecond,
+			LogPath:    cfg.ProfileLog,
+			LogMaxSize: int64(cfg.ProfileLogMaxMB) << 20,
+			LogBackups: cfg.ProfileLogBackups,
+			MaxDocs:    cfg.ProfileMaxDocs,
+		})
+		if err != nil {
+			log.Fatalf("failed to start profiler: %v", err)
+		}
+	}
+
 	srv := server.New(cfg.Host + ":" + cfg.Port)
+	srv.MetricsAddress = cfg.MetricsAddr
+	srv.HTTPAddress = cfg.HTTPAddr
+	srv.MaxInFlight = cfg.MaxInFlight
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Run() }()
 
-	if err := srv.Run(); err != nil {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-errCh:
 		log.Fatal(err)
+	case sig := <-signals:
+		log.Printf("received %s, finishing queued writes...", sig)
+	}
+
+	// маркер снимается, только когда все принятые записи сохранены
+	storage.GlobalManager.Shutdown()
+	if err := storage.MarkStopped(); err != nil {
+		log.Printf("failed to remove running marker: %v", err)
 	}
+	log.Println("server stopped")
 }
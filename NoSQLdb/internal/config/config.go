@@ -9,6 +9,36 @@ import (
 type Config struct {
 	Host string `env:"DB_HOST" env-default:""`
 	Port string `env:"DB_PORT" env-default:"5140"`
+
+	MaxInFlight int `env:"DB_CONN_MAX_INFLIGHT" env-default:"8"` // параллельных запросов на соединение в concurrent-режиме
+	NodeID      int `env:"DB_NODE_ID" env-default:"-1"`          // номер узла в _id (0-65535), -1 — из имени хоста
+
+	DataDir     string `env:"DB_DATA_DIR" env-default:"data"`
+	BackupDir   string `env:"DB_BACKUP_DIR" env-default:"backups"`
+	Compression string `env:"DB_COMPRESSION" env-default:"none"` // формат новых коллекций: none или gzip
+	MetricsAddr string `env:"DB_METRICS_ADDR" env-default:""`    // например :9140, пустой — метрики выключены
+	HTTPAddr    string `env:"DB_HTTP_ADDR" env-default:""`       // REST-шлюз, например :8140, пустой — выключен
+
+	// Шифрование на диске: файл с ключом в строке или ключи через запятую,
+	// первый — активный. Пустые — без шифрования
+	EncryptionKeyFile string `env:"DB_ENCRYPTION_KEY_FILE" env-default:""`
+	EncryptionKey     string `env:"DB_ENCRYPTION_KEY" env-default:""`
+
+	WriteQueueSize      int `env:"DB_WRITE_QUEUE_SIZE" env-default:"100"`        // ёмкость очереди записи одной коллекции
+	WriteQueueTimeoutMS int `env:"DB_WRITE_QUEUE_TIMEOUT_MS" env-default:"5000"` // ожидание места в очереди, 0 — без таймаута
+	WriteQueueIdleMS    int `env:"DB_WRITE_QUEUE_IDLE_MS" env-default:"60000"`   // простой, после которого воркер коллекции останавливается, 0 — никогда
+	GroupCommitMax      int `env:"DB_GROUP_COMMIT_MAX" env-default:"64"`         // сколько вставок сохраняются одним шагом
+	DedupWindowMS       int `env:"DB_DEDUP_WINDOW_MS" env-default:"600000"`      // сколько помнить ключи идемпотентности, 0 — выключено; дольше, чем клиенты повторяют пакеты
+
+	MaxTimeMS      int64 `env:"DB_MAX_TIME_MS" env-default:"0"`      // лимит времени запроса по умолчанию, 0 — без лимита
+	MaxResultBytes int64 `env:"DB_MAX_RESULT_BYTES" env-default:"0"` // лимит размера ответа find, 0 — без лимита
+
+	// Профилировщик медленных запросов, отрицательный порог — выключен
+	ProfileThresholdMS int    `env:"DB_PROFILE_THRESHOLD_MS" env-default:"-1"`
+	ProfileLog         string `env:"DB_PROFILE_LOG" env-default:"logs/profile.log"`
+	ProfileLogMaxMB    int    `env:"DB_PROFILE_LOG_MAX_MB" env-default:"10"`
+	ProfileLogBackups  int    `env:"DB_PROFILE_LOG_BACKUPS" env-default:"5"`
+	ProfileMaxDocs     int    `env:"DB_PROFILE_MAX_DOCS" env-default:"1000"`
 }
 
 func Load() *Config {
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+func handleBackup(req api.Request) api.Response {
+	var names []string
+	if raw, ok := req.Query["collections"]; ok {
+		list, ok := raw.([]any)
+		if !ok {
+			return api.Response{Status: api.StatusError, Message: "collections must be an array of names"}
+		}
+		existing, err := storage.GlobalManager.ListCollections()
+		if err != nil {
+			return api.Response{Status: api.StatusError, Message: err.Error()}
+		}
+		for _, item := range list {
+			name, ok := item.(string)
+			if !ok || !slices.Contains(existing, name) {
+				return api.Response{Status: api.StatusError, Message: fmt.Sprintf("unknown collection: %v", item)}
+			}
+			names = append(names, name)
+		}
+	}
+
+	// Архивы пишутся только в BackupDir, из имени берётся последний компонент
+	fileName := fmt.Sprintf("backup-%s.tar.gz", time.Now().UTC().Format("20060102-150405"))
+	if raw, ok := req.Query["name"].(string); ok && raw != "" {
+		fileName = filepath.Base(raw)
+		if !strings.HasSuffix(fileName, ".tar.gz") {
+			fileName += ".tar.gz"
+		}
+	}
+	archivePath := filepath.Join(storage.BackupDir, fileName)
+
+	manifest, err := storage.GlobalManager.Backup(names, archivePath)
+	if err != nil {
+		return api.Response{Status: api.StatusError, Message: fmt.Sprintf("backup failed: %v", err)}
+	}
+
+	collections := make([]map[string]any, 0, len(manifest.Collections))
+	for _, coll := range manifest.Collections {
+		collections = append(collections, map[string]any{
+			"collection":  coll.Name,
+			"documents":   coll.Documents,
+			"snapshot_at": coll.SnapshotAt.Format(time.RFC3339Nano),
+		})
+	}
+
+	return api.Response{
+		Status:  api.StatusSuccess,
+		Message: fmt.Sprintf("Backup of %d collection(s) written to %s", len(collections), archivePath),
+		Data:    collections,
+		Count:   len(collections),
+	}
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"context"
+	"net/netip"
+	"nosql_db/internal/index"
+	"nosql_db/internal/operators"
+	"nosql_db/internal/storage"
+	"sort"
+)
+
+// docSource — откуда берутся документы: снимок для find,
+// коллекция в воркере записи для delete
+type docSource interface {
+	GetIndex(field string) (*index.BTree, bool)
+	GetByID(id string) (map[string]any, bool)
+	Scan(fn func(doc map[string]any) bool)
+}
+
+// forEachMatch передаёт в fn документы, подходящие под запрос; fn возвращает
+// false, чтобы остановиться. Кандидаты берутся из индекса, если он есть хотя бы
+// для одного поля запроса, иначе обходится вся коллекция. Каждый кандидат
+// проверяется всем запросом, поэтому остальные условия тоже учитываются.
+// Возвращает число просмотренных документов и поле использованного индекса
+func forEachMatch(ctx context.Context, src docSource, query map[string]any, fn func(doc map[string]any) bool) (int, string, error) {
+	examined := 0
+	var err error
+	visit := func(doc map[string]any) bool {
+		if examined%checkInterval == 0 {
+			if err = ctx.Err(); err != nil {
+				return false
+			}
+		}
+		examined++
+		if !operators.MatchDocument(doc, query) {
+			return true
+		}
+		return fn(doc)
+	}
+
+	field, condition := pickIndex(src, query)
+	if field == "" {
+		src.Scan(visit)
+		return examined, "", err
+	}
+
+	btree, _ := src.GetIndex(field)
+	idErr := candidateIDs(ctx, btree, condition, func(value index.Value) bool {
+		doc, ok := src.GetByID(string(value))
+		return !ok || visit(doc)
+	})
+	if err == nil {
+		err = idErr
+	}
+	return examined, field, err
+}
+
+// candidateIDs передаёт в fn id документов из индекса для условия поля,
+// не читая документы; fn возвращает false, чтобы остановиться
+func candidateIDs(ctx context.Context, btree *index.BTree, condition any, fn func(index.Value) bool) error {
+	if cond, ok := condition.(map[string]any); ok {
+		if prefixes, ok := cidrCondition(btree, cond); ok {
+			return ascendNetworks(ctx, btree, prefixes, fn)
+		}
+		if rangeCondition(btree, cond) {
+			// диапазон обходится по дереву без сбора всех id, $gt и $lt можно совмещать
+			var start, end index.Key
+			if gtValue, ok := cond["$gt"]; ok {
+				start = btree.Key(gtValue)
+			}
+			if ltValue, ok := cond["$lt"]; ok {
+				end = btree.Key(ltValue)
+			}
+			return btree.AscendRange(ctx, start, end, false, false, fn)
+		}
+	}
+
+	for _, value := range indexLookup(btree, condition) {
+		if !fn(value) {
+			break
+		}
+	}
+	return nil
+}
+
+// ascendNetworks обходит ip-индекс по диапазонам сетей $cidr, fn возвращает
+// false, чтобы остановиться. Сети могут пересекаться, повторные id пропускаются
+func ascendNetworks(ctx context.Context, btree *index.BTree, prefixes []netip.Prefix, fn func(index.Value) bool) error {
+	seen := make(map[string]bool)
+	for _, prefix := range prefixes {
+		start, end := index.IPRangeKeys(prefix)
+		stopped := false
+		err := btree.AscendRange(ctx, start, end, true, true, func(value index.Value) bool {
+			if len(prefixes) > 1 {
+				if seen[string(value)] {
+					return true
+				}
+				seen[string(value)] = true
+			}
+			stopped = !fn(value)
+			return !stopped
+		})
+		if err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+// cidrCondition — сети $cidr, если их можно искать по ip-индексу
+func cidrCondition(btree *index.BTree, cond map[string]any) ([]netip.Prefix, bool) {
+	raw, ok := cond["$cidr"]
+	if !ok || btree.Kind() != index.KeyIP {
+		return nil, false
+	}
+	return operators.ParseCIDRs(raw)
+}
+
+// rangeCondition — есть $gt или $lt, и их можно искать по дереву. Адреса
+// сравниваются как числа, а в обычном индексе их ключи — строки, поэтому
+// диапазон адресов берётся только из ip-индекса
+func rangeCondition(btree *index.BTree, cond map[string]any) bool {
+	_, hasGt := cond["$gt"]
+	_, hasLt := cond["$lt"]
+	if !hasGt && !hasLt {
+		return false
+	}
+	if btree.Kind() == index.KeyIP {
+		return true
+	}
+	for _, op := range []string{"$gt", "$lt"} {
+		if _, ok := operators.ParseIP(cond[op]); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// pickIndex выбирает поле запроса с индексом. Диапазон по _id берётся первым:
+// постраничное чтение опирается на порядок _id. Дальше — равенство и $in,
+// потом диапазон и $cidr по ip-индексу; диапазон адресов — только по ip-индексу. "" — индекс не подходит, нужен полный обход.
+// Запрос только из $and берёт кандидатов по одному из его условий; с $or
+// и с $and рядом с другими полями индекс не берётся
+func pickIndex(src docSource, query map[string]any) (string, any) {
+	if conditions, ok := query["$and"].([]any); ok && len(query) == 1 {
+		return pickAndIndex(src, conditions)
+	}
+	if hasLogicalOperators(query) {
+		return "", nil
+	}
+	if btree, ok := src.GetIndex(storage.IDField); ok && indexableCondition(btree, query[storage.IDField]) == "range" {
+		return storage.IDField, query[storage.IDField]
+	}
+	fields := make([]string, 0, len(query))
+	for field := range query {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	rangeField := ""
+	for _, field := range fields {
+		btree, ok := src.GetIndex(field)
+		if !ok {
+			continue
+		}
+		kind := indexableCondition(btree, query[field])
+		if kind == "" {
+			continue
+		}
+		if kind == "eq" {
+			return field, query[field]
+		}
+		if rangeField == "" {
+			rangeField = field
+		}
+	}
+	if rangeField == "" {
+		return "", nil
+	}
+	return rangeField, query[rangeField]
+}
+
+// pickAndIndex выбирает индекс среди условий $and: все они обязательны,
+// поэтому кандидаты любого из них покрывают ответ. Диапазон по _id — первым
+func pickAndIndex(src docSource, conditions []any) (string, any) {
+	field, condition := "", any(nil)
+	for _, raw := range conditions {
+		query, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		f, c := pickIndex(src, query)
+		if f == storage.IDField {
+			if btree, _ := src.GetIndex(f); indexableCondition(btree, c) == "range" {
+				return f, c
+			}
+		}
+		if field == "" {
+			field, condition = f, c
+		}
+	}
+	return field, condition
+}
+
+// indexableCondition — можно ли взять кандидатов для условия из индекса:
+// "eq" для значения, $eq и $in, "range" для $gt/$lt и $cidr, "" — нельзя
+func indexableCondition(btree *index.BTree, condition any) string {
+	if isScalar(condition) {
+		return "eq"
+	}
+	cond, ok := condition.(map[string]any)
+	if !ok {
+		return ""
+	}
+	if values, ok := cond["$in"].([]any); isScalar(cond["$eq"]) || ok && allScalar(values) {
+		return "eq"
+	}
+	if _, ok := cidrCondition(btree, cond); ok || rangeCondition(btree, cond) {
+		return "range"
+	}
+	return ""
+}
+
+// indexLookup возвращает id документов для условия на равенство
+func indexLookup(btree *index.BTree, condition any) []index.Value {
+	cond, ok := condition.(map[string]any)
+	if !ok {
+		return btree.Search(btree.Key(condition))
+	}
+	if isScalar(cond["$eq"]) {
+		return btree.Search(btree.Key(cond["$eq"]))
+	}
+	inValues, _ := cond["$in"].([]any)
+	keys := make([]index.Key, 0, len(inValues))
+	for _, val := range inValues {
+		keys = append(keys, btree.Key(val))
+	}
+	return btree.SearchIn(keys)
+}
+
+func isScalar(v any) bool {
+	switch v.(type) {
+	case float64, int, int64, string, bool:
+		return true
+	}
+	return false
+}
+
+func allScalar(values []any) bool {
+	for _, v := range values {
+		if !isScalar(v) {
+			return false
+		}
+	}
+	return true
+}
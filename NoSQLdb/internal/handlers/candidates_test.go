@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"fmt"
+	"nosql_db/internal/index"
+	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
+	"slices"
+	"sort"
+	"testing"
+)
+
+// sevs — значения поля sev в документах ответа по возрастанию
+func sevs(resp api.Response) []float64 {
+	var out []float64
+	for _, doc := range resp.Data {
+		out = append(out, doc["sev"].(float64))
+	}
+	sort.Float64s(out)
+	return out
+}
+
+func equalFloats(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// setupSeverities — коллекция с индексом по sev и отрицательными значениями
+func setupSeverities(t *testing.T) {
+	t.Helper()
+	setupStorage(t)
+	for _, sev := range []float64{-20, -3, -0.5, 0, 1.5, 7} {
+		insert(t, "events", map[string]any{"sev": sev, "host": "a"})
+	}
+	createIndex(t, "events", "sev")
+}
+
+func TestIndexedRangeWithNegativeNumbers(t *testing.T) {
+	setupSeverities(t)
+	cases := []struct {
+		query map[string]any
+		want  []float64
+	}{
+		{map[string]any{"sev": map[string]any{"$gt": -10.0}}, []float64{-3, -0.5, 0, 1.5, 7}},
+		{map[string]any{"sev": map[string]any{"$lt": 2.0}}, []float64{-20, -3, -0.5, 0, 1.5}},
+		{map[string]any{"sev": map[string]any{"$gt": -5.0, "$lt": 0.0}}, []float64{-3, -0.5}},
+		{map[string]any{"sev": map[string]any{"$lt": -1.0}, "host": "a"}, []float64{-20, -3}},
+		{map[string]any{"sev": -3.0}, []float64{-3}},
+	}
+	for _, c := range cases {
+		resp := do(t, api.Request{Database: "events", Command: api.CmdFind, Query: c.query})
+		if got := sevs(resp); !equalFloats(got, c.want) {
+			t.Errorf("find %v = %v, want %v", c.query, got, c.want)
+		}
+	}
+}
+
+func TestIPRangeOnPlainIndex(t *testing.T) {
+	setupStorage(t)
+	for _, ip := range []string{"10.0.0.1", "9.0.0.5", "200.1.1.1"} {
+		insert(t, "events", map[string]any{"ip": ip})
+	}
+	// в обычном индексе адреса лежат строками: "10.0.0.1" < "9.0.0.1"
+	createIndex(t, "events", "ip")
+
+	cases := []struct {
+		query map[string]any
+		want  int
+	}{
+		{map[string]any{"ip": map[string]any{"$gt": "9.0.0.1"}}, 3},
+		{map[string]any{"ip": map[string]any{"$lt": "10.0.0.0"}}, 1},
+		{map[string]any{"ip": map[string]any{"$gt": "9.0.0.1", "$lt": "11.0.0.0"}}, 2},
+		{map[string]any{"ip": map[string]any{"$in": []any{"10.0.0.1", "200.1.1.1"}, "$gt": "9.0.0.1"}}, 2},
+	}
+	for _, c := range cases {
+		resp := do(t, api.Request{Database: "events", Command: api.CmdFind, Query: c.query})
+		if len(resp.Data) != c.want {
+			t.Errorf("find %v = %d documents, want %d", c.query, len(resp.Data), c.want)
+		}
+	}
+}
+
+// strValues — значения поля v в документах ответа по возрастанию
+func strValues(resp api.Response) []string {
+	var out []string
+	for _, doc := range resp.Data {
+		out = append(out, fmt.Sprint(doc["v"]))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestRangeIndexMatchesScan(t *testing.T) {
+	setupStorage(t)
+	// строки всех родов: обычные, метки времени, адреса, и не строки
+	values := []any{"", "a", "b", "Z", "10", "2024-06-01", "2024-06-01T00:00:00Z",
+		"2025-03-01T00:00:00+03:00", "10.0.0.1", "9.0.0.5", "::1", 5.0, true}
+	for _, coll := range []string{"scan", "plain", "ip"} {
+		for _, v := range values {
+			insert(t, coll, map[string]any{"v": v})
+		}
+	}
+	createIndex(t, "plain", "v")
+	build, err := storage.GlobalManager.BuildIndex("ip", "v", 64, index.KeyIP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-build.Done()
+
+	for _, operand := range values {
+		for _, op := range []string{"$gt", "$lt"} {
+			query := map[string]any{"v": map[string]any{op: operand}}
+			want := strValues(do(t, api.Request{Database: "scan", Command: api.CmdFind, Query: query}))
+			for _, coll := range []string{"plain", "ip"} {
+				got := strValues(do(t, api.Request{Database: coll, Command: api.CmdFind, Query: query}))
+				if !slices.Equal(got, want) {
+					t.Errorf("%s index: find %v = %q, scan = %q", coll, query, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestTimeRangeWithMixedFormats(t *testing.T) {
+	setupStorage(t)
+	for _, coll := range []string{"scan", "indexed"} {
+		insert(t, coll, map[string]any{"ts": "2024-06-01"}, map[string]any{"ts": "2024-06-01T00:00:00Z"},
+			map[string]any{"ts": "2024-06-01T05:00:00+03:00"})
+	}
+	createIndex(t, "indexed", "ts")
+
+	// дата без времени — обычная строка, с меткой времени не сравнивается
+	cases := []struct {
+		query map[string]any
+		want  []string
+	}{
+		{map[string]any{"ts": map[string]any{"$lt": "2025-01-01T00:00:00Z"}}, []string{"2024-06-01T00:00:00Z", "2024-06-01T05:00:00+03:00"}},
+		{map[string]any{"ts": map[string]any{"$gt": "2024-06-01T01:00:00Z"}}, []string{"2024-06-01T05:00:00+03:00"}},
+		{map[string]any{"ts": map[string]any{"$gt": "2024-05-31"}}, []string{"2024-06-01"}},
+	}
+	for _, c := range cases {
+		for _, coll := range []string{"scan", "indexed"} {
+			resp := do(t, api.Request{Database: coll, Command: api.CmdFind, Query: c.query})
+			got := make([]string, 0, len(resp.Data))
+			for _, doc := range resp.Data {
+				got = append(got, doc["ts"].(string))
+			}
+			sort.Strings(got)
+			if !slices.Equal(got, c.want) {
+				t.Errorf("%s: find %v = %q, want %q", coll, c.query, got, c.want)
+			}
+		}
+	}
+}
+
+func TestIndexedDeleteWithNegativeRange(t *testing.T) {
+	setupSeverities(t)
+	resp := do(t, api.Request{Database: "events", Command: api.CmdDelete,
+		Query: map[string]any{"sev": map[string]any{"$lt": 0.0}}})
+	if resp.Count != 3 {
+		t.Fatalf("deleted %d documents, want 3: %s", resp.Count, resp.Message)
+	}
+	left := do(t, api.Request{Database: "events", Command: api.CmdFind})
+	if got := sevs(left); !equalFloats(got, []float64{0, 1.5, 7}) {
+		t.Fatalf("left after delete: %v", got)
+	}
+}
+
+func TestIndexedSampleWithNegativeRange(t *testing.T) {
+	setupSeverities(t)
+	resp := do(t, api.Request{Database: "events", Command: api.CmdSample, Limit: 10,
+		Query: map[string]any{"sev": map[string]any{"$gt": -25.0, "$lt": -1.0}}})
+	if got := sevs(resp); !equalFloats(got, []float64{-20, -3}) {
+		t.Fatalf("sample = %v, want [-20 -3]", got)
+	}
+}
+
+func TestIDRangeKeepsIDOrder(t *testing.T) {
+	setupStorage(t)
+	// свои _id не по порядку: индекс host отдал бы их в порядке вставки
+	for _, id := range []string{"5", "1", "4", "2", "3"} {
+		insert(t, "events", map[string]any{"_id": id, "host": "a"})
+	}
+	createIndex(t, "events", "host")
+
+	page := map[string]any{"_id": map[string]any{"$gt": "1"}}
+	for _, query := range []map[string]any{
+		{"_id": page["_id"], "host": "a"},
+		{"$and": []any{page, map[string]any{"host": "a"}}},
+	} {
+		resp := do(t, api.Request{Database: "events", Command: api.CmdFind, Query: query, Limit: 2})
+		var ids []any
+		for _, doc := range resp.Data {
+			ids = append(ids, doc["_id"])
+		}
+		if len(ids) != 2 || ids[0] != "2" || ids[1] != "3" {
+			t.Errorf("find %v = %v, want [2 3]", query, ids)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
+	"strings"
+)
+
+// handleConfigure меняет настройки коллекции: compression, а также max_docs
+// и max_bytes capped-коллекции (оба 0 — снять ограничения)
+func handleConfigure(ctx context.Context, req api.Request) api.Response {
+	_, hasCompression := req.Query["compression"]
+	_, hasMaxDocs := req.Query["max_docs"]
+	_, hasMaxBytes := req.Query["max_bytes"]
+	if !hasCompression && !hasMaxDocs && !hasMaxBytes {
+		return api.Response{Status: api.StatusError, Message: "no options provided for configure"}
+	}
+
+	var compression storage.Compression
+	if hasCompression {
+		name, ok := req.Query["compression"].(string)
+		if !ok {
+			return api.Response{Status: api.StatusError, Message: "compression must be a string"}
+		}
+		var err error
+		if compression, err = storage.ParseCompression(name); err != nil {
+			return api.Response{Status: api.StatusError, Message: err.Error()}
+		}
+	}
+
+	var capped *storage.CappedOptions
+	if hasMaxDocs || hasMaxBytes {
+		maxDocs, err := nonNegativeInt(req.Query, "max_docs")
+		if err != nil {
+			return api.Response{Status: api.StatusError, Message: err.Error()}
+		}
+		maxBytes, err := nonNegativeInt(req.Query, "max_bytes")
+		if err != nil {
+			return api.Response{Status: api.StatusError, Message: err.Error()}
+		}
+		if maxDocs > 0 || maxBytes > 0 {
+			capped = &storage.CappedOptions{MaxDocs: int(maxDocs), MaxBytes: maxBytes}
+		}
+	}
+
+	// Используем очередь для write-операции
+	result := storage.GlobalManager.Enqueue(ctx, req.Database, func(coll *storage.Collection) (storage.WriteResult, error) {
+		var messages []string
+		if hasCompression {
+			if err := coll.SetCompression(compression); err != nil {
+				return storage.WriteResult{}, fmt.Errorf("failed to change compression: %w", err)
+			}
+			messages = append(messages, fmt.Sprintf("Compression set to '%s'", compression))
+		}
+		if hasMaxDocs || hasMaxBytes {
+			evicted, err := coll.SetCapped(capped)
+			if err != nil {
+				return storage.WriteResult{}, fmt.Errorf("failed to change capped limits: %w", err)
+			}
+			if capped == nil {
+				messages = append(messages, "Capped limits removed")
+			} else {
+				messages = append(messages, fmt.Sprintf("Capped to max_docs=%d, max_bytes=%d, evicted %d document(s)",
+					capped.MaxDocs, capped.MaxBytes, evicted))
+			}
+		}
+
+		return storage.WriteResult{
+			Message: strings.Join(messages, "; "),
+		}, nil
+	})
+
+	if result.Error != nil {
+		return errorResponse(result.Error, req)
+	}
+
+	return api.Response{
+		Status:  api.StatusSuccess,
+		Message: result.Message,
+	}
+}
+
+// nonNegativeInt читает целое неотрицательное число из запроса, нет поля — 0
+func nonNegativeInt(query map[string]any, name string) (int64, error) {
+	raw, ok := query[name]
+	if !ok {
+		return 0, nil
+	}
+	v, ok := raw.(float64)
+	if !ok || v < 0 || v != float64(int64(v)) {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return int64(v), nil
+}
@@ -1,35 +1,43 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
-	"nosql_db/internal/api"
-	"nosql_db/internal/operators"
 	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
 )
 
-func handleDelete(req api.Request) api.Response {
-	// Используем очередь для write-операции
-	result := storage.GlobalManager.Enqueue(req.Database, func(coll *storage.Collection) (storage.WriteResult, error) {
-		// Находим документы для удаления через FullScan
-		allDocs := coll.All()
-		deletedCount := 0
+// handleDelete удаляет документы по запросу; limit > 0 ограничивает число
+// удалённых, delete_one удаляет не больше одного. Воркер сохраняет данные
+// и изменения индексов вместе с другими задачами группы
+func handleDelete(ctx context.Context, req api.Request, stats *execStats) api.Response {
+	limit := req.Limit
+	if req.Command == api.CmdDeleteOne {
+		limit = 1
+	}
 
-		for _, doc := range allDocs {
-			if operators.MatchDocument(doc, req.Query) {
-				if id, ok := doc["_id"].(string); ok {
-					if coll.Delete(id) {
-						deletedCount++
-					}
-				}
+	result := storage.GlobalManager.EnqueueGroup(ctx, req.Database, func(coll *storage.Collection) (storage.WriteResult, error) {
+		// Кандидаты берутся из индекса, как в find.
+		// Отмена возможна только до начала удаления, чтобы не оставить его частичным
+		var ids []string
+		examined, field, err := forEachMatch(ctx, coll, req.Query, func(doc map[string]any) bool {
+			if id, ok := doc[storage.IDField].(string); ok {
+				ids = append(ids, id)
 			}
+			return limit <= 0 || len(ids) < limit
+		})
+		stats.Examined, stats.IndexField = examined, field
+		if err != nil {
+			return storage.WriteResult{}, err
+		}
+		if !beginCommit(ctx) {
+			return storage.WriteResult{}, context.Cause(ctx)
 		}
 
-		if deletedCount > 0 {
-			if err := coll.Save(); err != nil {
-				return storage.WriteResult{}, fmt.Errorf("failed to save changes: %w", err)
-			}
-			if err := coll.RebuildAllIndexes(); err != nil {
-				return storage.WriteResult{}, fmt.Errorf("failed to rebuild indexes: %w", err)
+		deletedCount := 0
+		for _, id := range ids {
+			if coll.Delete(id) {
+				deletedCount++
 			}
 		}
 
@@ -40,7 +48,7 @@ func handleDelete(req api.Request) api.Response {
 	})
 
 	if result.Error != nil {
-		return api.Response{Status: api.StatusError, Message: result.Error.Error()}
+		return errorResponse(result.Error, req)
 	}
 
 	return api.Response{
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"fmt"
+	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
+)
+
+// handleEncryptionStatus показывает ключи шифрования и ход последнего перешифрования
+func handleEncryptionStatus() api.Response {
+	keys := storage.CurrentKeyRing()
+	info := map[string]any{
+		"enabled": false,
+		"keys":    keys.Len(),
+	}
+	if id, ok := keys.ActiveID(); ok {
+		info["enabled"] = true
+		info["active_key"] = id.String()
+	}
+	if rekey := storage.GlobalManager.RekeyStatus(); rekey != nil {
+		info["rekey"] = rekeyInfo(rekey.Progress())
+	}
+	return api.Response{Status: api.StatusSuccess, Data: []map[string]any{info}, Count: 1}
+}
+
+// handleRotateKey перечитывает файл ключей и запускает фоновое перешифрование
+func handleRotateKey() api.Response {
+	rekey, err := storage.GlobalManager.RotateKey()
+	if err != nil {
+		return api.Response{Status: api.StatusError, Message: fmt.Sprintf("key rotation failed: %v", err)}
+	}
+	p := rekey.Progress()
+	return api.Response{
+		Status:  api.StatusSuccess,
+		Message: fmt.Sprintf("Re-encryption of %d collection(s) started", p.Collections),
+		Data:    []map[string]any{rekeyInfo(p)},
+		Count:   1,
+	}
+}
+
+func rekeyInfo(p storage.RekeyProgress) map[string]any {
+	info := map[string]any{
+		"state":       string(p.State),
+		"collections": p.Collections,
+		"rewritten":   p.Rewritten,
+		"elapsed_ms":  p.Elapsed.Milliseconds(),
+	}
+	if p.Stale > 0 {
+		info["stale_files"] = p.Stale
+	}
+	if p.Error != "" {
+		info["error"] = p.Error
+	}
+	return info
+}
@@ -1,35 +1,130 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
-	"nosql_db/internal/api"
+	"nosql_db/internal/metrics"
+	"nosql_db/internal/operators"
+	"nosql_db/internal/profiler"
 	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
+	"time"
 )
 
+var (
+	requestsTotal = metrics.NewCounterVec("nosqldb_requests_total",
+		"Number of processed requests.", "operation", "collection", "status")
+	requestDuration = metrics.NewHistogramVec("nosqldb_request_duration_seconds",
+		"Request processing time.", metrics.DefaultBuckets, "operation", "collection")
+)
+
+// execStats — сведения о выполнении запроса для профилировщика
+type execStats struct {
+	IndexField string // поле индекса, если поиск шёл по индексу
+	Examined   int    // сколько документов просмотрено
+}
+
 // HandleRequest — точка входа для обработки запросов
-func HandleRequest(req api.Request) api.Response {
+func HandleRequest(ctx context.Context, req api.Request) api.Response {
+	start := time.Now()
+	ctx, cancel := requestContext(ctx, req)
+	defer cancel()
+
+	var stats execStats
+	resp := dispatch(ctx, req, &stats)
+	resp.RequestID = req.RequestID
+	elapsed := time.Since(start)
+
+	requestDuration.Observe(elapsed.Seconds(), req.Command, req.Database)
+	requestsTotal.Inc(req.Command, req.Database, resp.Status)
+	profiler.Observe(profiler.Record{
+		Timestamp:    start.UTC(),
+		Operation:    req.Command,
+		Collection:   req.Database,
+		IndexUsed:    stats.IndexField != "",
+		IndexField:   stats.IndexField,
+		DocsExamined: stats.Examined,
+		DocsReturned: len(resp.Data),
+		Status:       resp.Status,
+	}, req.Query, elapsed)
+	return resp
+}
+
+// dispatch выбирает обработчик по команде
+func dispatch(ctx context.Context, req api.Request, stats *execStats) api.Response {
+	// Административные команды не привязаны к одной коллекции
+	switch req.Command {
+	case api.CmdBackup:
+		return handleBackup(req)
+	case api.CmdPing:
+		return api.Response{Status: api.StatusSuccess, Message: "pong"}
+	case api.CmdIndexBuilds:
+		return handleIndexBuilds(req)
+	case api.CmdValidate:
+		return handleValidate(req)
+	case api.CmdRotateKey:
+		return handleRotateKey()
+	case api.CmdEncryptionStatus:
+		return handleEncryptionStatus()
+	}
+
 	if req.Database == "" {
 		return api.Response{Status: api.StatusError, Message: "database name is required"}
 	}
 
+	// {"$date": "-24h"} и другие обёртки дат считаются один раз на запрос
+	switch req.Command {
+	case api.CmdFind, api.CmdSample, api.CmdDelete, api.CmdDeleteOne:
+		query, err := operators.ResolveDates(req.Query, time.Now())
+		if err != nil {
+			return api.Response{Status: api.StatusError, Message: err.Error()}
+		}
+		req.Query = query
+	}
+
 	switch req.Command {
 	case api.CmdInsert:
 		// Write-операция через очередь
-		return handleInsert(req)
+		return handleInsert(ctx, req)
 	case api.CmdFind:
-		// Read-операция напрямую (не требует очереди)
+		// Read-операция напрямую по снимку коллекции (не требует очереди)
 		coll, err := storage.GlobalManager.GetCollection(req.Database)
 		if err != nil {
 			return api.Response{Status: api.StatusError, Message: fmt.Sprintf("failed to load database: %v", err)}
 		}
-		return handleFind(coll, req)
-	case api.CmdDelete:
+		snap := coll.Snapshot()
+		defer snap.Release()
+		return handleFind(ctx, snap, req, stats)
+	case api.CmdSample:
+		// Read-операция по снимку, как find
+		coll, err := storage.GlobalManager.GetCollection(req.Database)
+		if err != nil {
+			return api.Response{Status: api.StatusError, Message: fmt.Sprintf("failed to load database: %v", err)}
+		}
+		snap := coll.Snapshot()
+		defer snap.Release()
+		return handleSample(ctx, snap, req, stats)
+	case api.CmdDelete, api.CmdDeleteOne:
 		// Write-операция через очередь
-		return handleDelete(req)
+		return handleDelete(ctx, req, stats)
 	case api.CmdCreateIndex:
-		// Write-операция через очередь
+		// Постройка в фоне, через очередь только начало и публикация
 		return handleCreateIndex(req)
+	case api.CmdCancelIndexBuild:
+		return handleCancelIndexBuild(req)
+	case api.CmdStats:
+		coll, err := storage.GlobalManager.GetCollection(req.Database)
+		if err != nil {
+			return api.Response{Status: api.StatusError, Message: fmt.Sprintf("failed to load database: %v", err)}
+		}
+		return handleStats(coll)
+	case api.CmdConfigure:
+		// Write-операция через очередь
+		return handleConfigure(ctx, req)
+	case api.CmdSetValidator:
+		// Write-операция через очередь
+		return handleSetValidator(ctx, req)
 	default:
-		return api.Response{Status: api.StatusError, Message: fmt.Sprintf("unknown command: %s", req.Command)}
+		return api.Response{Status: api.StatusError, Message: fmt.Sprintf("unknown command: %s", req.Command), Code: api.CodeUnknownCommand}
 	}
 }
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"context"
+	"nosql_db/internal/index"
+	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
+	"testing"
+)
+
+// setupStorage — пустой каталог данных и свой менеджер коллекций на тест
+func setupStorage(t *testing.T) {
+	t.Helper()
+	storage.DataDir = t.TempDir()
+	prev := storage.GlobalManager
+	storage.GlobalManager = storage.NewManager()
+	t.Cleanup(func() {
+		storage.GlobalManager.Stop()
+		storage.GlobalManager = prev
+	})
+}
+
+// do выполняет запрос и падает, если он не успешен
+func do(t *testing.T, req api.Request) api.Response {
+	t.Helper()
+	resp := HandleRequest(context.Background(), req)
+	if resp.Status != api.StatusSuccess {
+		t.Fatalf("%s: %s", req.Command, resp.Message)
+	}
+	return resp
+}
+
+// insert вставляет документы в коллекцию
+func insert(t *testing.T, coll string, docs ...map[string]any) {
+	t.Helper()
+	do(t, api.Request{Database: coll, Command: api.CmdInsert, Data: docs})
+}
+
+// createIndex строит индекс и ждёт окончания постройки
+func createIndex(t *testing.T, coll, field string) {
+	t.Helper()
+	build, err := storage.GlobalManager.BuildIndex(coll, field, 64, index.KeyValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-build.Done()
+	if err := build.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,38 +2,90 @@ package handlers
 
 import (
 	"fmt"
-	"nosql_db/internal/api"
+	"nosql_db/internal/index"
 	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
 )
 
+// handleCreateIndex запускает фоновую постройку индекса по полю из query;
+// строковое значение поля — тип индекса ("ip"), любое другое — обычный индекс.
+// Ход постройки показывает index_builds
 func handleCreateIndex(req api.Request) api.Response {
 	fieldName := ""
-	for k := range req.Query {
-		fieldName = k
+	var kindName any
+	for k, v := range req.Query {
+		fieldName, kindName = k, v
 		break
 	}
 
 	if fieldName == "" {
 		return api.Response{Status: api.StatusError, Message: "field name required in query"}
 	}
-
-	// Используем очередь для write-операции
-	result := storage.GlobalManager.Enqueue(req.Database, func(coll *storage.Collection) (storage.WriteResult, error) {
-		if err := coll.CreateIndex(fieldName, 64); err != nil {
-			return storage.WriteResult{}, fmt.Errorf("failed to create index: %w", err)
+	kind := index.KeyValue
+	if name, ok := kindName.(string); ok {
+		var err error
+		if kind, err = index.ParseKeyKind(name); err != nil {
+			return api.Response{Status: api.StatusError, Message: err.Error()}
 		}
+	}
 
-		return storage.WriteResult{
-			Message: fmt.Sprintf("Index created on field '%s'", fieldName),
-		}, nil
-	})
+	// постройка идёт в фоне, писатели коллекции не ждут её
+	build, err := storage.GlobalManager.BuildIndex(req.Database, fieldName, 64, kind)
+	if err != nil {
+		return api.Response{Status: api.StatusError, Message: fmt.Sprintf("failed to create index: %v", err), Code: errorCode(err)}
+	}
 
-	if result.Error != nil {
-		return api.Response{Status: api.StatusError, Message: result.Error.Error()}
+	return api.Response{
+		Status:  api.StatusSuccess,
+		Message: fmt.Sprintf("Index build started on field '%s'", fieldName),
+		Data:    []map[string]any{buildInfo(build.Progress())},
+		Count:   1,
 	}
+}
+
+// handleIndexBuilds показывает идущие и последние завершённые постройки индексов;
+// без database — по всем коллекциям
+func handleIndexBuilds(req api.Request) api.Response {
+	builds := storage.GlobalManager.IndexBuilds(req.Database)
+	data := make([]map[string]any, len(builds))
+	for i, p := range builds {
+		data[i] = buildInfo(p)
+	}
+	return api.Response{Status: api.StatusSuccess, Data: data, Count: len(data)}
+}
 
+// handleCancelIndexBuild отменяет постройку индекса по полю из query.field
+func handleCancelIndexBuild(req api.Request) api.Response {
+	fieldName, _ := req.Query["field"].(string)
+	if fieldName == "" {
+		return api.Response{Status: api.StatusError, Message: "field name required in query.field"}
+	}
+	if err := storage.GlobalManager.CancelIndexBuild(req.Database, fieldName); err != nil {
+		return api.Response{Status: api.StatusError, Message: err.Error()}
+	}
 	return api.Response{
 		Status:  api.StatusSuccess,
-		Message: result.Message,
+		Message: fmt.Sprintf("Index build on field '%s' canceled", fieldName),
+	}
+}
+
+func buildInfo(p storage.IndexBuildProgress) map[string]any {
+	info := map[string]any{
+		"collection": p.Collection,
+		"field":      p.Field,
+		"state":      string(p.State),
+		"processed":  p.Processed,
+		"total":      p.Total,
+		"elapsed_ms": p.Elapsed.Milliseconds(),
+	}
+	if p.Total > 0 {
+		info["percent"] = min(100, p.Processed*100/p.Total)
+	}
+	if p.Kind != index.KeyValue {
+		info["type"] = string(p.Kind)
+	}
+	if p.Error != "" {
+		info["error"] = p.Error
 	}
+	return info
 }
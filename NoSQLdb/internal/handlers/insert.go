@@ -1,49 +1,106 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"nosql_db/internal/api"
+	"nosql_db/internal/operators"
 	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
+	"time"
 )
 
-func handleInsert(req api.Request) api.Response {
+// errValidation — документы не прошли строгую проверку схемы
+var errValidation = errors.New("document validation failed")
+
+func handleInsert(ctx context.Context, req api.Request) api.Response {
 	if len(req.Data) == 0 {
 		return api.Response{Status: api.StatusError, Message: "no data provided for insert"}
 	}
 
-	// Используем очередь для write-операции
-	result := storage.GlobalManager.Enqueue(req.Database, func(coll *storage.Collection) (storage.WriteResult, error) {
-		var insertedIDs []string
+	// {"$date": ...} в документах сохраняется строкой RFC3339 в UTC
+	now := time.Now()
+	for i, doc := range req.Data {
+		resolved, err := operators.ResolveDates(doc, now)
+		if err != nil {
+			return api.Response{Status: api.StatusError, Message: fmt.Sprintf("document %d: %v", i, err)}
+		}
+		req.Data[i] = resolved
+	}
+
+	// ключи идемпотентности убираются из документов до проверки схемы
+	keys := storage.DedupKeys(req.Data, req.BatchID)
 
-		for _, doc := range req.Data {
-			id, err := coll.Insert(doc)
-			if err != nil {
-				return storage.WriteResult{}, fmt.Errorf("insert error: %w", err)
+	// нарушения заполняет воркер, ответ читается после Enqueue
+	var violations []api.Violation
+
+	// Вставка идёт через очередь коллекции, сохранение общее с соседними вставками
+	result := storage.GlobalManager.EnqueueGroup(ctx, req.Database, func(coll *storage.Collection) (storage.WriteResult, error) {
+		validator := coll.Validator()
+		if validator != nil {
+			violations = validateDocuments(validator, req.Data)
+			// в строгом режиме пакет отклоняется целиком
+			if len(violations) > 0 && validator.Mode == storage.ValidationStrict {
+				return storage.WriteResult{}, fmt.Errorf("%w: %d of %d document(s) violate the collection schema",
+					errValidation, len(violations), len(req.Data))
 			}
-			insertedIDs = append(insertedIDs, id)
 		}
 
-		if err := coll.Save(); err != nil {
-			return storage.WriteResult{}, fmt.Errorf("failed to save data: %w", err)
+		// пакет с повтором _id отклоняется целиком, повторы по ключу пропускаются
+		inserted, err := coll.InsertMany(req.Data, keys)
+		if err != nil {
+			return storage.WriteResult{}, fmt.Errorf("insert error: %w", err)
+		}
+		for i := range violations {
+			violations[i].ID = inserted.IDs[violations[i].Index]
 		}
 
-		if err := coll.SaveAllIndexes(); err != nil {
-			return storage.WriteResult{}, fmt.Errorf("failed to save indexes: %w", err)
+		insertedIDs := make([]string, 0, inserted.Inserted)
+		for i, id := range inserted.IDs {
+			if !inserted.Duplicate[i] {
+				insertedIDs = append(insertedIDs, id)
+			}
 		}
 
+		message := fmt.Sprintf("Inserted %d document(s)", len(insertedIDs))
+		if inserted.Deduplicated > 0 {
+			message += fmt.Sprintf(", skipped %d duplicate(s)", inserted.Deduplicated)
+		}
+		if len(violations) > 0 {
+			message += fmt.Sprintf(", %d with schema warnings", len(violations))
+		}
 		return storage.WriteResult{
-			InsertedIDs: insertedIDs,
-			Message:     fmt.Sprintf("Inserted %d document(s)", len(insertedIDs)),
+			InsertedIDs:  insertedIDs,
+			Deduplicated: inserted.Deduplicated,
+			Message:      message,
 		}, nil
 	})
 
 	if result.Error != nil {
-		return api.Response{Status: api.StatusError, Message: result.Error.Error()}
+		resp := errorResponse(result.Error, req)
+		if errors.Is(result.Error, errValidation) {
+			resp.Violations = violations
+			resp.Code = api.CodeSchemaViolation
+		}
+		return resp
 	}
 
 	return api.Response{
-		Status:  api.StatusSuccess,
-		Message: result.Message,
-		Count:   len(result.InsertedIDs),
+		Status:       api.StatusSuccess,
+		Message:      result.Message,
+		Count:        len(result.InsertedIDs),
+		Deduplicated: result.Deduplicated,
+		Violations:   violations,
+	}
+}
+
+// validateDocuments проверяет каждый документ пакета по схеме
+func validateDocuments(validator *storage.Validator, docs []map[string]any) []api.Violation {
+	var violations []api.Violation
+	for i, doc := range docs {
+		if errs := validator.Validate(doc); len(errs) > 0 {
+			violations = append(violations, api.Violation{Index: i, Errors: errs})
+		}
 	}
+	return violations
 }
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
+	"time"
+)
+
+var (
+	// DefaultMaxTime — лимит времени запроса, если клиент не указал max_time_ms; 0 — без лимита
+	DefaultMaxTime time.Duration
+	// MaxResultBytes — верхняя граница размера ответа find; 0 — без ограничения
+	MaxResultBytes int64
+)
+
+// checkInterval — как часто циклы сканирования проверяют контекст
+const checkInterval = 64
+
+var errResultTooLarge = errors.New("result exceeds max_result_bytes")
+
+// requestContext накладывает на запрос лимит времени из max_time_ms или серверный
+func requestContext(parent context.Context, req api.Request) (context.Context, context.CancelFunc) {
+	limit := DefaultMaxTime
+	if req.MaxTimeMS > 0 {
+		limit = time.Duration(req.MaxTimeMS) * time.Millisecond
+	}
+	if limit <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, limit)
+}
+
+// commitKey — ключ контекста с функцией, которую обработчик вызывает перед
+// необратимой записью
+type commitKey struct{}
+
+// WithCommit передаёт обработчикам commit: его вызывают перед записью, после
+// которой запрос уже не отменить. false — запрос отменён раньше, записывать нельзя
+func WithCommit(ctx context.Context, commit func() bool) context.Context {
+	return context.WithValue(ctx, commitKey{}, commit)
+}
+
+// beginCommit отмечает начало необратимой записи; false — запрос уже отменён
+func beginCommit(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if commit, ok := ctx.Value(commitKey{}).(func() bool); ok {
+		return commit()
+	}
+	return true
+}
+
+// errorResponse превращает ошибку отмены или лимита в понятный ответ
+func errorResponse(err error, req api.Request) api.Response {
+	var msg string
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		msg = "operation exceeded time limit"
+		if req.MaxTimeMS > 0 {
+			msg = fmt.Sprintf("operation exceeded time limit (max_time_ms=%d)", req.MaxTimeMS)
+		}
+	case errors.Is(err, context.Canceled):
+		msg = "operation was canceled"
+	default:
+		msg = err.Error()
+	}
+	return api.Response{Status: api.StatusError, Message: msg, Code: errorCode(err)}
+}
+
+// errorCode — класс ошибки для Response.Code, "" — ошибка запроса
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return api.CodeTimeLimit
+	case errors.Is(err, context.Canceled):
+		return api.CodeCanceled
+	case errors.Is(err, storage.ErrQueueFull), errors.Is(err, storage.ErrShuttingDown):
+		return api.CodeUnavailable
+	}
+	return ""
+}
+
+// resultBudget следит, чтобы ответ не превышал max_result_bytes
+type resultBudget struct {
+	limit int64
+	used  int64
+}
+
+func newResultBudget(req api.Request) *resultBudget {
+	limit := MaxResultBytes
+	if req.MaxResultBytes > 0 && (limit == 0 || req.MaxResultBytes < limit) {
+		limit = req.MaxResultBytes
+	}
+	return &resultBudget{limit: limit}
+}
+
+// add учитывает документ, возвращает ошибку при превышении лимита
+func (b *resultBudget) add(doc map[string]any) error {
+	if b.limit == 0 {
+		return nil
+	}
+	b.used += estimateSize(doc)
+	if b.used > b.limit {
+		return fmt.Errorf("%w (%d bytes): narrow the query or raise the limit", errResultTooLarge, b.limit)
+	}
+	return nil
+}
+
+// estimateSize приблизительно оценивает размер значения в json
+func estimateSize(v any) int64 {
+	switch val := v.(type) {
+	case nil:
+		return 4
+	case string:
+		return int64(len(val)) + 2
+	case bool:
+		return 5
+	case map[string]any:
+		size := int64(2)
+		for k, item := range val {
+			size += int64(len(k)) + 4 + estimateSize(item)
+		}
+		return size
+	case []any:
+		size := int64(2)
+		for _, item := range val {
+			size += estimateSize(item) + 1
+		}
+		return size
+	default:
+		return 24
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestContextDeadline(t *testing.T) {
+	defer func(prev time.Duration) { DefaultMaxTime = prev }(DefaultMaxTime)
+
+	DefaultMaxTime = 0
+	ctx, cancel := requestContext(context.Background(), api.Request{})
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatal("deadline set without max_time_ms and server limit")
+	}
+	cancel()
+
+	DefaultMaxTime = time.Hour
+	ctx, cancel = requestContext(context.Background(), api.Request{MaxTimeMS: 50})
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Second {
+		t.Fatalf("max_time_ms did not override the server limit: %v", time.Until(deadline))
+	}
+	cancel()
+
+	ctx, cancel = requestContext(context.Background(), api.Request{})
+	if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) < 59*time.Minute {
+		t.Fatal("server limit not applied without max_time_ms")
+	}
+	cancel()
+}
+
+func TestMaxTimeCancelsScan(t *testing.T) {
+	setupStorage(t)
+	docs := make([]map[string]any, 1000)
+	for i := range docs {
+		docs[i] = map[string]any{"n": float64(i)}
+	}
+	insert(t, "events", docs...)
+
+	// время запроса уже вышло: сканирование прерывается на первой проверке
+	parent, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	resp := HandleRequest(parent, api.Request{Database: "events", Command: api.CmdFind, MaxTimeMS: 5})
+	if resp.Status != api.StatusError || resp.Message != "operation exceeded time limit (max_time_ms=5)" {
+		t.Fatalf("find past max_time_ms: %s %q", resp.Status, resp.Message)
+	}
+
+	// отменённое удаление не удаляет ничего
+	resp = HandleRequest(parent, api.Request{Database: "events", Command: api.CmdDelete,
+		Query: map[string]any{"n": map[string]any{"$gt": -1.0}}, MaxTimeMS: 5})
+	if resp.Status != api.StatusError {
+		t.Fatalf("delete past max_time_ms succeeded: %s", resp.Message)
+	}
+	if left := do(t, api.Request{Database: "events", Command: api.CmdFind}); left.Count != len(docs) {
+		t.Fatalf("canceled delete removed documents: %d left", left.Count)
+	}
+}
+
+func TestMaxResultBytes(t *testing.T) {
+	defer func(prev int64) { MaxResultBytes = prev }(MaxResultBytes)
+	setupStorage(t)
+	for range 10 {
+		insert(t, "events", map[string]any{"raw_log": strings.Repeat("x", 1000)})
+	}
+
+	MaxResultBytes = 0
+	resp := HandleRequest(context.Background(), api.Request{Database: "events", Command: api.CmdFind, MaxResultBytes: 5000})
+	if resp.Status != api.StatusError || !strings.Contains(resp.Message, "result exceeds max_result_bytes") {
+		t.Fatalf("find over max_result_bytes: %s %q", resp.Status, resp.Message)
+	}
+	if resp := do(t, api.Request{Database: "events", Command: api.CmdFind, MaxResultBytes: 50000}); resp.Count != 10 {
+		t.Fatalf("find under max_result_bytes returned %d documents", resp.Count)
+	}
+
+	// клиент не может поднять серверный предел
+	MaxResultBytes = 5000
+	resp = HandleRequest(context.Background(), api.Request{Database: "events", Command: api.CmdFind, MaxResultBytes: 50000})
+	if resp.Status != api.StatusError {
+		t.Fatal("client raised the server result limit")
+	}
+}
+
+func TestDeleteRefusedAtCommitDeletesNothing(t *testing.T) {
+	setupStorage(t)
+	insert(t, "events", map[string]any{"n": 1.0}, map[string]any{"n": 2.0})
+
+	killed := errors.New("killed")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	ctx = WithCommit(ctx, func() bool {
+		// отмена пришла, когда документы уже выбраны
+		cancel(killed)
+		return false
+	})
+	resp := HandleRequest(ctx, api.Request{Database: "events", Command: api.CmdDelete})
+	if resp.Status != api.StatusError || resp.Message != killed.Error() {
+		t.Fatalf("delete refused at commit: %s %q", resp.Status, resp.Message)
+	}
+	if left := do(t, api.Request{Database: "events", Command: api.CmdFind}); left.Count != 2 {
+		t.Fatalf("%d documents left, want both", left.Count)
+	}
+}
+
+func TestErrorResponseCodes(t *testing.T) {
+	cases := []struct {
+		err  error
+		code string
+	}{
+		{context.DeadlineExceeded, api.CodeTimeLimit},
+		{fmt.Errorf("find: %w", context.Canceled), api.CodeCanceled},
+		{fmt.Errorf("%w: collection events", storage.ErrQueueFull), api.CodeUnavailable},
+		{storage.ErrShuttingDown, api.CodeUnavailable},
+		{errors.New("write queue is full, says the message only"), ""},
+	}
+	for _, c := range cases {
+		if resp := errorResponse(c.err, api.Request{}); resp.Code != c.code {
+			t.Errorf("%v: code %q, want %q", c.err, resp.Code, c.code)
+		}
+	}
+
+	resp := HandleRequest(context.Background(), api.Request{Database: "events", Command: "bogus"})
+	if resp.Code != api.CodeUnknownCommand {
+		t.Fatalf("unknown command answered with code %q", resp.Code)
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"nosql_db/internal/index"
+	"nosql_db/internal/operators"
+	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
+)
+
+// handleSample возвращает limit равновероятно выбранных документов, подходящих
+// под query. Если для условия есть индекс, выбор идёт среди его кандидатов
+// и читается не больше документов, чем нужно; иначе коллекция обходится один
+// раз reservoir sampling без копирования
+func handleSample(ctx context.Context, snap *storage.Snapshot, req api.Request, stats *execStats) api.Response {
+	if req.Limit <= 0 {
+		return api.Response{Status: api.StatusError, Message: "sample size required in limit"}
+	}
+
+	examined := 0
+	match := func(doc map[string]any) (bool, error) {
+		if examined%checkInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+		}
+		examined++
+		return operators.MatchDocument(doc, req.Query), nil
+	}
+
+	var results []map[string]any
+	var err error
+	field, condition := pickIndex(snap, req.Query)
+	if field == "" {
+		results, err = snap.Sample(req.Limit, match)
+	} else {
+		btree, _ := snap.GetIndex(field)
+		var ids []index.Value
+		err = candidateIDs(ctx, btree, condition, func(value index.Value) bool {
+			ids = append(ids, value)
+			return true
+		})
+		if err == nil {
+			results, err = snap.SampleIDs(ids, req.Limit, match)
+		}
+	}
+	stats.Examined, stats.IndexField = examined, field
+	if err != nil {
+		return errorResponse(err, req)
+	}
+
+	budget := newResultBudget(req)
+	for _, doc := range results {
+		if err := budget.add(doc); err != nil {
+			return errorResponse(err, req)
+		}
+	}
+	return api.Response{
+		Status: api.StatusSuccess,
+		Data:   results,
+		Count:  len(results),
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
+)
+
+func handleStats(coll *storage.Collection) api.Response {
+	stats := coll.Stats()
+
+	indexes := make([]any, 0, len(stats.Indexes))
+	for _, idx := range stats.Indexes {
+		info := map[string]any{
+			"field":             idx.Field,
+			"data_size":         idx.DataSize,
+			"storage_size":      idx.StorageSize,
+			"compression_ratio": idx.CompressionRatio,
+		}
+		if idx.Type != "" {
+			info["type"] = idx.Type
+		}
+		indexes = append(indexes, info)
+	}
+
+	info := map[string]any{
+		"collection":        stats.Name,
+		"documents":         stats.Documents,
+		"compression":       string(stats.Compression),
+		"data_size":         stats.DataSize,
+		"storage_size":      stats.StorageSize,
+		"compression_ratio": stats.CompressionRatio,
+		"indexes":           indexes,
+	}
+	if stats.Validator != nil {
+		info["validator"] = stats.Validator
+	}
+	if stats.Capped != nil {
+		info["capped"] = stats.Capped
+	}
+
+	return api.Response{
+		Status: api.StatusSuccess,
+		Data:   []map[string]any{info},
+		Count:  1,
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
+)
+
+// handleValidate сверяет индексы с документами; без database — индексы всех
+// коллекций. С query.repair перестраивает только сломанные индексы
+func handleValidate(req api.Request) api.Response {
+	repair, _ := req.Query["repair"].(bool)
+
+	names := []string{req.Database}
+	if req.Database == "" {
+		var err error
+		if names, err = storage.GlobalManager.ListCollections(); err != nil {
+			return api.Response{Status: api.StatusError, Message: err.Error()}
+		}
+	}
+
+	var data []map[string]any
+	broken, repaired := 0, 0
+	for _, name := range names {
+		reports, err := storage.GlobalManager.Validate(name, repair)
+		if err != nil {
+			return api.Response{Status: api.StatusError, Message: fmt.Sprintf("validate %s: %v", name, err)}
+		}
+		for _, r := range reports {
+			if !r.OK() {
+				broken++
+			}
+			if r.Repaired {
+				repaired++
+			}
+			data = append(data, reportInfo(r))
+		}
+	}
+
+	message := fmt.Sprintf("%d index(es) checked, %d broken", len(data), broken)
+	if repair {
+		message += fmt.Sprintf(", %d repaired", repaired)
+	}
+	return api.Response{Status: api.StatusSuccess, Message: message, Data: data, Count: len(data)}
+}
+
+func reportInfo(r storage.IndexReport) map[string]any {
+	info := map[string]any{
+		"collection": r.Collection,
+		"field":      r.Field,
+		"entries":    r.Entries,
+		"ok":         r.OK(),
+	}
+	if r.MissingCount > 0 {
+		info["missing"] = r.MissingCount
+		info["missing_ids"] = r.Missing
+	}
+	if r.DanglingCount > 0 {
+		info["dangling"] = r.DanglingCount
+		info["dangling_ids"] = r.Dangling
+	}
+	if r.DuplicateCount > 0 {
+		info["duplicates"] = r.DuplicateCount
+		info["duplicate_ids"] = r.Duplicates
+	}
+	if len(r.Structure) > 0 {
+		info["structure"] = r.Structure
+	}
+	if r.Repaired {
+		info["repaired"] = true
+	}
+	return info
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
+)
+
+// handleSetValidator задаёт схему коллекции, пустой query снимает проверку
+func handleSetValidator(ctx context.Context, req api.Request) api.Response {
+	var validator *storage.Validator
+	if len(req.Query) > 0 {
+		v, err := storage.ParseValidator(req.Query)
+		if err != nil {
+			return api.Response{Status: api.StatusError, Message: err.Error()}
+		}
+		validator = v
+	}
+
+	// Через очередь: вставки до команды проверяются по старой схеме, после — по новой
+	result := storage.GlobalManager.Enqueue(ctx, req.Database, func(coll *storage.Collection) (storage.WriteResult, error) {
+		if err := coll.SetValidator(validator); err != nil {
+			return storage.WriteResult{}, fmt.Errorf("failed to set validator: %w", err)
+		}
+		if validator == nil {
+			return storage.WriteResult{Message: "Validator removed"}, nil
+		}
+		return storage.WriteResult{
+			Message: fmt.Sprintf("Validator set in '%s' mode", validator.Mode),
+		}, nil
+	})
+
+	if result.Error != nil {
+		return errorResponse(result.Error, req)
+	}
+
+	return api.Response{
+		Status:  api.StatusSuccess,
+		Message: result.Message,
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"nosql_db/pkg/api"
+	"strings"
+	"testing"
+)
+
+func setValidator(t *testing.T, coll string, spec map[string]any) {
+	t.Helper()
+	do(t, api.Request{Database: coll, Command: api.CmdSetValidator, Query: spec})
+}
+
+var hostSchema = map[string]any{
+	"required": []any{"host"},
+	"fields":   map[string]any{"port": map[string]any{"type": "integer"}},
+}
+
+func TestStrictValidatorRejectsWholeBatch(t *testing.T) {
+	setupStorage(t)
+	setValidator(t, "strict", hostSchema)
+
+	resp := HandleRequest(context.Background(), api.Request{Database: "strict", Command: api.CmdInsert, Data: []map[string]any{
+		{"host": "web-1", "port": 22.0},
+		{"port": 80.0},
+		{"host": "web-3", "port": "ssh"},
+	}})
+	if resp.Status != api.StatusError || !strings.Contains(resp.Message, "2 of 3 document(s) violate the collection schema") {
+		t.Fatalf("strict insert: %+v", resp)
+	}
+	if len(resp.Violations) != 2 || resp.Violations[0].Index != 1 || resp.Violations[1].Index != 2 ||
+		resp.Violations[0].Errors[0] != "field 'host' is required" || resp.Violations[0].ID != "" {
+		t.Fatalf("violations %+v", resp.Violations)
+	}
+	if found := do(t, api.Request{Database: "strict", Command: api.CmdFind}); found.Count != 0 {
+		t.Fatalf("strict mode inserted %d document(s)", found.Count)
+	}
+
+	// без нарушений пакет вставляется
+	do(t, api.Request{Database: "strict", Command: api.CmdInsert, Data: []map[string]any{{"host": "web-1", "port": 22.0}}})
+}
+
+func TestWarnValidatorInsertsAndReports(t *testing.T) {
+	setupStorage(t)
+	setValidator(t, "warn", map[string]any{"mode": "warn", "required": hostSchema["required"], "fields": hostSchema["fields"]})
+
+	resp := do(t, api.Request{Database: "warn", Command: api.CmdInsert, Data: []map[string]any{
+		{"host": "web-1", "port": 22.0},
+		{"port": 80.5},
+	}})
+	if resp.Count != 2 || !strings.HasSuffix(resp.Message, ", 1 with schema warnings") {
+		t.Fatalf("warn insert: %+v", resp)
+	}
+	if len(resp.Violations) != 1 || resp.Violations[0].Index != 1 || len(resp.Violations[0].Errors) != 2 {
+		t.Fatalf("violations %+v", resp.Violations)
+	}
+	// нарушение ссылается на вставленный документ
+	found := do(t, api.Request{Database: "warn", Command: api.CmdFind, Query: map[string]any{"_id": resp.Violations[0].ID}})
+	if found.Count != 1 || found.Data[0]["port"] != 80.5 {
+		t.Fatalf("document with warnings: %+v", found)
+	}
+}
+
+func TestRemoveValidator(t *testing.T) {
+	setupStorage(t)
+	setValidator(t, "schema", hostSchema)
+	if resp := do(t, api.Request{Database: "schema", Command: api.CmdSetValidator}); resp.Message != "Validator removed" {
+		t.Fatalf("remove validator: %+v", resp)
+	}
+	do(t, api.Request{Database: "schema", Command: api.CmdInsert, Data: []map[string]any{{"port": "any"}}})
+
+	bad := HandleRequest(context.Background(), api.Request{Database: "schema", Command: api.CmdSetValidator, Query: map[string]any{"mode": "loose"}})
+	if bad.Status != api.StatusError {
+		t.Fatalf("bad schema accepted: %+v", bad)
+	}
+}
@@ -2,56 +2,103 @@ package index
 
 import "bytes"
 
+// BTree — B+ дерево с копированием при записи. Опубликованные снимки (Snapshot)
+// неизменяемы, поэтому их можно читать без блокировок, пока писатель меняет дерево
 type BTree struct {
 	root  *Node
 	order int
+	owner *owner
+	kind  KeyKind
 }
 
+// owner помечает узлы, которые писатель ещё не публиковал и может менять на месте
+type owner struct{ _ byte }
+
 // NewBPlusTree создаёт новый b+ tree с указанным order
 func NewBPlusTree(order int) *BTree {
+	o := &owner{}
 	return &BTree{
 		root: &Node{
 			isLeaf: true,
 			keys:   []Key{},
 			values: [][]Value{},
+			owner:  o,
 		},
 		order: order,
+		owner: o,
+	}
+}
+
+// Snapshot возвращает неизменяемую версию дерева. Следующие записи
+// в tree копируют затронутые узлы и не видны в снимке
+func (tree *BTree) Snapshot() *BTree {
+	snap := &BTree{root: tree.root, order: tree.order, owner: &owner{}, kind: tree.kind}
+	tree.owner = &owner{}
+	return snap
+}
+
+// mutable возвращает узел, который можно менять: свой или его копию
+func (tree *BTree) mutable(n *Node) *Node {
+	if n.owner == tree.owner {
+		return n
 	}
+	return n.clone(tree.owner)
+}
+
+// pathStep — внутренний узел на пути к листу и индекс выбранного ребёнка
+type pathStep struct {
+	node  *Node
+	child int
+}
+
+// mutablePath копирует путь от корня до листа для key и возвращает его
+func (tree *BTree) mutablePath(key Key) ([]pathStep, *Node) {
+	tree.root = tree.mutable(tree.root)
+
+	var path []pathStep
+	node := tree.root
+	for !node.isLeaf {
+		i := childIndex(node, key)
+		child := tree.mutable(node.children[i])
+		node.children[i] = child
+		path = append(path, pathStep{node: node, child: i})
+		node = child
+	}
+	return path, node
+}
+
+// childIndex — в какое поддерево идти за ключом: вправо или влево по разделению
+func childIndex(node *Node, key Key) int {
+	for i, k := range node.keys {
+		if bytes.Compare(key, k) < 0 {
+			return i
+		}
+	}
+	return len(node.children) - 1
 }
 
 // Insert вставляет ключ и значение в дерево
 func (tree *BTree) Insert(key Key, value Value) {
-
 	if tree.root == nil {
-		NewBPlusTree(tree.order).Insert(key, value)
+		*tree = *NewBPlusTree(tree.order)
 	}
 
-	// поиск листа в дереве для вставки ключа
-	leaf := tree.findLeaf(tree.root, key)
-
-	// вставляем ключ и значение в лист
+	// копируем путь до листа и вставляем ключ и значение в лист
+	path, leaf := tree.mutablePath(key)
 	tree.insertInLeaf(leaf, key, value)
 
 	// если лист переполнен, разделим его
 	if len(leaf.keys) > tree.order*2-1 {
-		tree.splitLeaf(leaf)
+		tree.splitLeaf(path, leaf)
 	}
 }
 
 // findLeaf возвращает лист для заданного ключа
 func (tree *BTree) findLeaf(node *Node, key Key) *Node {
-	if node.isLeaf {
-		return node
-	}
-
-	// смотрим куда идем: вправо или влево по разделению
-	for i, k := range node.keys {
-		if bytes.Compare(key, k) < 0 {
-			return tree.findLeaf(node.children[i], key)
-		}
+	for !node.isLeaf {
+		node = node.children[childIndex(node, key)]
 	}
-
-	return tree.findLeaf(node.children[len(node.children)-1], key)
+	return node
 }
 
 // insertInLeaf вставляет ключ и значение в лист
@@ -76,8 +123,8 @@ func (tree *BTree) insertInLeaf(leaf *Node, key Key, value Value) {
 	leaf.values[pos] = []Value{value}
 }
 
-// splitLeaf разделяет лист и добавляет новый лист в связный список
-func (tree *BTree) splitLeaf(leaf *Node) {
+// splitLeaf разделяет лист, вторая половина уходит в новый лист
+func (tree *BTree) splitLeaf(path []pathStep, leaf *Node) {
 	mid := len(leaf.keys) / 2
 
 	// создаем новый лист где пойдет вторая половина ключей и значений
@@ -85,40 +132,33 @@ func (tree *BTree) splitLeaf(leaf *Node) {
 		isLeaf: true,
 		keys:   append([]Key{}, leaf.keys[mid:]...),
 		values: append([][]Value{}, leaf.values[mid:]...),
-		next:   leaf.next,
-		parent: leaf.parent,
+		owner:  tree.owner,
 	}
 
-	leaf.keys = leaf.keys[:mid]
-	leaf.values = leaf.values[:mid]
-	leaf.next = newLeaf
+	leaf.keys = leaf.keys[:mid:mid]
+	leaf.values = leaf.values[:mid:mid]
 
 	// после того как мы сплитнули лист, нужно поднимать ключ в родителя
 	// потом он должен знать о новом листе
-	tree.insertInParent(leaf, newLeaf.keys[0], newLeaf)
+	tree.insertInParent(path, leaf, newLeaf.keys[0], newLeaf)
 }
 
 // insertInParent поднимает ключ в родителя после сплита
 // надо чтобы родитель знал когда идти в правое, а когда в левое поддерево
-func (tree *BTree) insertInParent(left *Node, key Key, right *Node) {
-	if left.parent == nil {
-		newRoot := &Node{
+func (tree *BTree) insertInParent(path []pathStep, left *Node, key Key, right *Node) {
+	if len(path) == 0 {
+		tree.root = &Node{
 			isLeaf:   false,
 			keys:     []Key{key},
 			children: []*Node{left, right},
+			owner:    tree.owner,
 		}
-		left.parent = newRoot
-		right.parent = newRoot
-		tree.root = newRoot
 		return
 	}
 
-	parent := left.parent
-
-	pos := 0
-	for pos < len(parent.keys) && bytes.Compare(parent.keys[pos], key) < 0 {
-		pos++
-	}
+	// родитель уже скопирован в mutablePath, left — его ребёнок под номером pos
+	step := path[len(path)-1]
+	parent, pos := step.node, step.child
 
 	parent.keys = append(parent.keys, nil)
 	copy(parent.keys[pos+1:], parent.keys[pos:])
@@ -127,16 +167,15 @@ func (tree *BTree) insertInParent(left *Node, key Key, right *Node) {
 	parent.children = append(parent.children, nil)
 	copy(parent.children[pos+2:], parent.children[pos+1:])
 	parent.children[pos+1] = right
-	right.parent = parent
 
 	// если родитель переполнен, то сплитим родителя
 	if len(parent.keys) > tree.order*2-1 {
-		tree.splitInternal(parent)
+		tree.splitInternal(path[:len(path)-1], parent)
 	}
 }
 
 // splitInternal разделяет внутренний узел и поднимает ключ в родителя
-func (tree *BTree) splitInternal(node *Node) {
+func (tree *BTree) splitInternal(path []pathStep, node *Node) {
 	mid := len(node.keys) / 2
 	keyToPushUp := node.keys[mid]
 
@@ -144,18 +183,14 @@ func (tree *BTree) splitInternal(node *Node) {
 		isLeaf:   false,
 		keys:     append([]Key{}, node.keys[mid+1:]...),
 		children: append([]*Node{}, node.children[mid+1:]...),
-		parent:   node.parent,
+		owner:    tree.owner,
 	}
 
-	for _, child := range newNode.children {
-		child.parent = newNode
-	}
-
-	node.keys = node.keys[:mid]
-	node.children = node.children[:mid+1]
+	node.keys = node.keys[:mid:mid]
+	node.children = node.children[: mid+1 : mid+1]
 
 	// поднимаем ключ в родителя
-	tree.insertInParent(node, keyToPushUp, newNode)
+	tree.insertInParent(path, node, keyToPushUp, newNode)
 }
 
 // Delete удаляет значение из дерева по ключу
@@ -164,48 +199,46 @@ func (tree *BTree) Delete(key Key, value Value) bool {
 		return false
 	}
 
-	leaf := tree.findLeaf(tree.root, key)
-	return tree.deleteFromLeaf(leaf, key, value)
+	// путь копируется, только если значение действительно есть в дереве
+	pos, valuePos := findValue(tree.findLeaf(tree.root, key), key, value)
+	if pos == -1 || valuePos == -1 {
+		return false
+	}
+
+	_, leaf := tree.mutablePath(key)
+	tree.deleteFromLeaf(leaf, pos, valuePos)
+	return true
 }
 
-// deleteFromLeaf удаляет конкретное значение из листа
-func (tree *BTree) deleteFromLeaf(leaf *Node, key Key, value Value) bool {
-	// Находим позицию ключа
-	pos := -1
+// findValue возвращает позицию ключа в листе и значения в его списке, -1 если нет
+func findValue(leaf *Node, key Key, value Value) (int, int) {
 	for i, k := range leaf.keys {
-		if bytes.Equal(k, key) {
-			pos = i
-			break
+		if !bytes.Equal(k, key) {
+			continue
 		}
-	}
-
-	if pos == -1 {
-		return false // ключ не найден
-	}
-
-	// Удаляем конкретное значение из массива значений
-	valuePos := -1
-	for i, v := range leaf.values[pos] {
-		if bytes.Equal(v, value) {
-			valuePos = i
-			break
+		for j, v := range leaf.values[i] {
+			if bytes.Equal(v, value) {
+				return i, j
+			}
 		}
+		return i, -1
 	}
+	return -1, -1
+}
 
-	if valuePos == -1 {
-		return false // значение не найдено
-	}
-
-	// Удаляем значение
-	leaf.values[pos] = append(leaf.values[pos][:valuePos], leaf.values[pos][valuePos+1:]...)
+// deleteFromLeaf удаляет конкретное значение из листа
+func (tree *BTree) deleteFromLeaf(leaf *Node, pos, valuePos int) {
+	// список значений может разделяться со снимком, поэтому собираем новый
+	old := leaf.values[pos]
+	values := make([]Value, 0, len(old)-1)
+	values = append(values, old[:valuePos]...)
+	leaf.values[pos] = append(values, old[valuePos+1:]...)
 
 	// Если значений больше нет для этого ключа, удаляем ключ
 	if len(leaf.values[pos]) == 0 {
 		leaf.keys = append(leaf.keys[:pos], leaf.keys[pos+1:]...)
 		leaf.values = append(leaf.values[:pos], leaf.values[pos+1:]...)
 	}
-
-	return true
 }
 
 // GetRoot возвращает корень дерева
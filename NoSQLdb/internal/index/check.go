@@ -0,0 +1,94 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Check проверяет структуру дерева и возвращает нарушения, не больше limit:
+// ключи узла строго возрастают, ключи поддерева лежат между разделителями
+// родителя, все листья на одной глубине, у внутреннего узла детей на один
+// больше, чем ключей, у каждого ключа листа есть значения.
+// Связного списка листьев нет (см. ascendLeaves), поэтому порядок листьев
+// проверяется границами поддеревьев
+func (tree *BTree) Check(limit int) []string {
+	if tree.root == nil {
+		return []string{"tree has no root"}
+	}
+	c := checker{limit: limit, leafDepth: -1}
+	c.node(tree.root, nil, nil, 0)
+	return c.problems
+}
+
+type checker struct {
+	problems  []string
+	limit     int
+	leafDepth int
+}
+
+func (c *checker) add(format string, args ...any) {
+	if len(c.problems) < c.limit {
+		c.problems = append(c.problems, fmt.Sprintf(format, args...))
+	}
+}
+
+// node проверяет поддерево, ключи которого должны лежать в [low, high); nil — без границы
+func (c *checker) node(n *Node, low, high Key, depth int) {
+	for i, k := range n.keys {
+		if i > 0 && bytes.Compare(n.keys[i-1], k) >= 0 {
+			c.add("depth %d: keys out of order at position %d", depth, i)
+		}
+		if (low != nil && bytes.Compare(k, low) < 0) || (high != nil && bytes.Compare(k, high) >= 0) {
+			c.add("depth %d: key %x outside parent bounds", depth, k)
+		}
+	}
+
+	if n.isLeaf {
+		if c.leafDepth == -1 {
+			c.leafDepth = depth
+		} else if depth != c.leafDepth {
+			c.add("leaf at depth %d, other leaves at depth %d", depth, c.leafDepth)
+		}
+		if len(n.values) != len(n.keys) {
+			c.add("depth %d: leaf has %d keys and %d value lists", depth, len(n.keys), len(n.values))
+			return
+		}
+		for i, values := range n.values {
+			if len(values) == 0 {
+				c.add("depth %d: key %x has no values", depth, n.keys[i])
+			}
+		}
+		return
+	}
+
+	if len(n.children) != len(n.keys)+1 {
+		c.add("depth %d: internal node has %d keys and %d children", depth, len(n.keys), len(n.children))
+		return
+	}
+	for i, child := range n.children {
+		lo, hi := low, high
+		if i > 0 {
+			lo = n.keys[i-1]
+		}
+		if i < len(n.keys) {
+			hi = n.keys[i]
+		}
+		c.node(child, lo, hi, depth+1)
+	}
+}
+
+// Ascend вызывает fn для каждого ключа и его значений по возрастанию ключей.
+// fn возвращает false, чтобы остановиться
+func (tree *BTree) Ascend(fn func(key Key, values []Value) bool) {
+	if tree.root == nil {
+		return
+	}
+	tree.ascendLeaves(tree.root, nil, func(leaf *Node) bool {
+		for i, key := range leaf.keys {
+			if i >= len(leaf.values) || !fn(key, leaf.values[i]) {
+				return false
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,71 @@
+package index
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// KeyKind — как значения поля превращаются в ключи дерева
+type KeyKind string
+
+const (
+	KeyValue KeyKind = ""   // ValueToKey
+	KeyIP    KeyKind = "ip" // IP-адреса по числовому значению, остальное — ValueToKey
+)
+
+// ParseKeyKind проверяет тип индекса из запроса
+func ParseKeyKind(name string) (KeyKind, error) {
+	switch kind := KeyKind(name); kind {
+	case KeyValue, KeyIP:
+		return kind, nil
+	default:
+		return "", fmt.Errorf("unknown index type '%s', expected 'ip'", name)
+	}
+}
+
+// ipKeyTag отделяет ключи адресов от ключей прочих значений в ip-индексе
+const ipKeyTag = 0x00
+
+// IPKey — ключ адреса: метка и 16 байт адреса, IPv4 как ::ffff:a.b.c.d.
+// Побайтный порядок ключей совпадает с числовым порядком адресов
+func IPKey(addr netip.Addr) Key {
+	a16 := addr.As16()
+	return append(Key{ipKeyTag}, a16[:]...)
+}
+
+// IPRangeKeys — ключи первого и последнего адреса сети, для обхода с обеими границами
+func IPRangeKeys(prefix netip.Prefix) (Key, Key) {
+	prefix = prefix.Masked()
+	first := prefix.Addr().As16()
+	last := first
+	bits := prefix.Bits()
+	if prefix.Addr().Is4() {
+		bits += 96 // сеть IPv4 лежит в ::ffff:0:0/96
+	}
+	for i := bits; i < 128; i++ {
+		last[i/8] |= 1 << (7 - i%8)
+	}
+	return append(Key{ipKeyTag}, first[:]...), append(Key{ipKeyTag}, last[:]...)
+}
+
+// Kind — тип ключей дерева
+func (tree *BTree) Kind() KeyKind {
+	return tree.kind
+}
+
+// SetKind задаёт тип ключей; вызывается до вставки первых значений
+func (tree *BTree) SetKind(kind KeyKind) {
+	tree.kind = kind
+}
+
+// Key переводит значение поля в ключ по типу дерева
+func (tree *BTree) Key(value any) Key {
+	if tree.kind == KeyIP {
+		if s, ok := value.(string); ok {
+			if addr, err := netip.ParseAddr(s); err == nil {
+				return IPKey(addr.WithZone(""))
+			}
+		}
+	}
+	return ValueToKey(value)
+}
@@ -9,8 +9,9 @@ type Node struct {
 	keys     []Key
 	values   [][]Value
 	children []*Node
-	next     *Node
-	parent   *Node
+	// owner — дерево-писатель, которому узел принадлежит до публикации снимка.
+	// Чужие узлы не меняются, а копируются (copy-on-write)
+	owner *owner
 }
 
 // NewNode создаёт новый узел
@@ -43,16 +44,6 @@ func (n *Node) GetChildren() []*Node {
 	return n.children
 }
 
-// GetNext возвращает указатель на следующий лист
-func (n *Node) GetNext() *Node {
-	return n.next
-}
-
-// GetParent возвращает родителя узла
-func (n *Node) GetParent() *Node {
-	return n.parent
-}
-
 // AddKey добавляет ключ в узел
 func (n *Node) AddKey(key Key) {
 	n.keys = append(n.keys, key)
@@ -68,12 +59,21 @@ func (n *Node) AddChild(child *Node) {
 	n.children = append(n.children, child)
 }
 
-// SetNext устанавливает next для узла
-func (n *Node) SetNext(next *Node) {
-	n.next = next
-}
-
-// SetParent устанавливает parent для узла
-func (n *Node) SetParent(parent *Node) {
-	n.parent = parent
+// clone копирует узел для нового владельца. Срезы значений обрезаются по длине,
+// чтобы append в копии не писал в общий с опубликованным узлом массив
+func (n *Node) clone(o *owner) *Node {
+	c := &Node{
+		isLeaf: n.isLeaf,
+		keys:   append(make([]Key, 0, len(n.keys)+1), n.keys...),
+		owner:  o,
+	}
+	if n.isLeaf {
+		c.values = make([][]Value, len(n.values), len(n.values)+1)
+		for i, vals := range n.values {
+			c.values[i] = vals[:len(vals):len(vals)]
+		}
+	} else {
+		c.children = append(make([]*Node, 0, len(n.children)+1), n.children...)
+	}
+	return c
 }
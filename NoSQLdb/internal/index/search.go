@@ -1,6 +1,9 @@
 package index
 
-import "bytes"
+import (
+	"bytes"
+	"context"
+)
 
 // Search выполняет точечный поиск по ключу ($eq)
 func (tree *BTree) Search(key Key) []Value {
@@ -22,21 +25,37 @@ func (tree *BTree) Search(key Key) []Value {
 
 // RangeSearch выполняет диапазонный поиск ($gt, $lt, $gte, $lte)
 func (tree *BTree) RangeSearch(start, end Key, includeStart, includeEnd bool) []Value {
-	if tree.root == nil {
-		return nil
-	}
+	result, _ := tree.RangeSearchContext(context.Background(), start, end, includeStart, includeEnd)
+	return result
+}
 
+// RangeSearchContext — RangeSearch, который проверяет ctx на каждом листе
+// и прерывает обход при отмене запроса
+func (tree *BTree) RangeSearchContext(ctx context.Context, start, end Key, includeStart, includeEnd bool) ([]Value, error) {
 	var result []Value
+	err := tree.AscendRange(ctx, start, end, includeStart, includeEnd, func(v Value) bool {
+		result = append(result, v)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
 
-	var startLeaf *Node
-	if start == nil {
-		startLeaf = tree.findLeftmostLeaf(tree.root)
-	} else {
-		startLeaf = tree.findLeaf(tree.root, start)
+// AscendRange вызывает fn для значений диапазона по возрастанию ключей,
+// fn возвращает false, чтобы остановиться. nil в start или end — без границы
+func (tree *BTree) AscendRange(ctx context.Context, start, end Key, includeStart, includeEnd bool, fn func(Value) bool) error {
+	if tree.root == nil {
+		return nil
 	}
 
-	// проходим по всем листьям через связанный список
-	for leaf := startLeaf; leaf != nil; leaf = leaf.next {
+	var err error
+	// обходим листья слева направо, начиная с листа для start
+	tree.ascendLeaves(tree.root, start, func(leaf *Node) bool {
+		if err = ctx.Err(); err != nil {
+			return false
+		}
 		for i, k := range leaf.keys {
 			if start != nil {
 				cmp := bytes.Compare(k, start)
@@ -48,24 +67,71 @@ func (tree *BTree) RangeSearch(start, end Key, includeStart, includeEnd bool) []
 			if end != nil {
 				cmp := bytes.Compare(k, end)
 				if cmp > 0 || (cmp == 0 && !includeEnd) {
-					return result
+					return false
 				}
 			}
 
-			// добавляем все значения для этого ключа
-			result = append(result, leaf.values[i]...)
+			for _, v := range leaf.values[i] {
+				if !fn(v) {
+					return false
+				}
+			}
 		}
+		return true
+	})
+	return err
+}
 
-		// если достигли конца диапазона, выходим
-		if end != nil && len(leaf.keys) > 0 {
-			lastKey := leaf.keys[len(leaf.keys)-1]
-			if bytes.Compare(lastKey, end) >= 0 {
-				break
-			}
+// ascendLeaves вызывает fn для листьев по порядку ключей, начиная с листа для from
+// (nil — с самого левого). Связного списка листьев нет: он несовместим
+// с копированием узлов, поэтому обход идёт по дереву
+func (tree *BTree) ascendLeaves(node *Node, from Key, fn func(leaf *Node) bool) bool {
+	if node.isLeaf {
+		return fn(node)
+	}
+	first := 0
+	if from != nil {
+		first = childIndex(node, from)
+	}
+	for i := first; i < len(node.children); i++ {
+		// граница нужна только для первого поддерева, правее все ключи больше
+		bound := from
+		if i > first {
+			bound = nil
+		}
+		if !tree.ascendLeaves(node.children[i], bound, fn) {
+			return false
 		}
 	}
+	return true
+}
 
-	return result
+// Descend вызывает fn для всех значений по убыванию ключей, значения одного
+// ключа — в обратном порядке вставки. fn возвращает false, чтобы остановиться
+func (tree *BTree) Descend(fn func(Value) bool) {
+	if tree.root != nil {
+		tree.descend(tree.root, fn)
+	}
+}
+
+func (tree *BTree) descend(node *Node, fn func(Value) bool) bool {
+	if !node.isLeaf {
+		for i := len(node.children) - 1; i >= 0; i-- {
+			if !tree.descend(node.children[i], fn) {
+				return false
+			}
+		}
+		return true
+	}
+	for i := len(node.keys) - 1; i >= 0; i-- {
+		values := node.values[i]
+		for j := len(values) - 1; j >= 0; j-- {
+			if !fn(values[j]) {
+				return false
+			}
+		}
+	}
+	return true
 }
 
 // SearchGreaterThan ищет все значения где ключ > key ($gt)
@@ -103,23 +169,6 @@ func (tree *BTree) SearchIn(keys []Key) []Value {
 	return result
 }
 
-// findLeftmostLeaf находит самый левый лист дерева
-func (tree *BTree) findLeftmostLeaf(node *Node) *Node {
-	if node == nil {
-		return nil
-	}
-
-	for !node.isLeaf {
-		if len(node.children) > 0 {
-			node = node.children[0]
-		} else {
-			break
-		}
-	}
-
-	return node
-}
-
 // GetAllValues возвращает все значения из дерева (для full scan)
 func (tree *BTree) GetAllValues() []Value {
 	if tree.root == nil {
@@ -127,14 +176,12 @@ func (tree *BTree) GetAllValues() []Value {
 	}
 
 	var result []Value
-	leaf := tree.findLeftmostLeaf(tree.root)
-
-	for leaf != nil {
+	tree.ascendLeaves(tree.root, nil, func(leaf *Node) bool {
 		for _, values := range leaf.values {
 			result = append(result, values...)
 		}
-		leaf = leaf.next
-	}
+		return true
+	})
 
 	return result
 }
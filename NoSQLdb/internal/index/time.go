@@ -0,0 +1,41 @@
+package index
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// KeyVersion — версия кодирования ключей. Индексы, записанные прежней
+// версией, перестраиваются при загрузке
+//
+//	1 — метки времени RFC3339 кодируются по моменту в UTC, числа — с сохранением
+//	    порядка, отрицательные раньше положительных
+const KeyVersion = 1
+
+// timeKeyTag отделяет ключи меток времени от ключей обычных строк
+const timeKeyTag = 0x01
+
+// TimeKey — ключ метки времени: метка, секунды со сдвигом знака и наносекунды.
+// Побайтный порядок ключей совпадает с хронологическим
+func TimeKey(t time.Time) Key {
+	buf := make([]byte, 13)
+	buf[0] = timeKeyTag
+	binary.BigEndian.PutUint64(buf[1:9], uint64(t.Unix())^(1<<63))
+	binary.BigEndian.PutUint32(buf[9:], uint32(t.Nanosecond()))
+	return buf
+}
+
+// ParseTimestamp узнаёт строку RFC3339. Это единственное определение метки
+// времени: по нему строятся ключи индекса и сравнивает operators.ParseTime,
+// поэтому дата без времени (2024-06-01) — обычная строка и там, и там
+func ParseTimestamp(s string) (time.Time, bool) {
+	// быстрая проверка, чтобы не разбирать каждую строку: YYYY-MM-DDThh:mm:ss...
+	if len(s) < 20 || s[4] != '-' || s[7] != '-' || (s[10] != 'T' && s[10] != 't') {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
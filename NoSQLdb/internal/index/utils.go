@@ -10,29 +10,21 @@ import (
 func ValueToKey(value any) Key {
 	switch v := value.(type) {
 	case int:
-		buf := make([]byte, 8)
-		binary.BigEndian.PutUint64(buf, uint64(v))
-		return buf
+		return intKey(int64(v))
 	case int32:
-		buf := make([]byte, 8)
-		binary.BigEndian.PutUint64(buf, uint64(v))
-		return buf
+		return intKey(int64(v))
 	case int64:
-		buf := make([]byte, 8)
-		binary.BigEndian.PutUint64(buf, uint64(v))
-		return buf
+		return intKey(v)
 	case float32:
 		// json числа чаще float64
-		buf := make([]byte, 8)
-		binary.BigEndian.PutUint64(buf, math.Float64bits(float64(v)))
-		return buf
+		return floatKey(float64(v))
 	case float64:
-		// для сортировок float используем побитовое представление
-		buf := make([]byte, 8)
-		binary.BigEndian.PutUint64(buf, math.Float64bits(v))
-		return buf
+		return floatKey(v)
 	case string:
-		// строки просто конвертируем в []byte
+		// метки времени RFC3339 — по моменту в UTC, остальные строки как есть
+		if t, ok := ParseTimestamp(v); ok {
+			return TimeKey(t)
+		}
 		return []byte(v)
 	case bool:
 		if v {
@@ -44,6 +36,30 @@ func ValueToKey(value any) Key {
 	}
 }
 
+// intKey — ключ целого числа со сдвигом знака: отрицательные идут раньше положительных
+func intKey(v int64) Key {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(v)^(1<<63))
+	return buf
+}
+
+// floatKey — ключ числа, побайтный порядок которого совпадает с числовым:
+// у положительных ставится знаковый бит, у отрицательных инвертируются все биты
+func floatKey(v float64) Key {
+	if v == 0 {
+		v = 0 // -0 и 0 — один ключ
+	}
+	bits := math.Float64bits(v)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, bits)
+	return buf
+}
+
 // ValuesToStrings конвертирует массив value ([]byte) в массив строк (ids)
 func ValuesToStrings(values []Value) []string {
 	result := make([]string, len(values))
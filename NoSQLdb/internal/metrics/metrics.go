@@ -0,0 +1,314 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets — границы гистограмм длительности в секундах
+var DefaultBuckets = []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector — метрика, умеющая записать себя в текстовом формате Prometheus
+type collector interface {
+	write(w io.Writer)
+}
+
+// Registry хранит метрики и отдаёт их по http
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// Default — реестр, в котором регистрируются все метрики сервера
+var Default = &Registry{}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteText пишет все метрики в текстовом формате экспозиции Prometheus
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// Handler возвращает http-обработчик для /metrics
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Default.WriteText(w)
+	})
+}
+
+// desc — имя, описание и метки метрики
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d *desc) header(w io.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, typ)
+}
+
+func (d *desc) checkLabels(values []string) {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s: expected %d label values, got %d", d.name, len(d.labels), len(values)))
+	}
+}
+
+// seriesKey склеивает значения меток в ключ карты
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels формирует {a="1",b="2"} с экранированием значений
+func formatLabels(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(names)+len(extra)/2)
+	for i, name := range names {
+		parts = append(parts, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, extra[i]+`="`+labelEscaper.Replace(extra[i+1])+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// series — значения одной комбинации меток
+type series struct {
+	labels []string
+	value  float64
+}
+
+// vec — общая часть счётчиков и gauge с метками
+type vec struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func (v *vec) add(delta float64, values []string) {
+	v.checkLabels(values)
+	key := seriesKey(values)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	s.value += delta
+}
+
+func (v *vec) set(value float64, values []string) {
+	v.checkLabels(values)
+	key := seriesKey(values)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		v.series[key] = s
+	}
+	s.value = value
+}
+
+func (v *vec) writeSeries(w io.Writer, typ string) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	v.header(w, typ)
+	for _, k := range keys {
+		s := v.series[k]
+		fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, s.labels), formatValue(s.value))
+	}
+	v.mu.Unlock()
+}
+
+// CounterVec — монотонный счётчик с метками
+type CounterVec struct {
+	vec
+}
+
+// NewCounterVec создаёт счётчик и регистрирует его в Default
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec{desc: desc{name, help, labels}, series: make(map[string]*series)}}
+	Default.register(c)
+	return c
+}
+
+// Inc увеличивает счётчик на 1
+func (c *CounterVec) Inc(values ...string) {
+	c.add(1, values)
+}
+
+// Add увеличивает счётчик на delta
+func (c *CounterVec) Add(delta float64, values ...string) {
+	c.add(delta, values)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.writeSeries(w, "counter")
+}
+
+// GaugeVec — значение с метками, которое может расти и уменьшаться
+type GaugeVec struct {
+	vec
+}
+
+// NewGaugeVec создаёт gauge и регистрирует его в Default
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{vec{desc: desc{name, help, labels}, series: make(map[string]*series)}}
+	Default.register(g)
+	return g
+}
+
+// Set устанавливает значение
+func (g *GaugeVec) Set(value float64, values ...string) {
+	g.set(value, values)
+}
+
+// Add прибавляет delta (может быть отрицательной)
+func (g *GaugeVec) Add(delta float64, values ...string) {
+	g.add(delta, values)
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.writeSeries(w, "gauge")
+}
+
+// Sample — значение gauge, вычисленное в момент сбора
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// GaugeFunc — gauge, значения которого вычисляются функцией при каждом сборе
+type GaugeFunc struct {
+	desc
+	collect func() []Sample
+}
+
+// NewGaugeFunc регистрирует вычисляемый gauge в Default
+func NewGaugeFunc(name, help string, labels []string, collect func() []Sample) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{name, help, labels}, collect: collect}
+	Default.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	samples := g.collect()
+	sort.Slice(samples, func(i, j int) bool {
+		return seriesKey(samples[i].Labels) < seriesKey(samples[j].Labels)
+	})
+
+	g.header(w, "gauge")
+	for _, s := range samples {
+		g.checkLabels(s.Labels)
+		fmt.Fprintf(w, "%s%s %s\n", g.name, formatLabels(g.labels, s.Labels), formatValue(s.Value))
+	}
+}
+
+// histogramSeries — накопленные значения одной комбинации меток
+type histogramSeries struct {
+	labels []string
+	counts []uint64 // по бакетам, не накопительно
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec — гистограмма с метками
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+// NewHistogramVec создаёт гистограмму и регистрирует её в Default
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		desc:    desc{name, help, labels},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	Default.register(h)
+	return h
+}
+
+// Observe добавляет наблюдение
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	h.checkLabels(values)
+	key := seriesKey(values)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			labels: append([]string(nil), values...),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h.header(w, "histogram")
+	for _, k := range keys {
+		s := h.series[k]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, s.labels, "le", formatValue(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, s.labels), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, s.labels), s.count)
+	}
+}
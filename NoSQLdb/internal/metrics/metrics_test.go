@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterAndGaugeText(t *testing.T) {
+	c := NewCounterVec("test_requests_total", "Requests.", "op", "status")
+	c.Inc("find", "success")
+	c.Add(2, "find", "success")
+	c.Inc("insert", `bad "quote"`)
+
+	var buf bytes.Buffer
+	c.write(&buf)
+	want := `# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{op="find",status="success"} 3
+test_requests_total{op="insert",status="bad \"quote\""} 1
+`
+	if buf.String() != want {
+		t.Fatalf("counter text:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	g := NewGaugeVec("test_depth", "Depth.")
+	g.Set(5)
+	g.Add(-2)
+	buf.Reset()
+	g.write(&buf)
+	if !strings.HasSuffix(buf.String(), "# TYPE test_depth gauge\ntest_depth 3\n") {
+		t.Fatalf("gauge text:\n%s", buf.String())
+	}
+}
+
+func TestGaugeFuncCollectsOnWrite(t *testing.T) {
+	n := 1.0
+	g := NewGaugeFunc("test_documents", "Documents.", []string{"collection"}, func() []Sample {
+		return []Sample{{Labels: []string{"users"}, Value: n}, {Labels: []string{"events"}, Value: 2 * n}}
+	})
+	n = 10
+
+	var buf bytes.Buffer
+	g.write(&buf)
+	// значения берутся в момент сбора и сортируются по меткам
+	if !strings.HasSuffix(buf.String(), "test_documents{collection=\"events\"} 20\ntest_documents{collection=\"users\"} 10\n") {
+		t.Fatalf("gauge func text:\n%s", buf.String())
+	}
+}
+
+func TestHistogramBucketsAreCumulative(t *testing.T) {
+	h := NewHistogramVec("test_duration_seconds", "Duration.", []float64{0.1, 1}, "op")
+	h.Observe(0.05, "find")
+	h.Observe(0.1, "find")
+	h.Observe(0.5, "find")
+	h.Observe(3, "find")
+
+	var buf bytes.Buffer
+	h.write(&buf)
+	want := `# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{op="find",le="0.1"} 2
+test_duration_seconds_bucket{op="find",le="1"} 3
+test_duration_seconds_bucket{op="find",le="+Inf"} 4
+test_duration_seconds_sum{op="find"} 3.65
+test_duration_seconds_count{op="find"} 4
+`
+	if buf.String() != want {
+		t.Fatalf("histogram text:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestHandlerServesDefaultRegistry(t *testing.T) {
+	NewCounterVec("test_handler_total", "Handler.").Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("content type %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "\ntest_handler_total 1\n") {
+		t.Fatalf("metrics body:\n%s", rec.Body.String())
+	}
+}
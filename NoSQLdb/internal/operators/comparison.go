@@ -5,25 +5,71 @@ import (
 	"reflect"
 )
 
-// CompareEq возвращает true, если fieldValue == queryValue
+// CompareEq возвращает true, если fieldValue == queryValue; метки времени
+// RFC3339 равны, если обозначают один момент, в каком бы поясе ни были записаны
 func CompareEq(fieldValue, queryValue any) bool {
+	if cmp, ok := bothTimes(fieldValue, queryValue); ok {
+		return cmp == 0
+	}
 	return reflect.DeepEqual(fieldValue, queryValue)
 }
 
-// CompareGt возвращает true, если fieldValue > queryValue
+// CompareGt возвращает true, если fieldValue > queryValue; метки времени
+// сравниваются хронологически, IP-адреса — как числа
 func CompareGt(fieldValue, queryValue any) bool {
+	if cmp, ok := bothTimes(fieldValue, queryValue); ok {
+		return cmp > 0
+	}
+	if cmp, ok := bothIPs(fieldValue, queryValue); ok {
+		return cmp > 0
+	}
+	if a, b, ok := bothStrings(fieldValue, queryValue); ok {
+		return a > b
+	}
 	return compareNumeric(fieldValue, queryValue, func(a, b float64) bool {
 		return a > b
 	})
 }
 
-// CompareLt возвращает true, если fieldValue < queryValue
+// CompareLt возвращает true, если fieldValue < queryValue; метки времени
+// сравниваются хронологически, IP-адреса — как числа
 func CompareLt(fieldValue, queryValue any) bool {
+	if cmp, ok := bothTimes(fieldValue, queryValue); ok {
+		return cmp < 0
+	}
+	if cmp, ok := bothIPs(fieldValue, queryValue); ok {
+		return cmp < 0
+	}
+	if a, b, ok := bothStrings(fieldValue, queryValue); ok {
+		return a < b
+	}
 	return compareNumeric(fieldValue, queryValue, func(a, b float64) bool {
 		return a < b
 	})
 }
 
+// bothStrings — обе строки не метки времени и не адреса; такие строки
+// сравниваются побайтно, как ключи индекса (нужно для _id). Метка времени
+// или адрес со строкой другого рода не упорядочены: в индексе их ключи
+// лежат в разных диапазонах, и обход по индексу не совпал бы с полным
+func bothStrings(a, b any) (string, string, bool) {
+	as, ok1 := a.(string)
+	bs, ok2 := b.(string)
+	if !ok1 || !ok2 || !plainString(as) || !plainString(bs) {
+		return "", "", false
+	}
+	return as, bs, true
+}
+
+// plainString — строка не метка времени RFC3339 и не IP-адрес
+func plainString(s string) bool {
+	if _, ok := ParseTime(s); ok {
+		return false
+	}
+	_, ok := ParseIP(s)
+	return !ok
+}
+
 // CompareLike возвращает true, если fieldValue соответствует шаблону like
 func CompareLike(fieldValue, pattern any) bool {
 	fieldStr, ok1 := fieldValue.(string)
@@ -43,7 +89,7 @@ func CompareIn(fieldValue any, values any) bool {
 	}
 
 	for _, v := range valuesSlice {
-		if reflect.DeepEqual(fieldValue, v) {
+		if CompareEq(fieldValue, v) {
 			return true
 		}
 	}
@@ -0,0 +1,144 @@
+package operators
+
+import (
+	"fmt"
+	"nosql_db/internal/index"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateOp — обёртка даты в запросе или документе: {"$date": "2025-01-01T00:00:00Z"},
+// {"$date": "-24h"} (относительно времени сервера) или {"$date": <мс с 1970>}
+const DateOp = "$date"
+
+// ParseTime разбирает строку RFC3339 и приводит время к UTC. Формат тот же,
+// что у ключей индекса: иначе сравнение по индексу и полный обход разойдутся
+func ParseTime(value any) (time.Time, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, ok := index.ParseTimestamp(s)
+	if !ok {
+		return time.Time{}, false
+	}
+	return t.UTC(), true
+}
+
+// bothTimes — оба значения метки времени RFC3339, сравниваются хронологически
+func bothTimes(a, b any) (int, bool) {
+	ta, ok1 := ParseTime(a)
+	tb, ok2 := ParseTime(b)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	return ta.Compare(tb), true
+}
+
+// ResolveDates заменяет обёртки {"$date": ...} на строки RFC3339 в UTC.
+// Относительные даты считаются один раз от now, поэтому весь запрос
+// видит одно и то же «сейчас». Исходная карта не меняется: без обёрток
+// она возвращается как есть, иначе — копия
+func ResolveDates(query map[string]any, now time.Time) (map[string]any, error) {
+	resolved, _, err := resolveValue(query, now)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := resolved.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must wrap a field value", DateOp)
+	}
+	return m, nil
+}
+
+// resolveValue возвращает значение без обёрток дат и признак, что оно изменилось
+func resolveValue(value any, now time.Time) (any, bool, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		if raw, ok := v[DateOp]; ok && len(v) == 1 {
+			t, err := parseDate(raw, now)
+			if err != nil {
+				return nil, false, err
+			}
+			return t.Format(time.RFC3339Nano), true, nil
+		}
+		var out map[string]any
+		for key, item := range v {
+			r, changed, err := resolveValue(item, now)
+			if err != nil {
+				return nil, false, err
+			}
+			if changed && out == nil {
+				out = make(map[string]any, len(v))
+				for k, orig := range v {
+					out[k] = orig
+				}
+			}
+			if out != nil {
+				out[key] = r
+			}
+		}
+		if out == nil {
+			return v, false, nil
+		}
+		return out, true, nil
+	case []any:
+		var out []any
+		for i, item := range v {
+			r, changed, err := resolveValue(item, now)
+			if err != nil {
+				return nil, false, err
+			}
+			if changed && out == nil {
+				out = append([]any(nil), v...)
+			}
+			if out != nil {
+				out[i] = r
+			}
+		}
+		if out == nil {
+			return v, false, nil
+		}
+		return out, true, nil
+	default:
+		return value, false, nil
+	}
+}
+
+// parseDate разбирает значение $date: RFC3339, миллисекунды с 1970,
+// "now", "now-24h", "now+1h" или сокращённо "-24h"; кроме единиц
+// time.ParseDuration понимаются d (сутки) и w (недели)
+func parseDate(raw any, now time.Time) (time.Time, error) {
+	switch v := raw.(type) {
+	case float64:
+		return time.UnixMilli(int64(v)).UTC(), nil
+	case string:
+		if t, ok := ParseTime(v); ok {
+			return t, nil
+		}
+		offset := strings.TrimPrefix(v, "now")
+		if offset == "" {
+			return now.UTC(), nil
+		}
+		if offset[0] == '+' || offset[0] == '-' {
+			if d, err := parseOffset(offset); err == nil {
+				return now.Add(d).UTC(), nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid $date %v: expected RFC3339, milliseconds or now±duration like -24h", raw)
+}
+
+// parseOffset разбирает смещение вида -24h, +90m, -7d, -2w
+func parseOffset(s string) (time.Duration, error) {
+	unit := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}[s[len(s)-1]]
+	if unit == 0 {
+		return time.ParseDuration(s)
+	}
+	n, err := strconv.ParseFloat(s[:len(s)-1], 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(n * float64(unit)), nil
+}
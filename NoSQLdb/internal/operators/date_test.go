@@ -0,0 +1,57 @@
+package operators
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompareTimesAcrossZones(t *testing.T) {
+	// 03:00 в +03:00 — тот же момент, что 00:00 UTC; строками они не равны
+	if !CompareEq("2025-01-01T03:00:00+03:00", "2025-01-01T00:00:00Z") {
+		t.Error("same instant in different zones must be equal")
+	}
+	if !CompareGt("2025-01-01T02:00:00Z", "2025-01-01T04:00:00+03:00") {
+		t.Error("02:00Z is later than 01:00Z written as 04:00+03:00")
+	}
+	if !CompareLt("2024-12-31T23:59:59.5Z", "2025-01-01T00:00:00Z") {
+		t.Error("fractional seconds compared incorrectly")
+	}
+	if !CompareIn("2025-01-01T05:00:00+05:00", []any{"2025-01-01T00:00:00Z"}) {
+		t.Error("$in must compare timestamps as instants")
+	}
+}
+
+func TestResolveDates(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.FixedZone("MSK", 3*3600))
+	query := map[string]any{
+		"timestamp": map[string]any{"$gt": map[string]any{"$date": "-24h"}},
+		"$or": []any{
+			map[string]any{"seen": map[string]any{"$lt": map[string]any{"$date": "now-1w"}}},
+			map[string]any{"at": map[string]any{"$date": 1735689600000.0}},
+		},
+		"host": "web-1",
+	}
+	got, err := ResolveDates(query, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := got["timestamp"].(map[string]any)["$gt"]; v != "2025-05-31T09:00:00Z" {
+		t.Errorf("-24h resolved to %v", v)
+	}
+	or := got["$or"].([]any)
+	if v := or[0].(map[string]any)["seen"].(map[string]any)["$lt"]; v != "2025-05-25T09:00:00Z" {
+		t.Errorf("now-1w resolved to %v", v)
+	}
+	if v := or[1].(map[string]any)["at"]; v != "2025-01-01T00:00:00Z" {
+		t.Errorf("milliseconds resolved to %v", v)
+	}
+	if _, ok := query["timestamp"].(map[string]any)["$gt"].(map[string]any); !ok {
+		t.Error("original query was modified")
+	}
+
+	for _, bad := range []any{"yesterday", "now*2", true} {
+		if _, err := ResolveDates(map[string]any{"ts": map[string]any{"$date": bad}}, now); err == nil {
+			t.Errorf("$date %v accepted", bad)
+		}
+	}
+}
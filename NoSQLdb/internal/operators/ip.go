@@ -0,0 +1,77 @@
+package operators
+
+import (
+	"bytes"
+	"net/netip"
+)
+
+// ParseIP разбирает IPv4 или IPv6 адрес, зона (%eth0) отбрасывается
+func ParseIP(value any) (netip.Addr, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.WithZone(""), true
+}
+
+// ParseCIDRs разбирает сеть или массив сетей для $cidr. Адрес без длины
+// префикса — сеть из одного адреса. false — значение не строка или не сеть
+func ParseCIDRs(value any) ([]netip.Prefix, bool) {
+	items, ok := value.([]any)
+	if !ok {
+		items = []any{value}
+	}
+	prefixes := make([]netip.Prefix, 0, len(items))
+	for _, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, false
+		}
+		if prefix, err := netip.ParsePrefix(s); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, ok := ParseIP(s)
+		if !ok {
+			return nil, false
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, len(prefixes) > 0
+}
+
+// CompareCIDR возвращает true, если fieldValue — адрес из одной из сетей.
+// IPv4, записанный как ::ffff:a.b.c.d, входит в сети IPv4
+func CompareCIDR(fieldValue, cidrs any) bool {
+	addr, ok := ParseIP(fieldValue)
+	if !ok {
+		return false
+	}
+	prefixes, ok := ParseCIDRs(cidrs)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// bothIPs — оба значения адреса; сравниваются по 16 байтам (IPv4 как ::ffff:a.b.c.d),
+// так же, как ключи ip-индекса
+func bothIPs(a, b any) (int, bool) {
+	addrA, ok1 := ParseIP(a)
+	addrB, ok2 := ParseIP(b)
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	a16, b16 := addrA.As16(), addrB.As16()
+	return bytes.Compare(a16[:], b16[:]), true
+}
@@ -0,0 +1,43 @@
+package operators
+
+import "testing"
+
+func TestCompareCIDR(t *testing.T) {
+	cases := []struct {
+		ip    any
+		cidrs any
+		want  bool
+	}{
+		{"10.1.2.3", "10.0.0.0/8", true},
+		{"11.0.0.1", "10.0.0.0/8", false},
+		{"::ffff:10.1.2.3", "10.0.0.0/8", true},
+		{"2001:db8::1", "2001:db8::/32", true},
+		{"2001:db9::1", "2001:db8::/32", false},
+		{"fe80::1%eth0", "fe80::/10", true},
+		{"192.168.1.5", []any{"10.0.0.0/8", "192.168.0.0/16"}, true},
+		{"192.168.1.5", "192.168.1.5", true},
+		{"10.0.0.1", "2001:db8::/32", false},
+		{"not-an-ip", "10.0.0.0/8", false},
+		{42.0, "10.0.0.0/8", false},
+		{"10.0.0.1", "10.0.0.0/33", false},
+		{"10.0.0.1", []any{"10.0.0.0/8", 5.0}, false},
+	}
+	for _, c := range cases {
+		if got := CompareCIDR(c.ip, c.cidrs); got != c.want {
+			t.Errorf("CompareCIDR(%v, %v) = %v, want %v", c.ip, c.cidrs, got, c.want)
+		}
+	}
+}
+
+func TestCompareIPNumerically(t *testing.T) {
+	// строками "9.0.0.1" > "10.0.0.1", как числа — наоборот
+	if !CompareLt("9.0.0.1", "10.0.0.1") || CompareGt("9.0.0.1", "10.0.0.1") {
+		t.Error("IPv4 addresses compared as strings")
+	}
+	if !CompareGt("2001:db8::10", "2001:db8::9") {
+		t.Error("IPv6 addresses compared as strings")
+	}
+	if !CompareLt("b", "c") {
+		t.Error("non-IP strings must still compare bytewise")
+	}
+}
@@ -62,6 +62,8 @@ func applyOperator(fieldValue any, operator string, queryValue any) bool {
 		return CompareLike(fieldValue, queryValue)
 	case "$in":
 		return CompareIn(fieldValue, queryValue)
+	case "$cidr":
+		return CompareCIDR(fieldValue, queryValue)
 	default:
 		fmt.Printf("Warning: unknown operator %s\n", operator)
 		return false
@@ -0,0 +1,195 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"nosql_db/internal/storage"
+	"reflect"
+	"sync/atomic"
+	"time"
+)
+
+// CollectionName — коллекция, в которую пишутся записи профилировщика
+const CollectionName = "system.profile"
+
+const (
+	recordBuffer  = 1024
+	flushInterval = time.Second
+)
+
+// Record — сведения о запросе, выполнявшемся дольше порога
+type Record struct {
+	Timestamp    time.Time      `json:"ts"`
+	Operation    string         `json:"operation"`
+	Collection   string         `json:"collection"`
+	QueryShape   map[string]any `json:"query_shape,omitempty"`
+	IndexUsed    bool           `json:"index_used"`
+	IndexField   string         `json:"index_field,omitempty"`
+	DocsExamined int            `json:"docs_examined"`
+	DocsReturned int            `json:"docs_returned"`
+	ElapsedMS    float64        `json:"elapsed_ms"`
+	Status       string         `json:"status"`
+}
+
+// Options — настройки профилировщика
+type Options struct {
+	Threshold  time.Duration // запросы дольше порога попадают в профиль
+	LogPath    string        // пустой путь — без файла
+	LogMaxSize int64         // размер файла, после которого он ротируется
+	LogBackups int           // сколько старых файлов хранить
+	MaxDocs    int           // максимум записей в system.profile, 0 — без ограничения
+}
+
+// Profiler собирает медленные запросы и пишет их пачками в фоне
+type Profiler struct {
+	opts    Options
+	logFile *rotatingFile
+	records chan Record
+	dropped atomic.Int64
+}
+
+var current atomic.Pointer[Profiler]
+
+// Start включает профилировщик; до вызова Observe ничего не делает
+func Start(opts Options) error {
+	p := &Profiler{
+		opts:    opts,
+		records: make(chan Record, recordBuffer),
+	}
+	if opts.LogPath != "" {
+		f, err := openRotatingFile(opts.LogPath, opts.LogMaxSize, opts.LogBackups)
+		if err != nil {
+			return err
+		}
+		p.logFile = f
+	}
+	if err := capProfile(opts.MaxDocs); err != nil {
+		return err
+	}
+	go p.run()
+	current.Store(p)
+	return nil
+}
+
+// Observe передаёт запрос профилировщику, если он выполнялся дольше порога.
+// Никогда не блокирует: при переполнении буфера запись отбрасывается
+func Observe(rec Record, query map[string]any, elapsed time.Duration) {
+	p := current.Load()
+	if p == nil || elapsed < p.opts.Threshold {
+		return
+	}
+	rec.QueryShape = Shape(query)
+	rec.ElapsedMS = float64(elapsed.Microseconds()) / 1000
+	select {
+	case p.records <- rec:
+	default:
+		if p.dropped.Add(1)%100 == 1 {
+			log.Printf("profiler buffer full, %d record(s) dropped", p.dropped.Load())
+		}
+	}
+}
+
+// capProfile делает system.profile capped-коллекцией на maxDocs записей
+func capProfile(maxDocs int) error {
+	var capped *storage.CappedOptions
+	if maxDocs > 0 {
+		capped = &storage.CappedOptions{MaxDocs: maxDocs}
+	}
+	result := storage.GlobalManager.Enqueue(context.Background(), CollectionName, func(coll *storage.Collection) (storage.WriteResult, error) {
+		if reflect.DeepEqual(coll.Capped(), capped) {
+			return storage.WriteResult{}, nil
+		}
+		_, err := coll.SetCapped(capped)
+		return storage.WriteResult{}, err
+	})
+	if result.Error != nil {
+		return fmt.Errorf("configure %s: %w", CollectionName, result.Error)
+	}
+	return nil
+}
+
+func (p *Profiler) run() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []Record
+	for {
+		select {
+		case rec := <-p.records:
+			batch = append(batch, rec)
+			if len(batch) < recordBuffer {
+				continue
+			}
+		case <-ticker.C:
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		if err := p.flush(batch); err != nil {
+			log.Printf("profiler flush error: %v", err)
+		}
+		batch = nil
+	}
+}
+
+func (p *Profiler) flush(batch []Record) error {
+	docs := make([]map[string]any, 0, len(batch))
+	for _, rec := range batch {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if p.logFile != nil {
+			if _, err := p.logFile.Write(append(line, '\n')); err != nil {
+				return fmt.Errorf("write profile log: %w", err)
+			}
+		}
+		var doc map[string]any
+		if err := json.Unmarshal(line, &doc); err != nil {
+			return err
+		}
+		docs = append(docs, doc)
+	}
+
+	// старые записи вытесняет сама capped-коллекция
+	result := storage.GlobalManager.EnqueueGroup(context.Background(), CollectionName, func(coll *storage.Collection) (storage.WriteResult, error) {
+		_, err := coll.InsertMany(docs, nil)
+		return storage.WriteResult{}, err
+	})
+	return result.Error
+}
+
+// Shape заменяет значения в запросе на "?", оставляя поля и операторы
+func Shape(query map[string]any) map[string]any {
+	if len(query) == 0 {
+		return nil
+	}
+	shape := make(map[string]any, len(query))
+	for key, value := range query {
+		shape[key] = shapeValue(key, value)
+	}
+	return shape
+}
+
+func shapeValue(key string, value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		return Shape(v)
+	case []any:
+		// у $or/$and внутри подзапросы, у остальных — просто список значений
+		if key != "$or" && key != "$and" {
+			return "?"
+		}
+		items := make([]any, 0, len(v))
+		for _, item := range v {
+			if sub, ok := item.(map[string]any); ok {
+				items = append(items, Shape(sub))
+			}
+		}
+		return items
+	default:
+		return "?"
+	}
+}
@@ -0,0 +1,64 @@
+package profiler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShapeHidesValues(t *testing.T) {
+	query := map[string]any{
+		"severity": "high",
+		"age":      map[string]any{"$gt": 30.0, "$lt": 40.0},
+		"host":     map[string]any{"$in": []any{"a", "b"}},
+		"$or": []any{
+			map[string]any{"user": "root"},
+			map[string]any{"port": map[string]any{"$eq": 22.0}},
+		},
+	}
+	want := map[string]any{
+		"severity": "?",
+		"age":      map[string]any{"$gt": "?", "$lt": "?"},
+		"host":     map[string]any{"$in": "?"},
+		"$or": []any{
+			map[string]any{"user": "?"},
+			map[string]any{"port": map[string]any{"$eq": "?"}},
+		},
+	}
+	if got := Shape(query); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Shape = %v, want %v", got, want)
+	}
+	if Shape(nil) != nil || Shape(map[string]any{}) != nil {
+		t.Fatal("empty query has a shape")
+	}
+}
+
+func TestObserveThreshold(t *testing.T) {
+	defer current.Store(nil)
+
+	// выключенный профилировщик ничего не принимает
+	current.Store(nil)
+	Observe(Record{Operation: "find"}, nil, time.Hour)
+
+	p := &Profiler{opts: Options{Threshold: 50 * time.Millisecond}, records: make(chan Record, 2)}
+	current.Store(p)
+	Observe(Record{Operation: "find"}, map[string]any{"a": 1.0}, 10*time.Millisecond)
+	if len(p.records) != 0 {
+		t.Fatal("query faster than the threshold recorded")
+	}
+	Observe(Record{Operation: "find"}, map[string]any{"a": 1.0}, 75*time.Millisecond)
+	if len(p.records) != 1 {
+		t.Fatal("query slower than the threshold not recorded")
+	}
+	rec := <-p.records
+	if rec.ElapsedMS != 75 || !reflect.DeepEqual(rec.QueryShape, map[string]any{"a": "?"}) {
+		t.Fatalf("record %+v", rec)
+	}
+
+	// нулевой порог — все запросы
+	p.opts.Threshold = 0
+	Observe(Record{Operation: "ping"}, nil, 0)
+	if len(p.records) != 1 {
+		t.Fatal("zero threshold skipped a query")
+	}
+}
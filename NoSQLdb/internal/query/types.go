@@ -12,6 +12,7 @@ const (
 	OpLt   Operator = "$lt"
 	OpLike Operator = "$like"
 	OpIn   Operator = "$in"
+	OpCIDR Operator = "$cidr"
 	OpAnd  Operator = "$and"
 	OpOr   Operator = "$or"
 )
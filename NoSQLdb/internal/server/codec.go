@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"nosql_db/pkg/api"
+	"nosql_db/pkg/wire"
+)
+
+// codec — формат сообщений соединения: JSON-поток или кадры MessagePack
+type codec interface {
+	read() (api.Request, error)
+	write(resp api.Response) error
+	// describe — протокол и сжатие для ответа на hello
+	describe() (protocol, compression string)
+	// framed возвращает кадровый кодек, читающий с того же места потока
+	framed(conn net.Conn, compress bool) codec
+}
+
+type jsonCodec struct {
+	decoder *json.Decoder
+	encoder *json.Encoder
+}
+
+func newJSONCodec(conn net.Conn) *jsonCodec {
+	return &jsonCodec{decoder: json.NewDecoder(conn), encoder: json.NewEncoder(conn)}
+}
+
+func (jc *jsonCodec) read() (api.Request, error) {
+	var req api.Request
+	err := jc.decoder.Decode(&req)
+	return req, err
+}
+
+func (jc *jsonCodec) write(resp api.Response) error {
+	return jc.encoder.Encode(resp)
+}
+
+func (jc *jsonCodec) describe() (string, string) {
+	return "json", "none"
+}
+
+func (jc *jsonCodec) framed(conn net.Conn, compress bool) codec {
+	// декодер мог прочитать из сокета больше, чем hello: эти байты — начало кадров
+	r := wire.AfterJSON(io.MultiReader(jc.decoder.Buffered(), conn))
+	return &frameCodec{framer: wire.NewFramer(r, conn), compress: compress}
+}
+
+type frameCodec struct {
+	framer   *wire.Framer
+	compress bool
+}
+
+// read возвращает запрос и при ошибке разбора: в нём может быть request_id
+func (fc *frameCodec) read() (api.Request, error) {
+	payload, err := fc.framer.ReadFrame()
+	if err != nil {
+		return api.Request{}, err
+	}
+	return wire.UnmarshalRequest(payload)
+}
+
+func (fc *frameCodec) write(resp api.Response) error {
+	payload, err := wire.MarshalResponse(resp)
+	if err != nil {
+		return err
+	}
+	return fc.framer.WriteFrame(payload, fc.compress)
+}
+
+func (fc *frameCodec) describe() (string, string) {
+	if fc.compress {
+		return wire.Protocol, wire.CompressionGzip
+	}
+	return wire.Protocol, "none"
+}
+
+func (fc *frameCodec) framed(_ net.Conn, compress bool) codec {
+	return &frameCodec{framer: fc.framer, compress: compress}
+}
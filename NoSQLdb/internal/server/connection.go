@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"nosql_db/pkg/api"
+	"nosql_db/pkg/wire"
+	"sync"
+	"time"
+)
+
+// connection — состояние одного клиентского соединения
+type connection struct {
+	srv        *TCPServer
+	conn       net.Conn
+	clientAddr string
+	timeout    time.Duration
+
+	writeMu sync.Mutex
+	codec   codec
+
+	// concurrent-режим: запросы выполняются параллельно, ответы идут по готовности
+	concurrent  bool
+	maxInFlight int
+	slots       chan struct{}
+	inFlight    sync.WaitGroup
+}
+
+func (s *TCPServer) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	c := &connection{
+		srv:         s,
+		conn:        conn,
+		clientAddr:  conn.RemoteAddr().String(),
+		timeout:     time.Duration(s.Timeout) * time.Second,
+		codec:       newJSONCodec(conn),
+		maxInFlight: max(s.MaxInFlight, 1),
+	}
+	c.slots = make(chan struct{}, c.maxInFlight)
+
+	log.Printf("client connected: %s", c.clientAddr)
+
+	// при закрытии соединения незавершённые запросы отменяются
+	ctx, cancel := context.WithCancel(context.Background())
+	defer c.inFlight.Wait()
+	defer cancel()
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(c.timeout))
+
+		req, err := c.codec.read()
+		if errors.Is(err, wire.ErrMalformed) {
+			// испорчен один кадр, граница следующего известна
+			resp := api.Response{Status: api.StatusError, Message: err.Error(), RequestID: req.RequestID}
+			if !c.send(resp) {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			if err == io.EOF {
+				log.Printf("client disconnected: %s", c.clientAddr)
+			} else {
+				log.Printf("decode error from %s: %v", c.clientAddr, err)
+			}
+			if errors.Is(err, wire.ErrFraming) {
+				c.send(api.Response{Status: api.StatusError, Message: err.Error()})
+			}
+			return
+		}
+
+		if req.Command == api.CmdHello {
+			resp, next := c.hello(req)
+			if !c.send(resp) {
+				return
+			}
+			if next != nil {
+				// ответ на hello ушёл в старом формате, дальше — в новом
+				c.writeMu.Lock()
+				c.codec = next
+				c.writeMu.Unlock()
+			}
+			continue
+		}
+
+		if !c.concurrent {
+			if !c.send(c.process(ctx, req)) {
+				return
+			}
+			continue
+		}
+
+		if req.RequestID == "" {
+			resp := api.Response{Status: api.StatusError, Message: "request_id is required in concurrent mode"}
+			if !c.send(resp) {
+				return
+			}
+			continue
+		}
+
+		// занятый слот ждёт освобождения: клиент не может занять больше maxInFlight воркеров
+		c.slots <- struct{}{}
+		c.inFlight.Add(1)
+		go func() {
+			defer c.inFlight.Done()
+			defer func() { <-c.slots }()
+
+			if !c.send(c.process(ctx, req)) {
+				conn.Close()
+			}
+		}()
+	}
+}
+
+// hello переключает режим соединения и протокол. Новый кодек, если он
+// есть, вступает в силу после отправки ответа
+func (c *connection) hello(req api.Request) (api.Response, codec) {
+	next, err := c.negotiate(req.Query)
+	if err != nil {
+		return api.Response{Status: api.StatusError, Message: err.Error(), RequestID: req.RequestID}, nil
+	}
+
+	concurrent, ok := req.Query["concurrent"].(bool)
+	if ok || next != nil {
+		// дожидаемся ответов на уже запущенные запросы, чтобы не смешать режимы
+		c.inFlight.Wait()
+	}
+	if ok {
+		c.concurrent = concurrent
+	}
+
+	mode := "sequential"
+	if c.concurrent {
+		mode = "concurrent"
+	}
+	current := c.codec
+	if next != nil {
+		current = next
+	}
+	protocol, compression := current.describe()
+	return api.Response{
+		Status:    api.StatusSuccess,
+		Message:   fmt.Sprintf("connection mode: %s", mode),
+		RequestID: req.RequestID,
+		Data: []map[string]any{{
+			"concurrent":    c.concurrent,
+			"max_in_flight": c.maxInFlight,
+			"protocol":      protocol,
+			"compression":   compression,
+		}},
+		Count: 1,
+	}, next
+}
+
+// negotiate разбирает query.protocol и query.compression из hello.
+// nil без ошибки — протокол не меняется
+func (c *connection) negotiate(query map[string]any) (codec, error) {
+	rawProtocol, hasProtocol := query["protocol"]
+	rawCompression, hasCompression := query["compression"]
+	if !hasProtocol && !hasCompression {
+		return nil, nil
+	}
+	protocol, ok := rawProtocol.(string)
+	if hasProtocol && !ok {
+		return nil, fmt.Errorf("protocol must be a string")
+	}
+	compression, ok := rawCompression.(string)
+	if hasCompression && !ok {
+		return nil, fmt.Errorf("compression must be a string")
+	}
+
+	current, _ := c.codec.describe()
+	if protocol == "" {
+		protocol = current
+	}
+	switch protocol {
+	case "json":
+		if current != "json" {
+			return nil, fmt.Errorf("cannot switch back to json on a %s connection", current)
+		}
+		if compression != "" && compression != "none" {
+			return nil, fmt.Errorf("compression requires protocol '%s'", wire.Protocol)
+		}
+		return nil, nil
+	case wire.Protocol:
+	default:
+		return nil, fmt.Errorf("unknown protocol '%s', expected 'json' or '%s'", protocol, wire.Protocol)
+	}
+
+	var compress bool
+	switch compression {
+	case "", "none":
+	case wire.CompressionGzip:
+		compress = true
+	default:
+		return nil, fmt.Errorf("unknown compression '%s', expected 'none' or '%s'", compression, wire.CompressionGzip)
+	}
+	return c.codec.framed(c.conn, compress), nil
+}
+
+// process выполняет запрос; работа не должна переживать дедлайн сокета
+func (c *connection) process(parent context.Context, req api.Request) api.Response {
+	ctx, cancel := context.WithTimeout(parent, c.timeout)
+	defer cancel()
+	return c.srv.execute(ctx, c.clientAddr, req)
+}
+
+// send пишет ответ, запись сериализована между горутинами соединения
+func (c *connection) send(resp api.Response) bool {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	if err := c.codec.write(resp); err != nil {
+		log.Printf("encode error to %s: %v", c.clientAddr, err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
+	"testing"
+	"time"
+)
+
+// testConn — клиентская сторона соединения, обслуживаемого handleConnection
+type testConn struct {
+	t   *testing.T
+	enc *json.Encoder
+	dec *json.Decoder
+}
+
+func dial(t *testing.T, s *TCPServer) *testConn {
+	t.Helper()
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.handleConnection(server)
+	}()
+	t.Cleanup(func() {
+		client.Close()
+		<-done
+	})
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+	return &testConn{t: t, enc: json.NewEncoder(client), dec: json.NewDecoder(client)}
+}
+
+func (c *testConn) send(req api.Request) {
+	c.t.Helper()
+	if err := c.enc.Encode(req); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testConn) recv() api.Response {
+	c.t.Helper()
+	var resp api.Response
+	if err := c.dec.Decode(&resp); err != nil {
+		c.t.Fatal(err)
+	}
+	return resp
+}
+
+// blockCollection занимает воркер коллекции, пока тест не вызовет release
+func blockCollection(t *testing.T, name string) (release func()) {
+	t.Helper()
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		storage.GlobalManager.Enqueue(context.Background(), name, func(*storage.Collection) (storage.WriteResult, error) {
+			close(started)
+			<-unblock
+			return storage.WriteResult{}, nil
+		})
+	}()
+	<-started
+	return func() {
+		close(unblock)
+		<-done
+	}
+}
+
+func TestRequestIDIsEchoed(t *testing.T) {
+	c := dial(t, newTestServer(t))
+
+	c.send(api.Request{RequestID: "ins-1", Database: "echo", Command: api.CmdInsert, Data: []map[string]any{{"n": 1}}})
+	if resp := c.recv(); resp.RequestID != "ins-1" || resp.Status != api.StatusSuccess {
+		t.Fatalf("insert reply %+v", resp)
+	}
+	c.send(api.Request{RequestID: "bad-1", Database: "echo", Command: "bogus"})
+	if resp := c.recv(); resp.RequestID != "bad-1" || resp.Status != api.StatusError {
+		t.Fatalf("error reply %+v", resp)
+	}
+	// без request_id в последовательном режиме ответ тоже без него
+	c.send(api.Request{Database: "echo", Command: api.CmdFind})
+	if resp := c.recv(); resp.RequestID != "" || resp.Count != 1 {
+		t.Fatalf("find reply %+v", resp)
+	}
+}
+
+func TestConcurrentModeRepliesOutOfOrder(t *testing.T) {
+	c := dial(t, newTestServer(t))
+
+	c.send(api.Request{RequestID: "h", Command: api.CmdHello, Query: map[string]any{"concurrent": true}})
+	resp := c.recv()
+	if resp.Status != api.StatusSuccess || resp.Data[0]["concurrent"] != true || resp.Data[0]["max_in_flight"] != 8.0 {
+		t.Fatalf("hello reply %+v", resp)
+	}
+
+	c.send(api.Request{Database: "fast", Command: api.CmdFind})
+	if resp := c.recv(); resp.Status != api.StatusError || resp.Message != "request_id is required in concurrent mode" {
+		t.Fatalf("request without id: %+v", resp)
+	}
+
+	// вставка ждёт занятый воркер, find в другой коллекции отвечает раньше
+	release := blockCollection(t, "slow")
+	c.send(api.Request{RequestID: "slow-insert", Database: "slow", Command: api.CmdInsert, Data: []map[string]any{{"n": 1}}})
+	c.send(api.Request{RequestID: "fast-find", Database: "fast", Command: api.CmdFind})
+	if resp := c.recv(); resp.RequestID != "fast-find" {
+		t.Fatalf("first reply %q, want fast-find", resp.RequestID)
+	}
+	release()
+	if resp := c.recv(); resp.RequestID != "slow-insert" || resp.Status != api.StatusSuccess {
+		t.Fatalf("second reply %+v", resp)
+	}
+}
+
+func TestConcurrentModeRespectsMaxInFlight(t *testing.T) {
+	s := newTestServer(t)
+	s.MaxInFlight = 1
+	c := dial(t, s)
+
+	c.send(api.Request{RequestID: "h", Command: api.CmdHello, Query: map[string]any{"concurrent": true}})
+	if resp := c.recv(); resp.Data[0]["max_in_flight"] != 1.0 {
+		t.Fatalf("hello reply %+v", resp)
+	}
+
+	// единственный слот занят вставкой, find ждёт его и отвечает вторым
+	release := blockCollection(t, "slow")
+	c.send(api.Request{RequestID: "slow-insert", Database: "slow", Command: api.CmdInsert, Data: []map[string]any{{"n": 1}}})
+	c.send(api.Request{RequestID: "fast-find", Database: "fast", Command: api.CmdFind})
+	time.Sleep(50 * time.Millisecond)
+	release()
+	if first, second := c.recv(), c.recv(); first.RequestID != "slow-insert" || second.RequestID != "fast-find" {
+		t.Fatalf("replies %q, %q, want slow-insert first", first.RequestID, second.RequestID)
+	}
+}
+
+func TestHelloSwitchesBackToSequential(t *testing.T) {
+	c := dial(t, newTestServer(t))
+
+	c.send(api.Request{Command: api.CmdHello, Query: map[string]any{"concurrent": true}})
+	c.recv()
+	c.send(api.Request{Command: api.CmdHello, Query: map[string]any{"concurrent": false}})
+	if resp := c.recv(); resp.Message != "connection mode: sequential" {
+		t.Fatalf("hello reply %+v", resp)
+	}
+	c.send(api.Request{Database: "seq", Command: api.CmdFind})
+	if resp := c.recv(); resp.Status != api.StatusSuccess {
+		t.Fatalf("request without id after switching back: %+v", resp)
+	}
+}
@@ -0,0 +1,314 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"nosql_db/pkg/api"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxBodyBytes — предел размера тела http-запроса
+	maxBodyBytes = 64 << 20
+	// flushEvery — через сколько документов потоковый ответ сбрасывается клиенту
+	flushEvery = 500
+)
+
+// serveHTTP отдаёт REST-шлюз к тем же обработчикам, что и tcp-протокол
+func (s *TCPServer) serveHTTP() {
+	log.Printf("http gateway available on http://%s/db/", s.HTTPAddress)
+	srv := &http.Server{
+		Addr:              s.HTTPAddress,
+		Handler:           s.httpHandler(),
+		ReadHeaderTimeout: time.Duration(s.Timeout) * time.Second,
+	}
+	if err := srv.ListenAndServe(); err != nil {
+		log.Printf("http gateway error: %v", err)
+	}
+}
+
+func (s *TCPServer) httpHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /db/{coll}/insert", s.httpRoute(api.CmdInsert, insertRequest))
+	mux.HandleFunc("POST /db/{coll}/find", s.httpRoute(api.CmdFind, queryRequest))
+	mux.HandleFunc("POST /db/{coll}/sample", s.httpRoute(api.CmdSample, queryRequest))
+	mux.HandleFunc("POST /db/{coll}/delete", s.httpRoute(api.CmdDelete, queryRequest))
+	mux.HandleFunc("POST /db/{coll}/delete_one", s.httpRoute(api.CmdDeleteOne, queryRequest))
+	mux.HandleFunc("POST /db/{coll}/indexes", s.httpRoute(api.CmdCreateIndex, indexRequest))
+	mux.HandleFunc("GET /db/{coll}/indexes/builds", s.httpRoute(api.CmdIndexBuilds, nil))
+	mux.HandleFunc("POST /db/{coll}/indexes/builds/cancel", s.httpRoute(api.CmdCancelIndexBuild, cancelBuildRequest))
+	mux.HandleFunc("GET /db/{coll}/stats", s.httpRoute(api.CmdStats, nil))
+	mux.HandleFunc("POST /db/{coll}/validate", s.httpRoute(api.CmdValidate, validateRequest))
+	mux.HandleFunc("GET /admin/status", s.httpRoute(api.CmdServerStatus, nil))
+	mux.HandleFunc("GET /admin/ops", s.httpRoute(api.CmdCurrentOps, nil))
+	mux.HandleFunc("POST /admin/ops/kill", s.httpRoute(api.CmdKillOp, killOpRequest))
+	return mux
+}
+
+// bodyParser заполняет запрос из тела http-запроса
+type bodyParser func(body []byte, req *api.Request) error
+
+func (s *TCPServer) httpRoute(command string, parse bodyParser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := api.Request{
+			RequestID: r.Header.Get("X-Request-ID"),
+			Database:  r.PathValue("coll"),
+			Command:   command,
+			BatchID:   r.Header.Get("Idempotency-Key"), // используется только insert
+		}
+		if err := readLimits(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, req, err.Error())
+			return
+		}
+		if parse != nil {
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+			if err != nil {
+				writeError(w, http.StatusRequestEntityTooLarge, req, err.Error())
+				return
+			}
+			if err := parse(body, &req); err != nil {
+				writeError(w, http.StatusBadRequest, req, err.Error())
+				return
+			}
+		}
+
+		// http-запросы занимают те же слоты, что и tcp-соединения
+		ctx, cancel := context.WithTimeout(r.Context(), time.Duration(s.Timeout)*time.Second)
+		defer cancel()
+		select {
+		case s.slots <- struct{}{}:
+			defer func() { <-s.slots }()
+		case <-ctx.Done():
+			writeError(w, http.StatusServiceUnavailable, req, "server is at connection limit")
+			return
+		}
+
+		resp := s.execute(ctx, r.RemoteAddr, req)
+		if resp.Status != api.StatusSuccess {
+			writeResponse(w, statusCode(resp), resp)
+			return
+		}
+		if command == api.CmdFind && wantsNDJSON(r) {
+			streamNDJSON(w, resp)
+			return
+		}
+		streamJSON(w, resp)
+	}
+}
+
+// readLimits переносит max_time_ms, max_result_bytes и limit из параметров url
+func readLimits(r *http.Request, req *api.Request) error {
+	var limit int64
+	for name, dst := range map[string]*int64{
+		"max_time_ms":      &req.MaxTimeMS,
+		"max_result_bytes": &req.MaxResultBytes,
+		"limit":            &limit,
+	} {
+		raw := r.URL.Query().Get(name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || v < 0 {
+			return fmt.Errorf("%s must be a non-negative integer", name)
+		}
+		*dst = v
+	}
+	req.Limit = int(limit)
+	return nil
+}
+
+// insertRequest принимает документ, массив документов или {"data": [...]}
+func insertRequest(body []byte, req *api.Request) error {
+	trimmed := strings.TrimSpace(string(body))
+	if strings.HasPrefix(trimmed, "[") {
+		return json.Unmarshal(body, &req.Data)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Errorf("body must be a JSON document or an array of documents: %w", err)
+	}
+	if raw, ok := doc["data"].([]any); ok && len(doc) == 1 {
+		for _, item := range raw {
+			d, ok := item.(map[string]any)
+			if !ok {
+				return errors.New("data must contain JSON documents")
+			}
+			req.Data = append(req.Data, d)
+		}
+		return nil
+	}
+	req.Data = []map[string]any{doc}
+	return nil
+}
+
+// queryRequest принимает фильтр; пустое тело — все документы
+func queryRequest(body []byte, req *api.Request) error {
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, &req.Query); err != nil {
+		return fmt.Errorf("body must be a JSON query: %w", err)
+	}
+	return nil
+}
+
+// indexRequest принимает {"field": "name"} или {"field": "name", "type": "ip"}
+func indexRequest(body []byte, req *api.Request) error {
+	var spec struct {
+		Field string `json:"field"`
+		Type  string `json:"type"`
+	}
+	if err := json.Unmarshal(body, &spec); err != nil || spec.Field == "" {
+		return errors.New(`body must be {"field": "<name>"}`)
+	}
+	req.Query = map[string]any{spec.Field: 1}
+	if spec.Type != "" {
+		req.Query[spec.Field] = spec.Type
+	}
+	return nil
+}
+
+// cancelBuildRequest принимает {"field": "<name>"}
+func cancelBuildRequest(body []byte, req *api.Request) error {
+	var spec struct {
+		Field string `json:"field"`
+	}
+	if err := json.Unmarshal(body, &spec); err != nil || spec.Field == "" {
+		return errors.New(`body must be {"field": "<name>"}`)
+	}
+	req.Query = map[string]any{"field": spec.Field}
+	return nil
+}
+
+// validateRequest принимает пустое тело или {"repair": true}
+func validateRequest(body []byte, req *api.Request) error {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	var spec struct {
+		Repair bool `json:"repair"`
+	}
+	if err := json.Unmarshal(body, &spec); err != nil {
+		return errors.New(`body must be empty or {"repair": true}`)
+	}
+	req.Query = map[string]any{"repair": spec.Repair}
+	return nil
+}
+
+// killOpRequest принимает {"op_id": 12}
+func killOpRequest(body []byte, req *api.Request) error {
+	var spec struct {
+		OpID float64 `json:"op_id"`
+	}
+	if err := json.Unmarshal(body, &spec); err != nil || spec.OpID <= 0 {
+		return errors.New(`body must be {"op_id": <id from /admin/ops>}`)
+	}
+	req.Query = map[string]any{"op_id": spec.OpID}
+	return nil
+}
+
+func wantsNDJSON(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "ndjson" ||
+		strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+}
+
+// statusCode подбирает http-код для ответа с ошибкой по его классу
+func statusCode(resp api.Response) int {
+	switch resp.Code {
+	case api.CodeTimeLimit:
+		return http.StatusGatewayTimeout
+	case api.CodeUnavailable:
+		return http.StatusServiceUnavailable
+	case api.CodeUnknownCommand:
+		return http.StatusNotFound
+	case api.CodeNotKillable:
+		return http.StatusConflict
+	case api.CodeSchemaViolation:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, req api.Request, msg string) {
+	writeResponse(w, code, api.Response{
+		RequestID: req.RequestID,
+		Status:    api.StatusError,
+		Message:   msg,
+	})
+}
+
+// writeResponse пишет ответ обработчика целиком, вместе с нарушениями схемы
+func writeResponse(w http.ResponseWriter, code int, resp api.Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// streamJSON пишет ответ в формате tcp-протокола. Документы ответа уже
+// в памяти, по частям идёт только кодирование: тело не собирается в один
+// буфер и уходит клиенту, не дожидаясь конца
+func streamJSON(w http.ResponseWriter, resp api.Response) {
+	w.Header().Set("Content-Type", "application/json")
+	if len(resp.Data) == 0 {
+		_ = json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	data := resp.Data
+	resp.Data = nil
+	head, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// {"status":...} -> {"status":...,"data":[ ... ]}
+	fmt.Fprintf(w, `%s,"data":[`, head[:len(head)-1])
+	rc := http.NewResponseController(w)
+	for i, doc := range data {
+		if i > 0 {
+			io.WriteString(w, ",")
+		}
+		line, err := json.Marshal(doc)
+		if err != nil {
+			log.Printf("http gateway: encode document: %v", err)
+			return
+		}
+		if _, err := w.Write(line); err != nil {
+			return
+		}
+		if (i+1)%flushEvery == 0 {
+			_ = rc.Flush()
+		}
+	}
+	io.WriteString(w, "]}\n")
+}
+
+// streamNDJSON пишет найденные документы по одному на строку. Как и в
+// streamJSON, документы уже в памяти, по частям идёт только кодирование
+func streamNDJSON(w http.ResponseWriter, resp api.Response) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Result-Count", strconv.Itoa(resp.Count))
+
+	encoder := json.NewEncoder(w)
+	rc := http.NewResponseController(w)
+	for i, doc := range resp.Data {
+		if err := encoder.Encode(doc); err != nil {
+			return
+		}
+		if (i+1)%flushEvery == 0 {
+			_ = rc.Flush()
+		}
+	}
+}
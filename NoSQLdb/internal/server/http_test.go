@@ -0,0 +1,227 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"nosql_db/pkg/api"
+	"strings"
+	"testing"
+	"time"
+)
+
+// call отправляет запрос шлюзу и разбирает json-ответ
+func call(t *testing.T, method, url, body string, header ...string) (int, api.Response) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out api.Response
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("%s %s: decode response: %v", method, url, err)
+	}
+	return resp.StatusCode, out
+}
+
+func newGateway(t *testing.T) (*TCPServer, string) {
+	t.Helper()
+	s := newTestServer(t)
+	ts := httptest.NewServer(s.httpHandler())
+	t.Cleanup(ts.Close)
+	return s, ts.URL
+}
+
+func TestGatewayInsertBodies(t *testing.T) {
+	_, url := newGateway(t)
+
+	for _, body := range []string{
+		`{"host": "web-1"}`,
+		`[{"host": "web-2"}, {"host": "web-3"}]`,
+		`{"data": [{"host": "web-4"}]}`,
+	} {
+		if code, resp := call(t, "POST", url+"/db/hosts/insert", body); code != http.StatusOK || resp.Status != api.StatusSuccess {
+			t.Fatalf("insert %s: %d %+v", body, code, resp)
+		}
+	}
+	// повтор с тем же Idempotency-Key не вставляет документ второй раз
+	for range 2 {
+		call(t, "POST", url+"/db/hosts/insert", `{"host": "web-5"}`, "Idempotency-Key", "batch-5")
+	}
+
+	code, resp := call(t, "POST", url+"/db/hosts/find", "", "X-Request-ID", "req-7")
+	if code != http.StatusOK || resp.Count != 5 || len(resp.Data) != 5 || resp.RequestID != "req-7" {
+		t.Fatalf("find all: %d, count %d, %d docs, request id %q", code, resp.Count, len(resp.Data), resp.RequestID)
+	}
+	code, resp = call(t, "POST", url+"/db/hosts/find?limit=2", `{"host": {"$like": "web-%"}}`)
+	if code != http.StatusOK || len(resp.Data) != 2 {
+		t.Fatalf("find with limit: %d %+v", code, resp)
+	}
+}
+
+func TestGatewayStreamsLargeFind(t *testing.T) {
+	_, url := newGateway(t)
+
+	docs := make([]string, 1200) // больше flushEvery, ответ сбрасывается частями
+	for i := range docs {
+		docs[i] = fmt.Sprintf(`{"n": %d}`, i)
+	}
+	call(t, "POST", url+"/db/nums/insert", "["+strings.Join(docs, ",")+"]")
+
+	code, resp := call(t, "POST", url+"/db/nums/find", "")
+	if code != http.StatusOK || resp.Status != api.StatusSuccess || resp.Count != 1200 || len(resp.Data) != 1200 {
+		t.Fatalf("json find: %d, count %d, %d docs", code, resp.Count, len(resp.Data))
+	}
+
+	for _, accept := range []string{"", "application/x-ndjson"} {
+		target := url + "/db/nums/find"
+		if accept == "" {
+			target += "?format=ndjson"
+		}
+		req, _ := http.NewRequest("POST", target, strings.NewReader(`{"n": {"$gt": 999}}`))
+		req.Header.Set("Accept", accept)
+		hr, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := hr.Header.Get("Content-Type"); ct != "application/x-ndjson" || hr.Header.Get("X-Result-Count") != "200" {
+			t.Fatalf("ndjson headers: %q, count %q", ct, hr.Header.Get("X-Result-Count"))
+		}
+		lines := 0
+		scanner := bufio.NewScanner(hr.Body)
+		for scanner.Scan() {
+			var doc map[string]any
+			if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil || doc["n"].(float64) < 1000 {
+				t.Fatalf("ndjson line %q: %v", scanner.Text(), err)
+			}
+			lines++
+		}
+		hr.Body.Close()
+		if lines != 200 {
+			t.Fatalf("ndjson lines %d, want 200", lines)
+		}
+	}
+}
+
+func TestGatewayIndexesStatsAndDelete(t *testing.T) {
+	_, url := newGateway(t)
+	call(t, "POST", url+"/db/events/insert", `[{"sev": 1}, {"sev": 2}, {"sev": 3}]`)
+
+	if code, resp := call(t, "POST", url+"/db/events/indexes", `{"field": "sev"}`); code != http.StatusOK || resp.Data[0]["field"] != "sev" {
+		t.Fatalf("create index: %d %+v", code, resp)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, resp := call(t, "GET", url+"/db/events/indexes/builds", "")
+		if len(resp.Data) == 1 && resp.Data[0]["state"] == "done" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("index build not done: %+v", resp.Data)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	code, resp := call(t, "POST", url+"/db/events/delete", `{"sev": {"$gt": 1}}`)
+	if code != http.StatusOK || resp.Count != 2 {
+		t.Fatalf("delete: %d %+v", code, resp)
+	}
+	code, resp = call(t, "GET", url+"/db/events/stats", "")
+	if code != http.StatusOK || resp.Data[0]["documents"] != 1.0 || len(resp.Data[0]["indexes"].([]any)) != 1 {
+		t.Fatalf("stats: %d %+v", code, resp)
+	}
+}
+
+func TestGatewayErrorCodes(t *testing.T) {
+	_, url := newGateway(t)
+
+	cases := []struct {
+		method, path, body string
+		code               int
+	}{
+		{"POST", "/db/events/insert", `not json`, http.StatusBadRequest},
+		{"POST", "/db/events/find", `[1, 2]`, http.StatusBadRequest},
+		{"POST", "/db/events/find?limit=-1", ``, http.StatusBadRequest},
+		{"POST", "/db/events/indexes", `{}`, http.StatusBadRequest},
+		{"POST", "/db/events/indexes", `{"field": "src", "type": "bogus"}`, http.StatusBadRequest},
+		{"POST", "/admin/ops/kill", `{"op_id": 0}`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		code, resp := call(t, c.method, url+c.path, c.body, "X-Request-ID", "err-1")
+		if code != c.code || resp.Status != api.StatusError || resp.RequestID != "err-1" {
+			t.Errorf("%s %s %s: %d %+v, want %d", c.method, c.path, c.body, code, resp, c.code)
+		}
+	}
+
+	hr, err := http.Get(url + "/db/events/unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, hr.Body)
+	hr.Body.Close()
+	if hr.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown route: %s", hr.Status)
+	}
+}
+
+func TestStatusCodeFollowsErrorCode(t *testing.T) {
+	cases := []struct {
+		resp api.Response
+		code int
+	}{
+		{api.Response{Code: api.CodeTimeLimit}, http.StatusGatewayTimeout},
+		{api.Response{Code: api.CodeUnavailable, Message: "failed to create index: write queue is full"}, http.StatusServiceUnavailable},
+		{api.Response{Code: api.CodeUnknownCommand}, http.StatusNotFound},
+		{api.Response{Code: api.CodeNotKillable}, http.StatusConflict},
+		{api.Response{Code: api.CodeSchemaViolation}, http.StatusUnprocessableEntity},
+		// текст сообщения на код не влияет
+		{api.Response{Message: "unknown command in field name"}, http.StatusBadRequest},
+		{api.Response{Message: "operation exceeded time limit"}, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		if got := statusCode(c.resp); got != c.code {
+			t.Errorf("%+v: %d, want %d", c.resp, got, c.code)
+		}
+	}
+}
+
+func TestGatewayConnectionLimit(t *testing.T) {
+	s, url := newGateway(t)
+	s.Timeout = 0
+	// все слоты заняты tcp-соединениями
+	for range cap(s.slots) {
+		s.slots <- struct{}{}
+	}
+
+	code, resp := call(t, "POST", url+"/db/events/find", "")
+	if code != http.StatusServiceUnavailable || resp.Message != "server is at connection limit" {
+		t.Fatalf("find at connection limit: %d %+v", code, resp)
+	}
+}
+
+func TestGatewaySchemaViolation(t *testing.T) {
+	s, url := newGateway(t)
+	resp := s.execute(context.Background(), "test", api.Request{
+		Database: "events", Command: api.CmdSetValidator, Query: map[string]any{"required": []any{"host"}},
+	})
+	if resp.Status != api.StatusSuccess {
+		t.Fatal(resp.Message)
+	}
+
+	code, resp := call(t, "POST", url+"/db/events/insert", `[{"host": "web-1"}, {"port": 22}]`)
+	if code != http.StatusUnprocessableEntity || len(resp.Violations) != 1 || resp.Violations[0].Index != 1 {
+		t.Fatalf("strict insert: %d %+v", code, resp)
+	}
+}
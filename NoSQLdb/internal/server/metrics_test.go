@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"nosql_db/internal/index"
+	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, url string) string {
+	t.Helper()
+	resp, err := http.Get(url + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /metrics: %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestMetricsEndpointReportsRequests(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewServer(s.metricsHandler())
+	defer ts.Close()
+	// счётчики глобальные: своя коллекция на каждый запуск теста
+	coll := fmt.Sprintf("metrics_%d", time.Now().UnixNano())
+
+	run := func(req api.Request) {
+		t.Helper()
+		if resp := s.execute(context.Background(), "test", req); resp.Status != api.StatusSuccess {
+			t.Fatalf("%s: %s", req.Command, resp.Message)
+		}
+	}
+	run(api.Request{Database: coll, Command: api.CmdInsert, Data: []map[string]any{
+		{"host": "web-1", "port": 22}, {"host": "web-2", "port": 80}, {"host": "web-3", "port": 443},
+	}})
+	run(api.Request{Database: coll, Command: api.CmdFind, Query: map[string]any{"host": "web-1"}})
+
+	build, err := storage.GlobalManager.BuildIndex(coll, "port", 64, index.KeyValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-build.Done()
+	run(api.Request{Database: coll, Command: api.CmdFind, Query: map[string]any{"port": 80}})
+	bad := s.execute(context.Background(), "test", api.Request{Database: coll, Command: "bogus"})
+	if bad.Status != api.StatusError {
+		t.Fatalf("unknown command answered %s", bad.Status)
+	}
+
+	body := scrape(t, ts.URL)
+	for _, line := range []string{
+		`nosqldb_requests_total{operation="insert",collection="%[1]s",status="success"} 1`,
+		`nosqldb_requests_total{operation="find",collection="%[1]s",status="success"} 2`,
+		`nosqldb_requests_total{operation="bogus",collection="%[1]s",status="error"} 1`,
+		`nosqldb_request_duration_seconds_count{operation="find",collection="%[1]s"} 2`,
+		`nosqldb_find_scans_total{collection="%[1]s",type="full"} 1`,
+		`nosqldb_find_scans_total{collection="%[1]s",type="index"} 1`,
+		`nosqldb_collection_documents{collection="%[1]s"} 3`,
+		`nosqldb_write_queue_capacity{collection="%[1]s"} %[2]d`,
+		`nosqldb_write_queue_depth{collection="%[1]s"} 0`,
+		`nosqldb_index_size_bytes{collection="%[1]s",field="port",compressed="true"}`,
+	} {
+		if line = fmt.Sprintf(line, coll, storage.WriteQueueSize); !strings.Contains(body, "\n"+line) {
+			t.Errorf("missing %s", line)
+		}
+	}
+	if t.Failed() {
+		t.Logf("metrics:\n%s", body)
+	}
+}
+
+func TestMetricsEndpointOnlyServesMetrics(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewServer(s.metricsHandler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/db/events/find")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("metrics listener answered %s outside /metrics", resp.Status)
+	}
+	if body := scrape(t, ts.URL); !strings.Contains(body, "# TYPE nosqldb_connections_active gauge\n") {
+		t.Fatalf("connection gauges missing:\n%s", body)
+	}
+}
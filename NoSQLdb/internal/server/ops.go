@@ -0,0 +1,263 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"nosql_db/internal/handlers"
+	"nosql_db/internal/profiler"
+	"nosql_db/internal/storage"
+	"nosql_db/pkg/api"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// errKilled — причина отмены запроса командой kill_op
+	errKilled = errors.New("operation killed by kill_op")
+	// errNotKillable — kill_op для запроса, который нельзя прервать
+	errNotKillable = errors.New("cannot be killed")
+)
+
+// killable — команды, которые прерываются отменой контекста. Остальные
+// пишут без точки отмены, и kill_op их не прерывает
+var killable = map[string]bool{
+	api.CmdFind:      true,
+	api.CmdSample:    true,
+	api.CmdDelete:    true,
+	api.CmdDeleteOne: true,
+}
+
+// runningOp — запрос, который сейчас выполняется
+type runningOp struct {
+	id         uint64
+	client     string
+	operation  string
+	collection string
+	requestID  string
+	shape      map[string]any
+	started    time.Time
+	cancel     context.CancelCauseFunc
+
+	// под opTracker.mu: kill_op и начало необратимой записи исключают друг друга
+	killable   bool
+	committing bool
+	killed     bool
+}
+
+// opTracker — выполняющиеся запросы tcp-соединений и http-шлюза
+type opTracker struct {
+	mu   sync.Mutex
+	next uint64
+	ops  map[uint64]*runningOp
+}
+
+// start регистрирует запрос; done снимает его с учёта
+func (t *opTracker) start(parent context.Context, client string, req api.Request) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	op := &runningOp{
+		client:     client,
+		operation:  req.Command,
+		collection: req.Database,
+		requestID:  req.RequestID,
+		shape:      profiler.Shape(req.Query),
+		started:    time.Now(),
+		cancel:     cancel,
+		killable:   killable[req.Command],
+	}
+
+	t.mu.Lock()
+	if t.ops == nil {
+		t.ops = make(map[uint64]*runningOp)
+	}
+	t.next++
+	op.id = t.next
+	t.ops[op.id] = op
+	t.mu.Unlock()
+
+	ctx = handlers.WithCommit(ctx, func() bool { return t.commit(op) })
+	return ctx, func() {
+		t.mu.Lock()
+		delete(t.ops, op.id)
+		t.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// opInfo — запрос для current_ops
+type opInfo struct {
+	*runningOp
+	killable bool
+}
+
+// list возвращает запросы от самых долгих к новым
+func (t *opTracker) list() []opInfo {
+	t.mu.Lock()
+	ops := make([]opInfo, 0, len(t.ops))
+	for _, op := range t.ops {
+		ops = append(ops, opInfo{runningOp: op, killable: op.killable && !op.committing})
+	}
+	t.mu.Unlock()
+	sort.Slice(ops, func(i, j int) bool { return ops[i].id < ops[j].id })
+	return ops
+}
+
+func (t *opTracker) count() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.ops)
+}
+
+// commit отмечает, что запрос начал необратимую запись и kill_op его больше
+// не прерывает; false — запрос уже отменён
+func (t *opTracker) commit(op *runningOp) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if op.killed {
+		return false
+	}
+	op.committing = true
+	return true
+}
+
+// kill отменяет запрос по id. Запрос без точки отмены или уже начавший
+// запись не отменяется: он всё равно выполнился бы до конца
+func (t *opTracker) kill(id uint64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	op, ok := t.ops[id]
+	switch {
+	case !ok:
+		return fmt.Errorf("no running operation %d", id)
+	case !op.killable:
+		return fmt.Errorf("operation %d (%s) %w: it writes without a cancellation point", id, op.operation, errNotKillable)
+	case op.committing:
+		return fmt.Errorf("operation %d (%s) %w: it is already writing", id, op.operation, errNotKillable)
+	}
+	op.killed = true
+	op.cancel(errKilled)
+	return nil
+}
+
+// execute выполняет запрос tcp-соединения или http-шлюза. Команды о самом
+// сервере отвечает сам, остальные запросы видны в current_ops, пока выполняются
+func (s *TCPServer) execute(ctx context.Context, client string, req api.Request) api.Response {
+	switch req.Command {
+	case api.CmdServerStatus:
+		return s.serverStatus(req)
+	case api.CmdCurrentOps:
+		return s.currentOps(req)
+	case api.CmdKillOp:
+		return s.killOp(req)
+	}
+
+	ctx, done := s.ops.start(ctx, client, req)
+	defer done()
+	resp := handlers.HandleRequest(ctx, req)
+	if resp.Status == api.StatusError && errors.Is(context.Cause(ctx), errKilled) {
+		resp.Message = errKilled.Error()
+	}
+	return resp
+}
+
+func (s *TCPServer) serverStatus(req api.Request) api.Response {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	var queued int
+	collections := make([]map[string]any, 0)
+	for _, st := range storage.GlobalManager.Status() {
+		queued += st.QueueDepth
+		info := map[string]any{
+			"name":   st.Name,
+			"loaded": st.Loaded,
+		}
+		if st.Loaded {
+			info["documents"] = st.Documents
+		}
+		if st.QueueCapacity > 0 {
+			info["queue_depth"] = st.QueueDepth
+			info["queue_capacity"] = st.QueueCapacity
+		}
+		if st.Busy > 0 {
+			info["busy_ms"] = st.Busy.Milliseconds()
+		}
+		collections = append(collections, info)
+	}
+
+	return api.Response{
+		Status:    api.StatusSuccess,
+		RequestID: req.RequestID,
+		Data: []map[string]any{{
+			"uptime_s": int64(time.Since(s.started).Seconds()),
+			"connections": map[string]any{
+				"current":  s.connections.Load(),
+				"max":      s.MaxConnection,
+				"accepted": s.accepted.Load(),
+			},
+			"memory": map[string]any{
+				"heap_alloc_bytes": mem.HeapAlloc,
+				"heap_inuse_bytes": mem.HeapInuse,
+				"sys_bytes":        mem.Sys,
+				"num_gc":           mem.NumGC,
+				"goroutines":       runtime.NumGoroutine(),
+			},
+			"operations":  s.ops.count(),
+			"queued":      queued,
+			"collections": collections,
+		}},
+		Count: 1,
+	}
+}
+
+// currentOps показывает выполняющиеся запросы; с database — только по коллекции
+func (s *TCPServer) currentOps(req api.Request) api.Response {
+	var data []map[string]any
+	for _, op := range s.ops.list() {
+		if req.Database != "" && op.collection != req.Database {
+			continue
+		}
+		info := map[string]any{
+			"op_id":      op.id,
+			"client":     op.client,
+			"operation":  op.operation,
+			"elapsed_ms": time.Since(op.started).Milliseconds(),
+			"killable":   op.killable,
+		}
+		if op.collection != "" {
+			info["collection"] = op.collection
+		}
+		if op.requestID != "" {
+			info["request_id"] = op.requestID
+		}
+		if op.shape != nil {
+			info["query_shape"] = op.shape
+		}
+		data = append(data, info)
+	}
+	return api.Response{Status: api.StatusSuccess, RequestID: req.RequestID, Data: data, Count: len(data)}
+}
+
+// killOp отменяет запрос по query.op_id из current_ops, если его можно прервать
+func (s *TCPServer) killOp(req api.Request) api.Response {
+	raw, _ := req.Query["op_id"].(float64)
+	if raw <= 0 || raw != math.Trunc(raw) {
+		return api.Response{Status: api.StatusError, RequestID: req.RequestID, Message: "op_id required in query as a positive integer"}
+	}
+	id := uint64(raw)
+	if err := s.ops.kill(id); err != nil {
+		resp := api.Response{Status: api.StatusError, RequestID: req.RequestID, Message: err.Error()}
+		if errors.Is(err, errNotKillable) {
+			resp.Code = api.CodeNotKillable
+		}
+		return resp
+	}
+	return api.Response{
+		Status:    api.StatusSuccess,
+		RequestID: req.RequestID,
+		Message:   fmt.Sprintf("Operation %d killed", id),
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"nosql_db/pkg/api"
+	"testing"
+)
+
+func TestKillOpOnlyCancelsKillableOps(t *testing.T) {
+	var ops opTracker
+	findCtx, doneFind := ops.start(context.Background(), "c1", api.Request{Command: api.CmdFind})
+	defer doneFind()
+	_, doneInsert := ops.start(context.Background(), "c2", api.Request{Command: api.CmdInsert})
+	defer doneInsert()
+
+	list := ops.list()
+	if len(list) != 2 || !list[0].killable || list[1].killable {
+		t.Fatalf("killable in current_ops: find %v, insert %v", list[0].killable, list[1].killable)
+	}
+
+	if err := ops.kill(list[1].id); !errors.Is(err, errNotKillable) {
+		t.Fatalf("kill insert: %v, want not killable", err)
+	}
+	if err := ops.kill(list[0].id); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(context.Cause(findCtx), errKilled) {
+		t.Fatalf("find context cause %v", context.Cause(findCtx))
+	}
+	if err := ops.kill(999); err == nil {
+		t.Fatal("killed a missing operation")
+	}
+}
+
+func TestKillOpAndCommitExcludeEachOther(t *testing.T) {
+	var ops opTracker
+
+	// удаление начало запись: kill_op отказывает, запрос не отменяется
+	ctx, done := ops.start(context.Background(), "c1", api.Request{Command: api.CmdDelete})
+	op := ops.list()[0]
+	if !ops.commit(op.runningOp) {
+		t.Fatal("commit refused for a running delete")
+	}
+	if err := ops.kill(op.id); !errors.Is(err, errNotKillable) {
+		t.Fatalf("kill after commit: %v, want not killable", err)
+	}
+	if ctx.Err() != nil || ops.list()[0].killable {
+		t.Fatal("delete canceled or still killable after commit")
+	}
+	done()
+
+	// удаление отменено до записи: commit запрещает её
+	_, done = ops.start(context.Background(), "c1", api.Request{Command: api.CmdDelete})
+	defer done()
+	op = ops.list()[0]
+	if err := ops.kill(op.id); err != nil {
+		t.Fatal(err)
+	}
+	if ops.commit(op.runningOp) {
+		t.Fatal("killed delete allowed to commit")
+	}
+}
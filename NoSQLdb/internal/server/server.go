@@ -1,26 +1,41 @@
 package server
 
 import (
-	"encoding/json"
-	"io"
 	"log"
 	"net"
-	"nosql_db/internal/api"
-	"nosql_db/internal/handlers"
+	"net/http"
+	"nosql_db/internal/metrics"
+	"sync/atomic"
 	"time"
 )
 
 type TCPServer struct {
-	Address       string
-	Timeout       int
-	MaxConnection int
+	Address        string
+	Timeout        int
+	MaxConnection  int
+	MaxInFlight    int    // лимит параллельных запросов одного соединения в concurrent-режиме
+	MetricsAddress string // адрес http-листенера /metrics, пустой — выключен
+	HTTPAddress    string // адрес REST-шлюза, пустой — выключен
+
+	slots chan struct{} // общий лимит MaxConnection для tcp-соединений и http-запросов
+
+	started     time.Time
+	connections atomic.Int64 // открытые tcp-соединения
+	accepted    atomic.Int64 // принято tcp-соединений с запуска
+	ops         opTracker
 }
 
+var (
+	activeConnections = metrics.NewGaugeVec("nosqldb_connections_active", "Open client connections.")
+	maxConnections    = metrics.NewGaugeVec("nosqldb_connections_max", "Configured connection limit (MaxConnection).")
+)
+
 func New(address string) *TCPServer {
 	return &TCPServer{
 		Address:       address,
 		Timeout:       60,
 		MaxConnection: 100,
+		MaxInFlight:   8,
 	}
 }
 
@@ -32,8 +47,17 @@ func (s *TCPServer) Run() error {
 	defer listener.Close()
 
 	log.Printf("server running on %s", s.Address)
+	s.started = time.Now()
+
+	s.slots = make(chan struct{}, s.MaxConnection)
+	maxConnections.Set(float64(s.MaxConnection))
 
-	maxOpenConntecion := make(chan any, s.MaxConnection)
+	if s.MetricsAddress != "" {
+		go s.serveMetrics()
+	}
+	if s.HTTPAddress != "" {
+		go s.serveHTTP()
+	}
 
 	for {
 		conn, err := listener.Accept()
@@ -42,50 +66,31 @@ func (s *TCPServer) Run() error {
 			continue
 		}
 
-		maxOpenConntecion <- struct{}{}
+		s.slots <- struct{}{}
 
+		s.accepted.Add(1)
 		go func() {
+			activeConnections.Add(1)
+			s.connections.Add(1)
 			s.handleConnection(conn)
+			s.connections.Add(-1)
+			activeConnections.Add(-1)
 
-			<-maxOpenConntecion
+			<-s.slots
 		}()
 	}
 }
 
-func (s *TCPServer) handleConnection(conn net.Conn) {
-	defer conn.Close()
-
-	timeoutDuration := time.Duration(s.Timeout) * time.Second
-
-	_ = conn.SetDeadline(time.Now().Add(timeoutDuration))
-
-	clientAddr := conn.RemoteAddr().String()
-	log.Printf("client connected: %s", clientAddr)
-
-	decoder := json.NewDecoder(conn)
-	encoder := json.NewEncoder(conn)
-
-	for {
-		_ = conn.SetDeadline(time.Now().Add(timeoutDuration))
-
-		var req api.Request
-		err := decoder.Decode(&req)
-		if err != nil {
-			if err == io.EOF {
-				log.Printf("client disconnected: %s", clientAddr)
-			} else {
-				log.Printf("decode error from %s: %v", clientAddr, err)
-			}
-			return
-		}
-
-		resp := handlers.HandleRequest(req)
-
-		_ = conn.SetDeadline(time.Now().Add(timeoutDuration))
-
-		if err := encoder.Encode(resp); err != nil {
-			log.Printf("encode error to %s: %v", clientAddr, err)
-			return
-		}
+// serveMetrics отдаёт метрики Prometheus по http
+func (s *TCPServer) serveMetrics() {
+	log.Printf("metrics available on http://%s/metrics", s.MetricsAddress)
+	if err := http.ListenAndServe(s.MetricsAddress, s.metricsHandler()); err != nil {
+		log.Printf("metrics listener error: %v", err)
 	}
 }
+
+func (s *TCPServer) metricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	return mux
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"nosql_db/internal/storage"
+	"testing"
+)
+
+// newTestServer — сервер с пустым каталогом данных и своим менеджером
+// коллекций; слоты создаются здесь, потому что Run не вызывается
+func newTestServer(t *testing.T) *TCPServer {
+	t.Helper()
+	storage.DataDir = t.TempDir()
+	prev := storage.GlobalManager
+	storage.GlobalManager = storage.NewManager()
+	t.Cleanup(func() {
+		storage.GlobalManager.Stop()
+		storage.GlobalManager = prev
+	})
+
+	s := New("127.0.0.1:0")
+	s.slots = make(chan struct{}, s.MaxConnection)
+	return s
+}
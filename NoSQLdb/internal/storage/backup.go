@@ -0,0 +1,398 @@
+package storage
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BackupDir — каталог, в который команда backup складывает архивы
+var BackupDir = "backups"
+
+const manifestName = "manifest.json"
+
+// BackupManifest — описание архива, последняя запись в tar (в архивах
+// прежних версий — первая)
+type BackupManifest struct {
+	CreatedAt   time.Time          `json:"created_at"`
+	Collections []BackupCollection `json:"collections"`
+	Files       []BackupFile       `json:"files"`
+}
+
+// BackupCollection — коллекция в архиве
+type BackupCollection struct {
+	Name       string    `json:"name"`
+	Documents  int       `json:"documents"`
+	SnapshotAt time.Time `json:"snapshot_at"` // момент снимка коллекции
+}
+
+// BackupFile — файл в архиве с контрольной суммой
+type BackupFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// collectionSnapshot — коллекция в архиве: настройки и снимок MVCC
+type collectionSnapshot struct {
+	coll *Collection
+	opts CollectionOptions
+	snap *Snapshot
+}
+
+// snapshotCollections берёт снимки всех коллекций в один момент: на время,
+// пока снимаются все коллекции, фиксация новых версий в них ждёт. Снимки
+// нужно освободить через Release
+func (m *CollectionMng) snapshotCollections(names []string) ([]collectionSnapshot, time.Time, error) {
+	colls := make([]*Collection, 0, len(names))
+	for _, name := range names {
+		coll, err := m.GetCollection(name)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to snapshot %s: %w", name, err)
+		}
+		colls = append(colls, coll)
+	}
+
+	// блокировки берутся в порядке имён, писатель держит только свою коллекцию
+	locked := slices.Clone(colls)
+	slices.SortFunc(locked, func(a, b *Collection) int { return strings.Compare(a.Name, b.Name) })
+	locked = slices.CompactFunc(locked, func(a, b *Collection) bool { return a == b })
+	for _, coll := range locked {
+		coll.mutex.RLock()
+	}
+	snapshotAt := time.Now().UTC()
+	snaps := make([]collectionSnapshot, len(colls))
+	for i, coll := range colls {
+		snaps[i] = collectionSnapshot{coll: coll, opts: coll.Options, snap: coll.Snapshot()}
+	}
+	for _, coll := range locked {
+		coll.mutex.RUnlock()
+	}
+	return snaps, snapshotAt, nil
+}
+
+// writeFiles сериализует снимок коллекции по одному файлу в том виде, в каком
+// он лежит на диске. Пути относительные к каталогу данных и разделены "/"
+func (s collectionSnapshot) writeFiles(add func(name string, content []byte) error) (int, error) {
+	name := s.coll.Name
+	items := make(map[string]any, s.snap.Len())
+	s.snap.Scan(func(doc map[string]any) bool {
+		if id, ok := doc[IDField].(string); ok {
+			items[id] = doc
+		}
+		return true
+	})
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("marshal error: %w", err)
+	}
+	if data, err = encodeFile(data, s.opts.Compression); err != nil {
+		return 0, err
+	}
+	if err := add(name+".json", data); err != nil {
+		return 0, err
+	}
+
+	for _, fieldName := range s.snap.IndexFields() {
+		btree, _ := s.snap.GetIndex(fieldName)
+		jsonData, err := json.MarshalIndent(serializeBTree(btree, fieldName, 64), "", "  ")
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal index: %w", err)
+		}
+		if jsonData, err = encodeFile(jsonData, s.opts.Compression); err != nil {
+			return 0, err
+		}
+		if err := add(path.Join("indexes", fmt.Sprintf("%s_%s.idx", name, fieldName)), jsonData); err != nil {
+			return 0, err
+		}
+	}
+
+	meta, err := json.MarshalIndent(s.opts, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal options: %w", err)
+	}
+	if err := add(path.Join("meta", name+".json"), meta); err != nil {
+		return 0, err
+	}
+	return len(items), nil
+}
+
+// ListCollections возвращает имена загруженных коллекций и коллекций на диске
+func (m *CollectionMng) ListCollections() ([]string, error) {
+	seen := make(map[string]bool)
+
+	m.mu.Lock()
+	for name := range m.collections {
+		seen[name] = true
+	}
+	m.mu.Unlock()
+
+	entries, err := os.ReadDir(DataDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		seen[strings.TrimSuffix(name, ".json")] = true
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Backup сохраняет коллекции в архив tar.gz. Снимки MVCC всех коллекций
+// берутся в один момент, до записи архива, так что архив согласован целиком.
+// Файлы пишутся в архив по одному, запись в коллекции не останавливается
+func (m *CollectionMng) Backup(names []string, archivePath string) (*BackupManifest, error) {
+	if len(names) == 0 {
+		var err error
+		if names, err = m.ListCollections(); err != nil {
+			return nil, err
+		}
+	}
+
+	snaps, snapshotAt, err := m.snapshotCollections(names)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, s := range snaps {
+			s.snap.Release()
+		}
+	}()
+
+	manifest := &BackupManifest{CreatedAt: snapshotAt}
+	w, err := createArchive(archivePath, manifest.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer w.abort()
+
+	for _, s := range snaps {
+		docs, err := s.writeFiles(w.add)
+		if err != nil {
+			return nil, fmt.Errorf("failed to back up %s: %w", s.coll.Name, err)
+		}
+		manifest.Collections = append(manifest.Collections, BackupCollection{
+			Name:       s.coll.Name,
+			Documents:  docs,
+			SnapshotAt: snapshotAt,
+		})
+	}
+	manifest.Files = w.files
+
+	if err := w.finish(archivePath, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// archiveWriter пишет tar.gz во временный файл рядом с архивом
+// и считает контрольные суммы записанных файлов
+type archiveWriter struct {
+	f       *os.File
+	zw      *gzip.Writer
+	tw      *tar.Writer
+	modTime time.Time
+	files   []BackupFile
+}
+
+func createArchive(archivePath string, modTime time.Time) (*archiveWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	f, err := os.Create(archivePath + ".tmp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive: %w", err)
+	}
+	zw := gzip.NewWriter(f)
+	return &archiveWriter{f: f, zw: zw, tw: tar.NewWriter(zw), modTime: modTime}, nil
+}
+
+// add пишет файл в архив и запоминает его размер и sha256 для манифеста
+func (w *archiveWriter) add(name string, content []byte) error {
+	if err := w.writeEntry(name, content); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	w.files = append(w.files, BackupFile{
+		Path:   name,
+		Size:   int64(len(content)),
+		SHA256: hex.EncodeToString(sum[:]),
+	})
+	return nil
+}
+
+func (w *archiveWriter) writeEntry(name string, content []byte) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: w.modTime,
+	}
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if _, err := w.tw.Write(content); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// finish дописывает манифест последней записью и публикует архив
+func (w *archiveWriter) finish(archivePath string, manifest *BackupManifest) error {
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := w.writeEntry(manifestName, manifestData); err != nil {
+		return err
+	}
+	err = w.tw.Close()
+	if err == nil {
+		err = w.zw.Close()
+	}
+	if closeErr := w.f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	if err := os.Rename(w.f.Name(), archivePath); err != nil {
+		return fmt.Errorf("failed to publish archive: %w", err)
+	}
+	return nil
+}
+
+// abort удаляет недописанный архив; после finish ничего не делает
+func (w *archiveWriter) abort() {
+	w.f.Close()
+	os.Remove(w.f.Name())
+}
+
+// RestoreArchive распаковывает архив в новый каталог данных, сверяя контрольные суммы.
+// Каталог должен отсутствовать или быть пустым; при ошибке он не создаётся
+func RestoreArchive(archivePath, targetDir string) (*BackupManifest, error) {
+	if entries, err := os.ReadDir(targetDir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("target directory %s is not empty", targetDir)
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	tmpDir := filepath.Clean(targetDir) + ".restore"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return nil, fmt.Errorf("failed to clean %s: %w", tmpDir, err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// манифест пишется после файлов, поэтому суммы сверяются в конце
+	var manifest *BackupManifest
+	extracted := make(map[string]BackupFile)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		if hdr.Name == manifestName {
+			manifest = &BackupManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, fmt.Errorf("invalid manifest: %w", err)
+			}
+			continue
+		}
+		if _, ok := extracted[hdr.Name]; ok {
+			return nil, fmt.Errorf("duplicate file in archive: %s", hdr.Name)
+		}
+		file, err := restoreFile(tr, tmpDir, hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+		extracted[hdr.Name] = file
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("archive has no %s", manifestName)
+	}
+	for _, file := range manifest.Files {
+		got, ok := extracted[file.Path]
+		if !ok {
+			return nil, fmt.Errorf("file missing from archive: %s", file.Path)
+		}
+		if got != file {
+			return nil, fmt.Errorf("checksum mismatch for %s", file.Path)
+		}
+		delete(extracted, file.Path)
+	}
+	for p := range extracted {
+		return nil, fmt.Errorf("unexpected file in archive: %s", p)
+	}
+
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	if err := os.Remove(targetDir); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to replace %s: %w", targetDir, err)
+	}
+	if err := os.Rename(tmpDir, targetDir); err != nil {
+		return nil, fmt.Errorf("failed to publish data directory: %w", err)
+	}
+	return manifest, nil
+}
+
+// restoreFile копирует запись архива в каталог и возвращает её размер и sha256
+func restoreFile(r io.Reader, dir, name string) (BackupFile, error) {
+	file := BackupFile{Path: name}
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return file, fmt.Errorf("invalid path in archive: %s", name)
+	}
+	dst := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return file, fmt.Errorf("failed to create directory: %w", err)
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return file, fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	defer out.Close()
+
+	hasher := sha256.New()
+	if file.Size, err = io.Copy(io.MultiWriter(out, hasher), r); err != nil {
+		return file, fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	file.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+	return file, out.Close()
+}
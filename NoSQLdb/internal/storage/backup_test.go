@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"nosql_db/internal/index"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	DataDir = t.TempDir()
+	m := NewManager()
+	defer m.Stop()
+
+	result := m.Enqueue(context.Background(), "events", func(coll *Collection) (WriteResult, error) {
+		for _, host := range []string{"web-1", "web-2", "db-1"} {
+			if _, err := coll.Insert(map[string]any{"host": host}); err != nil {
+				return WriteResult{}, err
+			}
+		}
+		return WriteResult{}, coll.CreateIndex("host", 64)
+	})
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+
+	// воркер коллекции занят: снимок для архива его не ждёт
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go m.Enqueue(context.Background(), "events", func(coll *Collection) (WriteResult, error) {
+		close(started)
+		<-release
+		return WriteResult{}, nil
+	})
+	<-started
+	archive := filepath.Join(t.TempDir(), "nightly.tar.gz")
+	done := make(chan error, 1)
+	var manifest *BackupManifest
+	go func() {
+		var err error
+		manifest, err = m.Backup(nil, archive)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("backup waited for the busy writer")
+	}
+	close(release)
+
+	if len(manifest.Collections) != 1 || manifest.Collections[0].Documents != 3 || manifest.Collections[0].SnapshotAt.IsZero() {
+		t.Fatalf("manifest collections %+v", manifest.Collections)
+	}
+
+	restored := filepath.Join(t.TempDir(), "restored")
+	if _, err := RestoreArchive(archive, restored); err != nil {
+		t.Fatal(err)
+	}
+	DataDir = restored
+	coll, err := LoadCollection("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := coll.LoadAllIndexes(); err != nil {
+		t.Fatal(err)
+	}
+	if coll.Data.Len() != 3 {
+		t.Fatalf("restored %d documents, want 3", coll.Data.Len())
+	}
+	btree, ok := coll.Indexes["host"]
+	if !ok {
+		t.Fatal("index not restored")
+	}
+	ids := index.ValuesToStrings(btree.Search(index.ValueToKey("db-1")))
+	if len(ids) != 1 {
+		t.Fatalf("restored index lookup: %v", ids)
+	}
+	if doc, ok := coll.Data.Get(ids[0]); !ok || doc["host"] != "db-1" {
+		t.Fatalf("restored document %v", doc)
+	}
+}
+
+func TestBackupSnapshotsCollectionsAtOneMoment(t *testing.T) {
+	DataDir = t.TempDir()
+	m := NewManager()
+	defer m.Stop()
+	for _, name := range []string{"events", "hosts"} {
+		result := m.Enqueue(context.Background(), name, func(coll *Collection) (WriteResult, error) {
+			_, err := coll.Insert(map[string]any{"host": "web-1"})
+			return WriteResult{}, err
+		})
+		if result.Error != nil {
+			t.Fatal(result.Error)
+		}
+	}
+
+	manifest, err := m.Backup(nil, filepath.Join(t.TempDir(), "all.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Collections) != 2 {
+		t.Fatalf("manifest collections %+v", manifest.Collections)
+	}
+	for _, coll := range manifest.Collections {
+		if !coll.SnapshotAt.Equal(manifest.CreatedAt) {
+			t.Fatalf("%s snapshot at %v, archive at %v", coll.Name, coll.SnapshotAt, manifest.CreatedAt)
+		}
+	}
+}
+
+func TestRestoreRejectsChecksumMismatch(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "broken.tar.gz")
+	w, err := createArchive(archive, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.abort()
+	if err := w.add("events.json", []byte(`{"1": {"_id": "1"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	manifest := &BackupManifest{Files: w.files}
+	manifest.Files[0].SHA256 = strings.Repeat("0", 64)
+	if err := w.finish(archive, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := filepath.Join(t.TempDir(), "restored")
+	_, err = RestoreArchive(archive, restored)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("restore of a corrupted archive: %v", err)
+	}
+	if _, err := os.Stat(restored); !os.IsNotExist(err) {
+		t.Fatal("data directory created from a corrupted archive")
+	}
+}
+
+func TestRestoreReadsManifestFirstArchives(t *testing.T) {
+	content := []byte(`{"1": {"_id": "1", "host": "web-1"}}`)
+	sum := sha256.Sum256(content)
+	manifest := &BackupManifest{Files: []BackupFile{{Path: "events.json", Size: int64(len(content)), SHA256: hex.EncodeToString(sum[:])}}}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// архивы прежних версий начинаются с манифеста
+	archive := filepath.Join(t.TempDir(), "old.tar.gz")
+	w, err := createArchive(archive, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.abort()
+	if err := w.writeEntry(manifestName, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.writeEntry("events.json", content); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(w.f.Name(), archive); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := filepath.Join(t.TempDir(), "restored")
+	if _, err := RestoreArchive(archive, restored); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(filepath.Join(restored, "events.json")); err != nil || string(got) != string(content) {
+		t.Fatalf("restored %q, %v", got, err)
+	}
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nosql_db/internal/index"
+)
+
+// CappedOptions — ограничения capped-коллекции: при вставке сверх лимита
+// вытесняются самые старые документы. 0 — без ограничения по этому параметру
+type CappedOptions struct {
+	MaxDocs  int   `json:"max_docs,omitempty"`
+	MaxBytes int64 `json:"max_bytes,omitempty"` // суммарный размер документов в json
+}
+
+// ErrCappedID — в capped-коллекции _id задаёт сервер: порядок _id и есть порядок вставки
+var ErrCappedID = errors.New("capped collection does not accept client _id")
+
+// over — превышен ли хотя бы один лимит
+func (o *CappedOptions) over(docs int, bytes int64) bool {
+	return (o.MaxDocs > 0 && docs > o.MaxDocs) || (o.MaxBytes > 0 && bytes > o.MaxBytes)
+}
+
+// docSize — размер документа в json, по нему считается max_bytes
+func docSize(doc map[string]any) int64 {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return 0
+	}
+	return int64(len(data))
+}
+
+// SetCapped делает коллекцию capped или, с nil, снимает ограничения.
+// Лишние старые документы вытесняются сразу; возвращает их число.
+// Вытесняются документы по порядку _id, поэтому коллекция с _id клиента
+// capped не делается: их порядок не совпадает с порядком вставки
+func (c *Collection) SetCapped(opts *CappedOptions) (int, error) {
+	c.mutex.Lock()
+	if opts != nil && c.Options.Capped == nil {
+		if id, ok := c.clientID(); ok {
+			c.mutex.Unlock()
+			return 0, fmt.Errorf("%w: document '%s' was inserted with its own _id", ErrCappedID, id)
+		}
+	}
+	c.Options.Capped = opts
+	c.dirty = true // снимок должен узнать о новом порядке обхода
+	c.recountCappedBytes()
+	evicted := c.evictCapped()
+	err := c.saveOptionsInternal()
+	c.mutex.Unlock()
+	if err != nil || evicted == 0 {
+		return evicted, err
+	}
+
+	if err := c.Save(); err != nil {
+		return evicted, err
+	}
+	return evicted, c.SaveAllIndexes()
+}
+
+// clientID — _id какого-нибудь документа, заданный клиентом, а не сервером
+func (c *Collection) clientID() (string, bool) {
+	found := ""
+	c.Data.Range(func(id string, _ map[string]any) bool {
+		if !isGeneratedID(id) {
+			found = id
+			return false
+		}
+		return true
+	})
+	return found, found != ""
+}
+
+// Capped возвращает ограничения коллекции или nil, если она не capped
+func (c *Collection) Capped() *CappedOptions {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.Options.Capped
+}
+
+// checkCapped проверяет документ перед вставкой в capped-коллекцию
+func (c *Collection) checkCapped(clientID string, doc map[string]any) error {
+	capped := c.Options.Capped
+	if capped == nil {
+		return nil
+	}
+	if clientID != "" {
+		return ErrCappedID
+	}
+	if size := docSize(doc); capped.MaxBytes > 0 && size > capped.MaxBytes {
+		return fmt.Errorf("document of %d bytes exceeds capped collection max_bytes %d", size, capped.MaxBytes)
+	}
+	return nil
+}
+
+// recountCappedBytes пересчитывает размер документов, если он нужен для max_bytes
+func (c *Collection) recountCappedBytes() {
+	c.cappedBytes = 0
+	if c.Options.Capped == nil || c.Options.Capped.MaxBytes <= 0 {
+		return
+	}
+	c.Data.Range(func(_ string, doc map[string]any) bool {
+		c.cappedBytes += docSize(doc)
+		return true
+	})
+}
+
+// trackCappedBytes учитывает вставку (sign=1) или удаление (sign=-1) документа
+func (c *Collection) trackCappedBytes(doc map[string]any, sign int64) {
+	if c.Options.Capped != nil && c.Options.Capped.MaxBytes > 0 {
+		c.cappedBytes += sign * docSize(doc)
+	}
+}
+
+// evictCapped удаляет самые старые документы, пока коллекция не уложится
+// в лимиты. Вызывается под блокировкой писателя, индексы обновляются как при delete
+func (c *Collection) evictCapped() int {
+	capped := c.Options.Capped
+	if capped == nil {
+		return 0
+	}
+
+	var victims []string
+	docs, bytes := c.Data.Len(), c.cappedBytes
+	c.ids.AscendRange(context.Background(), nil, nil, false, false, func(value index.Value) bool {
+		if !capped.over(docs, bytes) {
+			return false
+		}
+		id := string(value)
+		if doc, ok := c.Data.Get(id); ok {
+			if capped.MaxBytes > 0 {
+				bytes -= docSize(doc)
+			}
+			docs--
+			victims = append(victims, id)
+		}
+		return true
+	})
+	for _, id := range victims {
+		c.deleteInternal(id)
+	}
+	return len(victims)
+}
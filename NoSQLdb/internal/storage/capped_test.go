@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+// scanNs возвращает поле n документов снимка в порядке обхода
+func scanNs(coll *Collection) []float64 {
+	coll.Commit()
+	snap := coll.Snapshot()
+	defer snap.Release()
+	var ns []float64
+	snap.Scan(func(doc map[string]any) bool {
+		ns = append(ns, doc["n"].(float64))
+		return true
+	})
+	return ns
+}
+
+func TestCappedEvictsOldestAndScansNewestFirst(t *testing.T) {
+	DataDir = t.TempDir()
+	coll := NewCollection("capped")
+	if err := coll.CreateIndex("n", 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := coll.SetCapped(&CappedOptions{MaxDocs: 3}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 5 {
+		if _, err := coll.Insert(map[string]any{"n": float64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := scanNs(coll)
+	want := []float64{4, 3, 2}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Fatalf("scan order %v, want %v", got, want)
+	}
+	btree, _ := coll.GetIndex("n")
+	if vals := btree.RangeSearch(nil, nil, false, false); len(vals) != 3 {
+		t.Fatalf("index not updated on eviction: %d entries", len(vals))
+	}
+}
+
+func TestCappedMaxBytes(t *testing.T) {
+	DataDir = t.TempDir()
+	coll := NewCollection("capped")
+	doc := map[string]any{"n": 0.0, "pad": "xxxxxxxxxx"}
+	size := docSize(doc) + int64(len(`,"_id":"0000000000000-0000-000000"`))
+	if _, err := coll.SetCapped(&CappedOptions{MaxBytes: 2*size + size/2}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 4 {
+		if _, err := coll.Insert(map[string]any{"n": float64(i), "pad": "xxxxxxxxxx"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := scanNs(coll); len(got) != 2 || got[0] != 3 {
+		t.Fatalf("scan %v, want the two newest documents", got)
+	}
+
+	big := map[string]any{"pad": string(make([]byte, 3*size))}
+	if _, err := coll.Insert(big); err == nil {
+		t.Fatal("document larger than max_bytes accepted")
+	}
+}
+
+func TestCappedRejectsClientID(t *testing.T) {
+	DataDir = t.TempDir()
+	coll := NewCollection("capped")
+	if _, err := coll.SetCapped(&CappedOptions{MaxDocs: 10}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := coll.InsertMany([]map[string]any{{"_id": "mine"}}, nil)
+	if !errors.Is(err, ErrCappedID) {
+		t.Fatalf("got %v, want ErrCappedID", err)
+	}
+}
+
+func TestSetCappedRejectsClientIDs(t *testing.T) {
+	DataDir = t.TempDir()
+	coll := NewCollection("capped")
+	// "1" < "5" по _id, хотя вставлен позже: вытеснение удалило бы не тот документ
+	if _, err := coll.InsertMany([]map[string]any{{"_id": "5", "n": 1.0}, {"_id": "1", "n": 2.0}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := coll.SetCapped(&CappedOptions{MaxDocs: 1}); !errors.Is(err, ErrCappedID) {
+		t.Fatalf("got %v, want ErrCappedID", err)
+	}
+	if coll.Capped() != nil || coll.Len() != 2 {
+		t.Fatalf("collection changed after rejected SetCapped: capped %v, %d documents", coll.Capped(), coll.Len())
+	}
+}
+
+func TestCappedSurvivesReload(t *testing.T) {
+	DataDir = t.TempDir()
+	coll := NewCollection("capped")
+	for i := range 4 {
+		coll.Insert(map[string]any{"n": float64(i)})
+	}
+	evicted, err := coll.SetCapped(&CappedOptions{MaxDocs: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evicted != 2 {
+		t.Fatalf("evicted %d, want 2", evicted)
+	}
+
+	loaded, err := LoadCollection("capped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.Insert(map[string]any{"n": 4.0})
+	if got := scanNs(loaded); len(got) != 2 || got[0] != 4 || got[1] != 3 {
+		t.Fatalf("after reload scan %v, want [4 3]", got)
+	}
+}
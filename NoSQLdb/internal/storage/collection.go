@@ -2,87 +2,221 @@ package storage
 
 import (
 	"fmt"
-	"math/rand"
 	"nosql_db/internal/index"
 	"sync"
 	"time"
 )
 
+// idIndexOrder — порядок встроенного индекса по _id
+const idIndexOrder = 64
+
 type Collection struct {
-	mutex   sync.RWMutex
+	mutex   sync.RWMutex // сериализует писателей; читатели работают со снимками
 	Name    string
-	Data    *HashMap
-	Indexes map[string]*index.BTree
+	Data    *DocumentStore
+	Indexes map[string]*index.BTree // индексы писателя, читатели видят их копии в снимках
+	Options CollectionOptions
+
+	// ids — встроенный индекс по _id для поиска диапазонов; на диск не пишется,
+	// строится при загрузке коллекции
+	ids *index.BTree
+	// dedup — недавние ключи идемпотентности вставок
+	dedup dedupTable
+	// journals — изменения индексов, ещё не записанные на диск
+	journals map[string]*indexJournal
+	// cappedBytes — размер документов capped-коллекции с max_bytes
+	cappedBytes int64
+	// builds — индексы, которые строятся в фоне, по полям
+	builds map[string]*IndexBuild
+
+	usageMu    sync.Mutex
+	dataUsage  fileUsage
+	indexUsage map[string]fileUsage
+
+	// MVCC: изменения писателя получают версию writeSeq и видны после Commit
+	mvcc     mvccState
+	writeSeq uint64
+	dirty    bool
+	garbage  []garbageDoc
 }
 
 func NewCollection(name string) *Collection {
 	return &Collection{
-		Name:    name,
-		Data:    NewHashMap(),
-		Indexes: make(map[string]*index.BTree),
+		Name:       name,
+		Data:       NewDocumentStore(),
+		Indexes:    make(map[string]*index.BTree),
+		Options:    CollectionOptions{Compression: DefaultCompression},
+		ids:        index.NewBPlusTree(idIndexOrder),
+		indexUsage: make(map[string]fileUsage),
+		journals:   make(map[string]*indexJournal),
+		builds:     make(map[string]*IndexBuild),
+		mvcc: mvccState{
+			current: &version{indexes: map[string]*index.BTree{}, ids: index.NewBPlusTree(idIndexOrder)},
+			readers: make(map[uint64]int),
+		},
+		writeSeq: 1,
 	}
 }
 
-func generateID() string {
-	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), rand.Intn(1000000))
-}
-
+// Insert добавляет документ. _id, заданный клиентом, сохраняется,
+// иначе генерируется новый; повтор существующего _id — ErrDuplicateID
 func (c *Collection) Insert(doc map[string]any) (string, error) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	id := generateID()
-	doc["_id"] = id
-	c.Data.Put(id, doc)
-
-	c.updateIndexesOnInsert(id, doc)
+	id, err := documentID(doc)
+	if err != nil {
+		return "", err
+	}
+	if id != "" {
+		if _, exists := c.Data.Get(id); exists {
+			return "", fmt.Errorf("%w '%s'", ErrDuplicateID, id)
+		}
+	}
+	if err := c.checkCapped(id, doc); err != nil {
+		return "", err
+	}
+	c.insertInternal(id, doc)
+	c.evictCapped()
+	return doc[IDField].(string), nil
+}
 
-	return id, nil
+// InsertResult — итог вставки пакета
+type InsertResult struct {
+	IDs          []string // _id по порядку пакета; у повтора — _id ранее сохранённого документа
+	Duplicate    []bool   // документ пропущен: его ключ идемпотентности уже встречался
+	Inserted     int
+	Deduplicated int
 }
 
-// GetByID получает документ по _id
-func (c *Collection) GetByID(id string) (map[string]any, bool) {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+// InsertMany вставляет пакет документов целиком или не вставляет ничего:
+// _id клиента проверяются на повторы в коллекции и внутри пакета до вставки.
+// keys — ключи идемпотентности по документам (nil или "" — без ключа); документ
+// с ключом, сохранённым за последние DedupWindow, пропускается
+func (c *Collection) InsertMany(docs []map[string]any, keys []string) (InsertResult, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-	val, ok := c.Data.Get(id)
-	if !ok {
-		return nil, false
+	now := time.Now()
+	c.dedup.expire(now)
+
+	result := InsertResult{IDs: make([]string, len(docs)), Duplicate: make([]bool, len(docs))}
+	clientIDs := make([]string, len(docs))
+	firstInBatch := make([]int, len(docs)) // для повтора внутри пакета — номер первого документа
+	seenIDs := make(map[string]bool)
+	seenKeys := make(map[string]int)
+	for i, doc := range docs {
+		firstInBatch[i] = -1
+		if key := dedupKey(keys, i); key != "" {
+			if id, ok := c.dedup.lookup(key, now); ok {
+				result.IDs[i], result.Duplicate[i] = id, true
+				continue
+			}
+			if first, ok := seenKeys[key]; ok {
+				firstInBatch[i], result.Duplicate[i] = first, true
+				continue
+			}
+			seenKeys[key] = i
+		}
+
+		id, err := documentID(doc)
+		if err != nil {
+			return InsertResult{}, fmt.Errorf("document %d: %w", i, err)
+		}
+		if err := c.checkCapped(id, doc); err != nil {
+			return InsertResult{}, fmt.Errorf("document %d: %w", i, err)
+		}
+		if id == "" {
+			continue
+		}
+		if _, exists := c.Data.Get(id); exists || seenIDs[id] {
+			return InsertResult{}, fmt.Errorf("document %d: %w '%s'", i, ErrDuplicateID, id)
+		}
+		seenIDs[id] = true
+		clientIDs[i] = id
 	}
 
-	doc, ok := val.(map[string]any)
-	if !ok {
-		return nil, false
+	for i, doc := range docs {
+		if result.Duplicate[i] {
+			if first := firstInBatch[i]; first >= 0 {
+				result.IDs[i] = result.IDs[first]
+			}
+			result.Deduplicated++
+			continue
+		}
+		result.IDs[i] = c.insertInternal(clientIDs[i], doc)
+		result.Inserted++
+		if key := dedupKey(keys, i); key != "" {
+			c.dedup.remember(key, result.IDs[i], now)
+		}
+	}
+	c.evictCapped()
+	return result, nil
+}
+
+// insertInternal вставляет документ под уже взятой блокировкой, пустой id — сгенерировать
+func (c *Collection) insertInternal(id string, doc map[string]any) string {
+	if id == "" {
+		id = generateID()
+		doc[IDField] = id
 	}
-	return doc, true
+	c.Data.Put(id, doc, c.writeSeq)
+	c.ids.Insert(index.ValueToKey(id), []byte(id))
+	c.dirty = true
+
+	c.updateIndexesOnInsert(id, doc)
+	c.trackCappedBytes(doc, 1)
+	return id
+}
+
+// GetByID получает последнюю версию документа по _id, включая ещё не
+// опубликованные изменения; читателям нужен Snapshot().GetByID
+func (c *Collection) GetByID(id string) (map[string]any, bool) {
+	return c.Data.Get(id)
 }
 
 // Delete удаляет документ по _id
 func (c *Collection) Delete(id string) bool {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	return c.deleteInternal(id)
+}
 
-	val, ok := c.Data.Get(id)
+// deleteInternal удаляет документ под уже взятой блокировкой
+func (c *Collection) deleteInternal(id string) bool {
+	doc, ok := c.Data.Get(id)
 	if !ok {
 		return false
 	}
-	doc := val.(map[string]any)
 
+	c.trackCappedBytes(doc, -1)
 	c.updateIndexesOnDelete(id, doc)
-
-	return c.Data.Remove(id)
+	c.ids.Delete(index.ValueToKey(id), []byte(id))
+	c.Data.Remove(id, c.writeSeq)
+	c.garbage = append(c.garbage, garbageDoc{id: id, seq: c.writeSeq})
+	c.dirty = true
+	return true
 }
 
+// All возвращает срез всех документов последней версии; для обхода без копирования — Scan
 func (c *Collection) All() []map[string]any {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
-
-	items := c.Data.Items()
-	docs := make([]map[string]any, 0, len(items))
-	for _, v := range items {
-		if doc, ok := v.(map[string]any); ok {
-			docs = append(docs, doc)
-		}
-	}
+	docs := make([]map[string]any, 0, c.Data.Len())
+	c.Data.Range(func(_ string, doc map[string]any) bool {
+		docs = append(docs, doc)
+		return true
+	})
 	return docs
 }
+
+// Scan обходит документы без копирования коллекции; fn возвращает false,
+// чтобы остановиться, и не должен менять коллекцию
+func (c *Collection) Scan(fn func(doc map[string]any) bool) {
+	c.Data.Range(func(_ string, doc map[string]any) bool {
+		return fn(doc)
+	})
+}
+
+// Len — число документов в коллекции
+func (c *Collection) Len() int {
+	return c.Data.Len()
+}
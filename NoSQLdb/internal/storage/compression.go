@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Compression — формат хранения файлов коллекции и индексов на диске
+type Compression string
+
+const (
+	CompressionNone Compression = "none"
+	CompressionGzip Compression = "gzip"
+)
+
+// DefaultCompression применяется к коллекциям без явно заданного формата
+var DefaultCompression = CompressionNone
+
+// gzipMagic — сигнатура gzip-потока, по ней формат определяется при загрузке
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ParseCompression проверяет название алгоритма сжатия
+func ParseCompression(name string) (Compression, error) {
+	switch Compression(name) {
+	case "", CompressionNone:
+		return CompressionNone, nil
+	case CompressionGzip:
+		return CompressionGzip, nil
+	default:
+		return "", fmt.Errorf("unknown compression: %s", name)
+	}
+}
+
+// fileUsage — размер содержимого файла до и после сжатия
+type fileUsage struct {
+	Raw    int64
+	Stored int64
+}
+
+// encodeFile упаковывает данные выбранным алгоритмом и шифрует активным ключом
+func encodeFile(data []byte, c Compression) ([]byte, error) {
+	packed, err := compress(data, c)
+	if err != nil {
+		return nil, err
+	}
+	return seal(packed)
+}
+
+func compress(data []byte, c Compression) ([]byte, error) {
+	switch c {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, fmt.Errorf("gzip write error: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("gzip close error: %w", err)
+		}
+		return buf.Bytes(), nil
+	default:
+		return data, nil
+	}
+}
+
+// decodeFile расшифровывает и распаковывает содержимое файла, формат
+// определяется по сигнатуре
+func decodeFile(raw []byte) ([]byte, Compression, error) {
+	raw, err := unseal(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	if !bytes.HasPrefix(raw, gzipMagic) {
+		return raw, CompressionNone, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, "", fmt.Errorf("gzip header error: %w", err)
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, "", fmt.Errorf("gzip read error: %w", err)
+	}
+	return data, CompressionGzip, nil
+}
+
+// writeEncodedFile сжимает и записывает файл, возвращает размеры до и после сжатия
+func writeEncodedFile(path string, data []byte, c Compression) (fileUsage, error) {
+	encoded, err := encodeFile(data, c)
+	if err != nil {
+		return fileUsage{}, err
+	}
+	if err := writeFileAtomic(path, encoded); err != nil {
+		return fileUsage{}, err
+	}
+	return fileUsage{Raw: int64(len(data)), Stored: int64(len(encoded))}, nil
+}
+
+// readEncodedFile читает файл в любом поддерживаемом формате
+func readEncodedFile(path string) ([]byte, Compression, fileUsage, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fileUsage{}, err
+	}
+	data, c, err := decodeFile(raw)
+	if err != nil {
+		return nil, "", fileUsage{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return data, c, fileUsage{Raw: int64(len(data)), Stored: int64(len(raw))}, nil
+}
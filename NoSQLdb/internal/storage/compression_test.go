@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"bytes"
+	"nosql_db/internal/index"
+	"os"
+	"testing"
+)
+
+// fillEvents вставляет однотипные события, которые хорошо сжимаются
+func fillEvents(t *testing.T, coll *Collection, n int) {
+	t.Helper()
+	for i := range n {
+		host := "web-1"
+		if i%2 == 0 {
+			host = "web-2"
+		}
+		if _, err := coll.Insert(map[string]any{
+			"host":     host,
+			"severity": "high",
+			"raw_log":  "Failed password for invalid user admin from 10.0.0.1 port 22 ssh2",
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := coll.CreateIndex("host", 64); err != nil {
+		t.Fatal(err)
+	}
+	if err := coll.Save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGzipCollectionRoundTrip(t *testing.T) {
+	DataDir = t.TempDir()
+	coll := NewCollection("events")
+	if err := coll.SetCompression(CompressionGzip); err != nil {
+		t.Fatal(err)
+	}
+	fillEvents(t, coll, 200)
+
+	for _, path := range []string{dataPath("events"), indexPath("events", "host")} {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(raw, gzipMagic) {
+			t.Fatalf("%s is not gzip", path)
+		}
+	}
+
+	// без файла настроек формат определяется по самому файлу
+	if err := os.Remove(optionsPath("events")); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCollection("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.LoadAllIndexes(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Options.Compression != CompressionGzip || loaded.Data.Len() != 200 {
+		t.Fatalf("loaded %d documents as %q", loaded.Data.Len(), loaded.Options.Compression)
+	}
+	if got := loaded.Indexes["host"].Search(index.ValueToKey("web-2")); len(got) != 100 {
+		t.Fatalf("gzip index lookup: %d ids, want 100", len(got))
+	}
+}
+
+func TestSetCompressionRewritesFiles(t *testing.T) {
+	DataDir = t.TempDir()
+	coll := NewCollection("events")
+	coll.Options.Compression = CompressionGzip
+	fillEvents(t, coll, 20)
+
+	if err := coll.SetCompression(CompressionNone); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{dataPath("events"), indexPath("events", "host")} {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.HasPrefix(raw, gzipMagic) {
+			t.Fatalf("%s still gzip after switching to none", path)
+		}
+	}
+	loaded, err := LoadCollection("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Options.Compression != CompressionNone || loaded.Data.Len() != 20 {
+		t.Fatalf("loaded %d documents as %q", loaded.Data.Len(), loaded.Options.Compression)
+	}
+}
+
+func TestStatsCompressionRatio(t *testing.T) {
+	DataDir = t.TempDir()
+	plain := NewCollection("plain")
+	fillEvents(t, plain, 200)
+	plain.Commit()
+	packed := NewCollection("packed")
+	packed.Options.Compression = CompressionGzip
+	fillEvents(t, packed, 200)
+	packed.Commit()
+
+	ps := plain.Stats()
+	if ps.CompressionRatio != 1 || ps.DataSize != ps.StorageSize || ps.DataSize == 0 {
+		t.Fatalf("uncompressed stats %+v", ps)
+	}
+	gs := packed.Stats()
+	if gs.Compression != CompressionGzip || gs.CompressionRatio < 5 || gs.StorageSize >= gs.DataSize {
+		t.Fatalf("gzip stats: ratio %.1f, %d of %d bytes", gs.CompressionRatio, gs.StorageSize, gs.DataSize)
+	}
+	if want := float64(gs.DataSize) / float64(gs.StorageSize); gs.CompressionRatio != want {
+		t.Fatalf("ratio %.2f is not data_size/storage_size %.2f", gs.CompressionRatio, want)
+	}
+	if len(gs.Indexes) != 1 || gs.Indexes[0].StorageSize >= gs.Indexes[0].DataSize || gs.Indexes[0].CompressionRatio <= 1 {
+		t.Fatalf("gzip index stats %+v", gs.Indexes)
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for name, want := range map[string]Compression{"": CompressionNone, "none": CompressionNone, "gzip": CompressionGzip} {
+		if got, err := ParseCompression(name); err != nil || got != want {
+			t.Errorf("ParseCompression(%q) = %q, %v", name, got, err)
+		}
+	}
+	if _, err := ParseCompression("zstd"); err == nil {
+		t.Error("unknown compression accepted")
+	}
+}
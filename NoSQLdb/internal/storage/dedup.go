@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DedupField — поле документа с ключом идемпотентности, в коллекцию не сохраняется
+const DedupField = "_dedup"
+
+// DedupWindow — сколько помнить ключи идемпотентности; 0 — не дедуплицировать.
+// Повтор позже окна вставляется заново, поэтому окно должно быть дольше,
+// чем клиент повторяет и досылает пакеты
+var DedupWindow = 10 * time.Minute
+
+func dedupPath(name string) string {
+	return filepath.Join(DataDir, "dedup", name+".json")
+}
+
+// dedupTable — недавние ключи вставок коллекции. Сохраняется вместе с данными
+// коллекции, поэтому окно переживает перезапуск сервера
+type dedupTable struct {
+	keys  map[string]dedupEntry
+	order []dedupExpiry // ключи в порядке вставки, они же в порядке истечения
+}
+
+type dedupEntry struct {
+	id      string // _id документа, сохранённого с этим ключом
+	expires time.Time
+}
+
+type dedupExpiry struct {
+	key     string
+	expires time.Time
+}
+
+// dedupRecord — ключ в файле коллекции
+type dedupRecord struct {
+	Key     string    `json:"key"`
+	ID      string    `json:"id"`
+	Expires time.Time `json:"expires"`
+}
+
+// lookup возвращает _id документа, уже сохранённого с ключом
+func (t *dedupTable) lookup(key string, now time.Time) (string, bool) {
+	entry, ok := t.keys[key]
+	if !ok || !entry.expires.After(now) {
+		return "", false
+	}
+	return entry.id, true
+}
+
+// remember запоминает ключ на DedupWindow
+func (t *dedupTable) remember(key, id string, now time.Time) {
+	t.add(key, id, now.Add(DedupWindow))
+}
+
+func (t *dedupTable) add(key, id string, expires time.Time) {
+	if t.keys == nil {
+		t.keys = make(map[string]dedupEntry)
+	}
+	t.keys[key] = dedupEntry{id: id, expires: expires}
+	t.order = append(t.order, dedupExpiry{key: key, expires: expires})
+}
+
+// expire забывает ключи, чьё окно закончилось
+func (t *dedupTable) expire(now time.Time) {
+	n := 0
+	for n < len(t.order) && !t.order[n].expires.After(now) {
+		k := t.order[n]
+		// ключ мог быть записан заново после истечения, тогда запись новее
+		if entry, ok := t.keys[k.key]; ok && entry.expires.Equal(k.expires) {
+			delete(t.keys, k.key)
+		}
+		n++
+	}
+	if n > 0 {
+		t.order = append(t.order[:0], t.order[n:]...)
+	}
+}
+
+// records — живые на now ключи в порядке истечения
+func (t *dedupTable) records(now time.Time) []dedupRecord {
+	out := make([]dedupRecord, 0, len(t.keys))
+	for _, k := range t.order {
+		entry, ok := t.keys[k.key]
+		if ok && entry.expires.Equal(k.expires) && entry.expires.After(now) {
+			out = append(out, dedupRecord{Key: k.key, ID: entry.id, Expires: entry.expires})
+		}
+	}
+	return out
+}
+
+// saveDedup пишет ключи коллекции в формате и шифровании её данных,
+// вызывается под блокировкой после записи данных: ключ без сохранённого
+// документа пропустил бы повтор, который нужно вставить
+func (c *Collection) saveDedup() error {
+	path := dedupPath(c.Name)
+	records := c.dedup.records(time.Now())
+	if len(records) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove dedup keys: %w", err)
+		}
+		return nil
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dedup keys: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create dedup directory: %w", err)
+	}
+	if _, err := writeEncodedFile(path, data, c.Options.Compression); err != nil {
+		return fmt.Errorf("failed to write dedup keys: %w", err)
+	}
+	return nil
+}
+
+// loadDedup восстанавливает ключи после перезапуска, истёкшие пропускаются
+func (c *Collection) loadDedup() error {
+	data, _, _, err := readEncodedFile(dedupPath(c.Name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read dedup keys: %w", err)
+	}
+	var records []dedupRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("failed to unmarshal dedup keys: %w", err)
+	}
+	now := time.Now()
+	for _, r := range records {
+		if r.Expires.After(now) {
+			c.dedup.add(r.Key, r.ID, r.Expires)
+		}
+	}
+	return nil
+}
+
+// DedupKeys достаёт ключи идемпотентности пакета и убирает их из документов.
+// Ключ документа — поле _dedup, иначе batchID и номер документа в пакете.
+// nil — ключей нет или дедупликация выключена
+func DedupKeys(docs []map[string]any, batchID string) []string {
+	keys := make([]string, len(docs))
+	found := false
+	for i, doc := range docs {
+		if raw, ok := doc[DedupField]; ok {
+			delete(doc, DedupField)
+			keys[i] = fmt.Sprint(raw)
+		} else if batchID != "" {
+			keys[i] = fmt.Sprintf("%s#%d", batchID, i)
+		}
+		found = found || keys[i] != ""
+	}
+	if !found || DedupWindow <= 0 {
+		return nil
+	}
+	return keys
+}
+
+// dedupKey — ключ i-го документа или ""
+func dedupKey(keys []string, i int) string {
+	if keys == nil {
+		return ""
+	}
+	return keys[i]
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInsertManyDeduplicates(t *testing.T) {
+	coll := NewCollection("dedup")
+	batch := func() []map[string]any {
+		return []map[string]any{{"n": 1.0}, {"n": 2.0}, {"n": 3.0, DedupField: "k"}, {"n": 4.0, DedupField: "k"}}
+	}
+
+	docs := batch()
+	first, err := coll.InsertMany(docs, DedupKeys(docs, "batch-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Inserted != 3 || first.Deduplicated != 1 {
+		t.Fatalf("first insert: inserted %d, deduplicated %d, want 3 and 1", first.Inserted, first.Deduplicated)
+	}
+	if first.IDs[3] != first.IDs[2] {
+		t.Fatalf("in-batch duplicate got _id %s, want %s", first.IDs[3], first.IDs[2])
+	}
+	if _, ok := docs[2][DedupField]; ok {
+		t.Fatal("dedup key was stored in the document")
+	}
+
+	// повтор пакета целиком пропускается и возвращает те же _id
+	docs = batch()
+	retry, err := coll.InsertMany(docs, DedupKeys(docs, "batch-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retry.Inserted != 0 || retry.Deduplicated != 4 {
+		t.Fatalf("retry: inserted %d, deduplicated %d, want 0 and 4", retry.Inserted, retry.Deduplicated)
+	}
+	for i := range first.IDs {
+		if retry.IDs[i] != first.IDs[i] {
+			t.Fatalf("retry document %d: _id %s, want %s", i, retry.IDs[i], first.IDs[i])
+		}
+	}
+	if coll.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", coll.Len())
+	}
+
+	// после окна ключи забываются
+	coll.dedup.expire(time.Now().Add(DedupWindow + time.Second))
+	docs = batch()
+	again, err := coll.InsertMany(docs, DedupKeys(docs, "batch-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Inserted != 3 {
+		t.Fatalf("after window: inserted %d, want 3", again.Inserted)
+	}
+}
+
+func TestDedupSurvivesReload(t *testing.T) {
+	DataDir = t.TempDir()
+	coll := NewCollection("dedup")
+	docs := []map[string]any{{"n": 1.0}, {"n": 2.0}}
+	first, err := coll.InsertMany(docs, DedupKeys(docs, "batch-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ключ с истёкшим окном не восстанавливается
+	coll.dedup.add("old", first.IDs[0], time.Now().Add(-time.Second))
+	if err := coll.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadCollection("dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.dedup.lookup("old", time.Now()); ok {
+		t.Fatal("expired key restored")
+	}
+	docs = []map[string]any{{"n": 1.0}, {"n": 2.0}}
+	retry, err := loaded.InsertMany(docs, DedupKeys(docs, "batch-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retry.Inserted != 0 || retry.IDs[1] != first.IDs[1] {
+		t.Fatalf("retry after reload: inserted %d, _id %s, want 0 and %s", retry.Inserted, retry.IDs[1], first.IDs[1])
+	}
+}
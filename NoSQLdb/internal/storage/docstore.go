@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// storeShardBits — число шардов 1<<storeShardBits, шард выбирается по старшим битам хеша
+const storeShardBits = 6
+
+// DocumentStore — документы коллекции, разбитые на шарды со своими блокировками.
+// Чтения и записи в разные шарды не мешают друг другу. Каждый документ хранит
+// цепочку версий, поэтому снимок видит коллекцию на момент своей версии
+type DocumentStore struct {
+	shards [1 << storeShardBits]docShard
+	size   atomic.Int64 // живые документы последней версии
+}
+
+type docShard struct {
+	mu   sync.RWMutex
+	docs *HashMap // id -> *docVersion
+	_    [32]byte // шарды не делят строку кэша
+}
+
+// docVersion — версия документа, видна снимкам с begin <= seq < end
+type docVersion struct {
+	doc   map[string]any
+	begin uint64
+	end   uint64 // 0 — документ не удалён
+	older *docVersion
+}
+
+func (v *docVersion) visibleAt(seq uint64) bool {
+	return v.begin <= seq && (v.end == 0 || v.end > seq)
+}
+
+func NewDocumentStore() *DocumentStore {
+	s := &DocumentStore{}
+	for i := range s.shards {
+		s.shards[i].docs = NewHashMap()
+	}
+	return s
+}
+
+func (s *DocumentStore) shard(hash uint64) *docShard {
+	return &s.shards[hash>>(64-storeShardBits)]
+}
+
+// Put добавляет документ в версии seq; живая версия с тем же id закрывается
+func (s *DocumentStore) Put(id string, doc map[string]any, seq uint64) {
+	hash := hashKey(id)
+	sh := s.shard(hash)
+
+	sh.mu.Lock()
+	var head *docVersion
+	if val, ok := sh.docs.get(hash, id); ok {
+		head = val.(*docVersion)
+	}
+	replaced := head != nil && head.end == 0
+	if replaced {
+		head.end = seq
+	}
+	sh.docs.put(hash, id, &docVersion{doc: doc, begin: seq, older: head})
+	sh.mu.Unlock()
+
+	if !replaced {
+		s.size.Add(1)
+	}
+}
+
+// Get возвращает последнюю живую версию документа
+func (s *DocumentStore) Get(id string) (map[string]any, bool) {
+	head := s.head(id)
+	if head == nil || head.end != 0 {
+		return nil, false
+	}
+	return head.doc, true
+}
+
+// GetAt возвращает документ, каким его видит снимок seq
+func (s *DocumentStore) GetAt(id string, seq uint64) (map[string]any, bool) {
+	hash := hashKey(id)
+	sh := s.shard(hash)
+
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	val, ok := sh.docs.get(hash, id)
+	if !ok {
+		return nil, false
+	}
+	for v := val.(*docVersion); v != nil; v = v.older {
+		if v.visibleAt(seq) {
+			return v.doc, true
+		}
+	}
+	return nil, false
+}
+
+func (s *DocumentStore) head(id string) *docVersion {
+	hash := hashKey(id)
+	sh := s.shard(hash)
+
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	if val, ok := sh.docs.get(hash, id); ok {
+		return val.(*docVersion)
+	}
+	return nil
+}
+
+// Remove помечает документ удалённым в версии seq. Старые снимки его ещё видят,
+// запись убирает Vacuum
+func (s *DocumentStore) Remove(id string, seq uint64) bool {
+	hash := hashKey(id)
+	sh := s.shard(hash)
+
+	sh.mu.Lock()
+	removed := false
+	if val, ok := sh.docs.get(hash, id); ok {
+		if head := val.(*docVersion); head.end == 0 {
+			head.end = seq
+			removed = true
+		}
+	}
+	sh.mu.Unlock()
+
+	if removed {
+		s.size.Add(-1)
+	}
+	return removed
+}
+
+// Vacuum удаляет версии документа, закрытые не позже horizon:
+// ни один активный снимок их уже не видит
+func (s *DocumentStore) Vacuum(id string, horizon uint64) {
+	hash := hashKey(id)
+	sh := s.shard(hash)
+
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	val, ok := sh.docs.get(hash, id)
+	if !ok {
+		return
+	}
+
+	// под блокировкой шарда цепочку никто не читает, её можно менять на месте
+	head := val.(*docVersion)
+	var prev *docVersion
+	for v := head; v != nil; v = v.older {
+		if v.end == 0 || v.end > horizon {
+			prev = v
+			continue
+		}
+		if prev == nil {
+			head = v.older
+		} else {
+			prev.older = v.older
+		}
+	}
+	if head == nil {
+		sh.docs.remove(hash, id)
+		return
+	}
+	sh.docs.put(hash, id, head)
+}
+
+// Len — число документов последней версии
+func (s *DocumentStore) Len() int {
+	return int(s.size.Load())
+}
+
+// Range обходит живые документы последней версии по шардам, не копируя коллекцию.
+// Пока fn работает, текущий шард заблокирован на чтение, поэтому fn не должен
+// менять хранилище. fn возвращает false, чтобы остановить обход
+func (s *DocumentStore) Range(fn func(id string, doc map[string]any) bool) {
+	s.rangeVersions(func(id string, head *docVersion) bool {
+		return head.end != 0 || fn(id, head.doc)
+	})
+}
+
+// RangeAt обходит документы, которые видит снимок seq
+func (s *DocumentStore) RangeAt(seq uint64, fn func(id string, doc map[string]any) bool) {
+	s.rangeVersions(func(id string, head *docVersion) bool {
+		for v := head; v != nil; v = v.older {
+			if v.visibleAt(seq) {
+				return fn(id, v.doc)
+			}
+		}
+		return true
+	})
+}
+
+func (s *DocumentStore) rangeVersions(fn func(id string, head *docVersion) bool) {
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		more := sh.docs.Range(func(key string, value any) bool {
+			return fn(key, value.(*docVersion))
+		})
+		sh.mu.RUnlock()
+		if !more {
+			return
+		}
+	}
+}
+
+// Items копирует документы последней версии в map, нужен для сериализации в файл
+func (s *DocumentStore) Items() map[string]any {
+	items := make(map[string]any, s.Len())
+	s.Range(func(id string, doc map[string]any) bool {
+		items[id] = doc
+		return true
+	})
+	return items
+}
@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Сравнение DocumentStore с прежним хранилищем: HashMap с полиномиальным
+// хешем под общим RWMutex коллекции и All() через копию в map.
+// Insert и Scan обрабатывают 1M документов за операцию, их хватает запустить пару раз:
+//
+//	go test ./internal/storage -run '^$' -bench 'Insert|Scan' -benchtime 3x -benchmem
+//	go test ./internal/storage -run '^$' -bench 'Get|Parallel' -cpu 1,4,8
+
+const benchDocs = 1_000_000
+
+// legacyHashMap — прежняя реализация HashMap, оставлена для сравнения
+type legacyHashMap struct {
+	Buckets  []*Pair
+	Size     int
+	Capacity int
+}
+
+func newLegacyHashMap() *legacyHashMap {
+	return &legacyHashMap{Buckets: make([]*Pair, initialCapacity), Capacity: initialCapacity}
+}
+
+func (h *legacyHashMap) Hash(key string) int {
+	var hash uint32
+	const prime uint32 = 3
+	for i := 0; i < len(key); i++ {
+		hash = hash*prime + uint32(key[i])
+	}
+	return int(hash) % h.Capacity
+}
+
+func (h *legacyHashMap) Put(key string, value any) {
+	if float64(h.Size)/float64(h.Capacity) >= loadFactor {
+		h.resize()
+	}
+	index := h.Hash(key)
+	for current := h.Buckets[index]; current != nil; current = current.Next {
+		if current.Key == key {
+			current.Value = value
+			return
+		}
+	}
+	h.Buckets[index] = &Pair{Key: key, Value: value, Next: h.Buckets[index]}
+	h.Size++
+}
+
+func (h *legacyHashMap) Get(key string) (any, bool) {
+	for current := h.Buckets[h.Hash(key)]; current != nil; current = current.Next {
+		if current.Key == key {
+			return current.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (h *legacyHashMap) resize() {
+	oldBuckets := h.Buckets
+	h.Capacity *= 2
+	h.Buckets = make([]*Pair, h.Capacity)
+	for _, head := range oldBuckets {
+		for current := head; current != nil; {
+			next := current.Next
+			index := h.Hash(current.Key)
+			current.Next = h.Buckets[index]
+			h.Buckets[index] = current
+			current = next
+		}
+	}
+}
+
+func (h *legacyHashMap) Items() map[string]any {
+	items := make(map[string]any)
+	for _, head := range h.Buckets {
+		for current := head; current != nil; current = current.Next {
+			items[current.Key] = current.Value
+		}
+	}
+	return items
+}
+
+// legacyStore — прежний путь коллекции: один RWMutex на всё
+type legacyStore struct {
+	mu   sync.RWMutex
+	data *legacyHashMap
+}
+
+func (s *legacyStore) Put(id string, doc map[string]any) {
+	s.mu.Lock()
+	s.data.Put(id, doc)
+	s.mu.Unlock()
+}
+
+func (s *legacyStore) Get(id string) (map[string]any, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.data.Get(id)
+	if !ok {
+		return nil, false
+	}
+	doc, ok := v.(map[string]any)
+	return doc, ok
+}
+
+func (s *legacyStore) All() []map[string]any {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items := s.data.Items()
+	docs := make([]map[string]any, 0, len(items))
+	for _, v := range items {
+		if doc, ok := v.(map[string]any); ok {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+var (
+	benchIDs     []string
+	benchLegacy  *legacyStore
+	benchSharded *DocumentStore
+	benchOnce    sync.Once
+)
+
+// benchFixtures строит оба хранилища на benchDocs документах один раз на запуск
+func benchFixtures() {
+	benchOnce.Do(func() {
+		benchIDs = make([]string, benchDocs)
+		benchLegacy = &legacyStore{data: newLegacyHashMap()}
+		benchSharded = NewDocumentStore()
+		for i := range benchIDs {
+			// тот же вид, что у generateID: близкие по значению строки
+			id := fmt.Sprintf("%d-%d", 1792373582249557091+int64(i)*7919, i%1000000)
+			benchIDs[i] = id
+			doc := map[string]any{"_id": id, "n": float64(i)}
+			benchLegacy.Put(id, doc)
+			benchSharded.Put(id, doc, 0)
+		}
+	})
+}
+
+func BenchmarkStoreInsert1M(b *testing.B) {
+	benchFixtures()
+	doc := map[string]any{"n": 1.0}
+
+	b.Run("legacy", func(b *testing.B) {
+		for b.Loop() {
+			s := &legacyStore{data: newLegacyHashMap()}
+			for _, id := range benchIDs {
+				s.Put(id, doc)
+			}
+		}
+	})
+	b.Run("sharded", func(b *testing.B) {
+		for b.Loop() {
+			s := NewDocumentStore()
+			for _, id := range benchIDs {
+				s.Put(id, doc, 0)
+			}
+		}
+	})
+}
+
+func BenchmarkStoreGet1M(b *testing.B) {
+	benchFixtures()
+
+	b.Run("legacy", func(b *testing.B) {
+		i := 0
+		for b.Loop() {
+			benchLegacy.Get(benchIDs[i%benchDocs])
+			i += 7
+		}
+	})
+	b.Run("sharded", func(b *testing.B) {
+		i := 0
+		for b.Loop() {
+			benchSharded.Get(benchIDs[i%benchDocs])
+			i += 7
+		}
+	})
+}
+
+func BenchmarkStoreScan1M(b *testing.B) {
+	benchFixtures()
+
+	b.Run("legacy", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			n := 0
+			for _, doc := range benchLegacy.All() {
+				if doc["n"].(float64) >= 0 {
+					n++
+				}
+			}
+		}
+	})
+	b.Run("sharded", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			n := 0
+			benchSharded.Range(func(_ string, doc map[string]any) bool {
+				if doc["n"].(float64) >= 0 {
+					n++
+				}
+				return true
+			})
+		}
+	})
+}
+
+// BenchmarkStoreParallel1M — 90% чтений и 10% записей из всех горутин
+func BenchmarkStoreParallel1M(b *testing.B) {
+	benchFixtures()
+	doc := map[string]any{"n": 1.0}
+
+	run := func(b *testing.B, get func(string), put func(string)) {
+		var seq atomic.Int64
+		b.RunParallel(func(pb *testing.PB) {
+			i := int(seq.Add(1)) * 104729
+			for pb.Next() {
+				id := benchIDs[i%benchDocs]
+				if i%10 == 0 {
+					put(id)
+				} else {
+					get(id)
+				}
+				i += 13
+			}
+		})
+	}
+
+	b.Run("legacy", func(b *testing.B) {
+		run(b, func(id string) { benchLegacy.Get(id) }, func(id string) { benchLegacy.Put(id, doc) })
+	})
+	b.Run("sharded", func(b *testing.B) {
+		run(b, func(id string) { benchSharded.Get(id) }, func(id string) { benchSharded.Put(id, doc, 0) })
+	})
+}
+
+// BenchmarkHashDistribution сообщает длину самой длинной цепочки на benchDocs ключах
+func BenchmarkHashDistribution(b *testing.B) {
+	benchFixtures()
+
+	longest := func(buckets []*Pair) int {
+		maxLen := 0
+		for _, head := range buckets {
+			n := 0
+			for current := head; current != nil; current = current.Next {
+				n++
+			}
+			maxLen = max(maxLen, n)
+		}
+		return maxLen
+	}
+
+	for b.Loop() {
+		shardMax := 0
+		for i := range benchSharded.shards {
+			shardMax = max(shardMax, longest(benchSharded.shards[i].docs.Buckets))
+		}
+		b.ReportMetric(float64(longest(benchLegacy.data.Buckets)), "legacy-max-chain")
+		b.ReportMetric(float64(shardMax), "sharded-max-chain")
+	}
+}
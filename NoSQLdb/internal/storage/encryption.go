@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Шифрование на диске: файлы данных, индексов и записи журналов индексов
+// шифруются AES-256-GCM после сжатия. Зашифрованный файл:
+//
+//	"NSQE" | версия | id ключа (8 байт) | nonce (12 байт) | шифротекст с тегом
+//
+// Первые 13 байт — дополнительные данные GCM, подменить id ключа нельзя.
+// По id файл расшифровывается своим ключом, поэтому во время смены ключа
+// файлы под старым и новым ключом читаются одновременно
+
+var sealMagic = []byte("NSQE")
+
+const (
+	sealVersion = 1
+	keyIDSize   = 8
+	sealHeader  = 4 + 1 + keyIDSize // magic, версия, id ключа
+	keySize     = 32                // AES-256
+)
+
+var (
+	// ErrNoKey — файл зашифрован, а ключи не заданы
+	ErrNoKey = errors.New("file is encrypted, but no encryption key is configured")
+	// ErrUnknownKey — файл зашифрован ключом, которого нет среди заданных
+	ErrUnknownKey = errors.New("file is encrypted with a key that is not configured")
+	// ErrDecrypt — ключ подходит по id, но данные не прошли проверку тега
+	ErrDecrypt = errors.New("decryption failed: file is corrupted")
+)
+
+// KeyID — отпечаток ключа, пишется в заголовок файла
+type KeyID [keyIDSize]byte
+
+func (id KeyID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+type encryptionKey struct {
+	id   KeyID
+	aead cipher.AEAD
+}
+
+// KeyRing — ключи шифрования: активным шифруются новые файлы, остальные
+// нужны, чтобы читать файлы до окончания смены ключа
+type KeyRing struct {
+	active *encryptionKey // nil — новые файлы пишутся без шифрования
+	keys   map[KeyID]*encryptionKey
+}
+
+// ActiveID — id ключа, которым шифруются новые файлы; ok=false — шифрование выключено
+func (r *KeyRing) ActiveID() (KeyID, bool) {
+	if r == nil || r.active == nil {
+		return KeyID{}, false
+	}
+	return r.active.id, true
+}
+
+// Len — число ключей
+func (r *KeyRing) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.keys)
+}
+
+// keyRing — ключи сервера, nil — шифрование не настроено
+var keyRing atomic.Pointer[KeyRing]
+
+// SetKeyRing задаёт ключи; файлы, записанные после вызова, шифруются новым активным ключом
+func SetKeyRing(r *KeyRing) {
+	keyRing.Store(r)
+}
+
+// CurrentKeyRing возвращает заданные ключи, nil — шифрование не настроено
+func CurrentKeyRing() *KeyRing {
+	return keyRing.Load()
+}
+
+// KeySource — откуда берутся ключи: файл (по ключу в строке) или значение
+// переменной окружения (ключи через запятую). Первый ключ — активный,
+// "none" на его месте выключает шифрование новых файлов
+type KeySource struct {
+	File string
+	Keys string
+}
+
+// EncryptionKeys — источник ключей сервера, rotate_key перечитывает из него файл
+var EncryptionKeys KeySource
+
+// LoadKeyRing читает ключи из источника; без файла и ключей возвращает nil
+func LoadKeyRing(src KeySource) (*KeyRing, error) {
+	var entries []string
+	switch {
+	case src.File != "" && src.Keys != "":
+		return nil, errors.New("set either an encryption key file or encryption keys, not both")
+	case src.File != "":
+		data, err := os.ReadFile(src.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				entries = append(entries, line)
+			}
+		}
+	case src.Keys != "":
+		for _, entry := range strings.Split(src.Keys, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+	default:
+		return nil, nil
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no encryption keys found")
+	}
+	return parseKeyRing(entries)
+}
+
+func parseKeyRing(entries []string) (*KeyRing, error) {
+	r := &KeyRing{keys: make(map[KeyID]*encryptionKey)}
+	for i, entry := range entries {
+		if i == 0 && entry == "none" {
+			continue
+		}
+		raw, err := decodeKey(entry)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i+1, err)
+		}
+		key, err := newEncryptionKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i+1, err)
+		}
+		if i == 0 {
+			r.active = key
+		}
+		r.keys[key.id] = key
+	}
+	return r, nil
+}
+
+// decodeKey принимает 32 байта в hex (64 символа) или base64
+func decodeKey(entry string) ([]byte, error) {
+	if raw, err := hex.DecodeString(entry); err == nil && len(raw) == keySize {
+		return raw, nil
+	}
+	if raw, err := base64.StdEncoding.DecodeString(entry); err == nil && len(raw) == keySize {
+		return raw, nil
+	}
+	return nil, fmt.Errorf("key must be %d bytes in hex or base64", keySize)
+}
+
+func newEncryptionKey(raw []byte) (*encryptionKey, error) {
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	k := &encryptionKey{aead: aead}
+	sum := sha256.Sum256(append([]byte("nosqldb key id\x00"), raw...))
+	copy(k.id[:], sum[:])
+	return k, nil
+}
+
+// isSealed — данные начинаются с заголовка зашифрованного файла
+func isSealed(raw []byte) bool {
+	return len(raw) >= sealHeader && bytes.HasPrefix(raw, sealMagic) && raw[4] == sealVersion
+}
+
+// sealedKeyID — id ключа из заголовка; ok=false — данные не зашифрованы
+func sealedKeyID(raw []byte) (KeyID, bool) {
+	var id KeyID
+	if !isSealed(raw) {
+		return id, false
+	}
+	copy(id[:], raw[5:sealHeader])
+	return id, true
+}
+
+// seal шифрует данные активным ключом; без него возвращает их как есть
+func seal(data []byte) ([]byte, error) {
+	r := CurrentKeyRing()
+	if r == nil || r.active == nil {
+		return data, nil
+	}
+	aead := r.active.aead
+	out := make([]byte, sealHeader+aead.NonceSize(), sealHeader+aead.NonceSize()+len(data)+aead.Overhead())
+	copy(out, sealMagic)
+	out[4] = sealVersion
+	copy(out[5:sealHeader], r.active.id[:])
+	nonce := out[sealHeader:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(out, nonce, data, out[:sealHeader]), nil
+}
+
+// unseal расшифровывает данные ключом из заголовка; незашифрованные возвращает как есть
+func unseal(raw []byte) ([]byte, error) {
+	id, ok := sealedKeyID(raw)
+	if !ok {
+		return raw, nil
+	}
+	key, err := lookupKey(id)
+	if err != nil {
+		return nil, err
+	}
+	nonceEnd := sealHeader + key.aead.NonceSize()
+	if len(raw) < nonceEnd+key.aead.Overhead() {
+		return nil, ErrDecrypt
+	}
+	data, err := key.aead.Open(nil, raw[sealHeader:nonceEnd], raw[nonceEnd:], raw[:sealHeader])
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return data, nil
+}
+
+func lookupKey(id KeyID) (*encryptionKey, error) {
+	r := CurrentKeyRing()
+	if r == nil {
+		return nil, ErrNoKey
+	}
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w (key id %s)", ErrUnknownKey, id)
+	}
+	return key, nil
+}
+
+// sealRecord шифрует пачку строк журнала индекса в одну строку base64;
+// без активного ключа пачка пишется как есть
+func sealRecord(chunk []byte) ([]byte, error) {
+	sealed, err := seal(chunk)
+	if err != nil || !isSealed(sealed) {
+		return sealed, err
+	}
+	record := make([]byte, base64.StdEncoding.EncodedLen(len(sealed))+1)
+	base64.StdEncoding.Encode(record, sealed)
+	record[len(record)-1] = '\n'
+	return record, nil
+}
+
+// unsealRecord расшифровывает строку журнала, записанную sealRecord
+func unsealRecord(line []byte) ([]byte, error) {
+	sealed := make([]byte, base64.StdEncoding.DecodedLen(len(line)))
+	n, err := base64.StdEncoding.Decode(sealed, line)
+	if err != nil || !isSealed(sealed[:n]) {
+		return nil, ErrDecrypt
+	}
+	return unseal(sealed[:n])
+}
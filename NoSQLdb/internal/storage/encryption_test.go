@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	keyA = strings.Repeat("a1", 32)
+	keyB = strings.Repeat("b2", 32)
+)
+
+// useKeys задаёт ключи на время теста
+func useKeys(t *testing.T, keys string) {
+	t.Helper()
+	r, err := LoadKeyRing(KeySource{Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeyRing(r)
+	t.Cleanup(func() { SetKeyRing(nil) })
+}
+
+// writeSecrets сохраняет коллекцию с индексом и дописанным журналом индекса
+func writeSecrets(t *testing.T) {
+	t.Helper()
+	coll := NewCollection("secrets")
+	coll.Insert(map[string]any{"user": "root", "cmd": "cat /etc/shadow"})
+	if err := coll.CreateIndex("user", 4); err != nil {
+		t.Fatal(err)
+	}
+	coll.Insert(map[string]any{"user": "alice", "cmd": "sudo su"})
+	if err := coll.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := coll.SaveAllIndexes(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncryptedFilesHaveNoPlaintext(t *testing.T) {
+	DataDir = t.TempDir()
+	useKeys(t, keyA)
+	writeSecrets(t)
+
+	files, _ := storedFiles()
+	if len(files) != 3 {
+		t.Fatalf("stored files %v, want data, index and index log", files)
+	}
+	for _, path := range files {
+		raw, _ := os.ReadFile(path)
+		for _, secret := range []string{"root", "shadow", "alice", "user"} {
+			if bytes.Contains(raw, []byte(secret)) {
+				t.Fatalf("%s contains %q in plaintext", filepath.Base(path), secret)
+			}
+		}
+	}
+
+	coll, err := LoadCollection("secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coll.Data.Len() != 2 {
+		t.Fatalf("loaded %d documents, want 2", coll.Data.Len())
+	}
+	// журнал индекса тоже расшифровывается
+	btree := reloadIndexOf(t, "secrets", "user")
+	if ids := btree.Search(btree.Key("alice")); len(ids) != 1 {
+		t.Fatalf("alice from the index log: %d entries, want 1", len(ids))
+	}
+}
+
+func TestWrongKeyIsRefused(t *testing.T) {
+	DataDir = t.TempDir()
+	useKeys(t, keyA)
+	writeSecrets(t)
+
+	useKeys(t, keyB)
+	if _, err := CheckEncryption(); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("check with another key: %v, want ErrUnknownKey", err)
+	}
+	if _, err := LoadCollection("secrets"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("load with another key: %v, want ErrUnknownKey", err)
+	}
+
+	SetKeyRing(nil)
+	if _, err := CheckEncryption(); !errors.Is(err, ErrNoKey) {
+		t.Fatalf("check without keys: %v, want ErrNoKey", err)
+	}
+
+	// испорченный файл не загружается, даже если ключ верный
+	useKeys(t, keyA)
+	raw, _ := os.ReadFile(dataPath("secrets"))
+	raw[len(raw)-1] ^= 1
+	os.WriteFile(dataPath("secrets"), raw, 0644)
+	if _, err := LoadCollection("secrets"); !errors.Is(err, ErrDecrypt) {
+		t.Fatalf("load of a corrupted file: %v, want ErrDecrypt", err)
+	}
+}
+
+func TestRekeyMovesFilesToNewKey(t *testing.T) {
+	DataDir = t.TempDir()
+	writeSecrets(t) // без шифрования
+
+	useKeys(t, keyA)
+	if stale, err := CheckEncryption(); err != nil || stale != 3 {
+		t.Fatalf("plaintext files: stale=%d err=%v, want 3", stale, err)
+	}
+
+	// новый ключ первым, прежний остаётся для чтения
+	useKeys(t, keyB+","+keyA)
+	m := NewManager()
+	defer m.Stop()
+	rekey, err := m.StartRekey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-rekey.Done()
+	if p := rekey.Progress(); p.State != RekeyDone || p.Rewritten != 1 || p.Stale != 0 {
+		t.Fatalf("rekey progress %+v", p)
+	}
+
+	useKeys(t, keyB)
+	if stale, err := CheckEncryption(); err != nil || stale != 0 {
+		t.Fatalf("after rekey: stale=%d err=%v", stale, err)
+	}
+	btree := reloadIndexOf(t, "secrets", "user")
+	if ids := btree.Search(btree.Key("alice")); len(ids) != 1 {
+		t.Fatalf("alice after rekey: %d entries, want 1", len(ids))
+	}
+}
+
+func TestLoadKeyRing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	os.WriteFile(path, []byte("# активный\n"+keyB+"\n\n"+keyA+"\n"), 0600)
+	r, err := LoadKeyRing(KeySource{File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := newEncryptionKey(mustHex(t, keyB))
+	if id, ok := r.ActiveID(); !ok || id != want.id || r.Len() != 2 {
+		t.Fatalf("active %s (%v), %d keys", id, ok, r.Len())
+	}
+
+	if r, err := LoadKeyRing(KeySource{Keys: "none," + keyA}); err != nil || r.Len() != 1 {
+		t.Fatalf("none as active key: %v", err)
+	} else if _, ok := r.ActiveID(); ok {
+		t.Fatal("none must disable encryption of new files")
+	}
+	for _, bad := range []string{"short", keyA[:62], keyA + "," + "zz"} {
+		if _, err := LoadKeyRing(KeySource{Keys: bad}); err == nil {
+			t.Fatalf("key %q accepted", bad)
+		}
+	}
+	if r, err := LoadKeyRing(KeySource{}); r != nil || err != nil {
+		t.Fatalf("no keys: %v %v", r, err)
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
@@ -1,14 +1,27 @@
 package storage
 
-const initialCapacity = 16
+import "hash/maphash"
+
+const initialCapacity = 16 // всегда степень двойки
 const loadFactor = 0.75
 
+// hashSeed выбирается при старте, поэтому подобрать ключи с коллизиями заранее нельзя
+var hashSeed = maphash.MakeSeed()
+
+// hashKey — 64-битный хеш ключа. В отличие от полиномиального хеша,
+// близкие строки (последовательные _id) равномерно расходятся по корзинам
+func hashKey(key string) uint64 {
+	return maphash.String(hashSeed, key)
+}
+
 type Pair struct {
 	Key   string
+	Hash  uint64 // хеш ключа, чтобы не пересчитывать его при resize
 	Value any
 	Next  *Pair
 }
 
+// HashMap — хеш-таблица с цепочками. Не потокобезопасна, блокировки — у владельца
 type HashMap struct {
 	Buckets  []*Pair
 	Size     int
@@ -23,68 +36,62 @@ func NewHashMap() *HashMap {
 	}
 }
 
-// hash (полиномиальная хеш-функция)
-func (h *HashMap) Hash(key string) int {
-	var hash uint32
-	const prime uint32 = 3
-
-	for i := 0; i < len(key); i++ {
-		hash = hash*prime + uint32(key[i])
-	}
+// bucket — индекс корзины по младшим битам хеша
+func (h *HashMap) bucket(hash uint64) int {
+	return int(hash & uint64(h.Capacity-1))
+}
 
-	if h.Capacity == 0 {
-		return 0
-	}
-	return int(hash) % h.Capacity
+func (h *HashMap) Put(key string, value any) bool {
+	return h.put(hashKey(key), key, value)
 }
 
-func (h *HashMap) Put(key string, value any) {
+// put добавляет или заменяет значение, возвращает true для нового ключа
+func (h *HashMap) put(hash uint64, key string, value any) bool {
 	if float64(h.Size)/float64(h.Capacity) >= loadFactor {
 		h.resize()
 	}
 
-	index := h.Hash(key)
-	current := h.Buckets[index]
-
-	for current != nil {
-		if current.Key == key {
+	index := h.bucket(hash)
+	for current := h.Buckets[index]; current != nil; current = current.Next {
+		if current.Hash == hash && current.Key == key {
 			current.Value = value
-			return
+			return false
 		}
-		current = current.Next
 	}
 
-	newPair := &Pair{
+	h.Buckets[index] = &Pair{
 		Key:   key,
+		Hash:  hash,
 		Value: value,
 		Next:  h.Buckets[index],
 	}
-
-	h.Buckets[index] = newPair
 	h.Size++
+	return true
 }
 
 func (h *HashMap) Get(key string) (any, bool) {
-	index := h.Hash(key)
-	current := h.Buckets[index]
+	return h.get(hashKey(key), key)
+}
 
-	for current != nil {
-		if current.Key == key {
+func (h *HashMap) get(hash uint64, key string) (any, bool) {
+	for current := h.Buckets[h.bucket(hash)]; current != nil; current = current.Next {
+		if current.Hash == hash && current.Key == key {
 			return current.Value, true
 		}
-		current = current.Next
 	}
-
 	return nil, false
 }
 
 func (h *HashMap) Remove(key string) bool {
-	index := h.Hash(key)
-	current := h.Buckets[index]
+	return h.remove(hashKey(key), key)
+}
+
+func (h *HashMap) remove(hash uint64, key string) bool {
+	index := h.bucket(hash)
 	var prev *Pair
 
-	for current != nil {
-		if current.Key == key {
+	for current := h.Buckets[index]; current != nil; current = current.Next {
+		if current.Hash == hash && current.Key == key {
 			if prev == nil {
 				h.Buckets[index] = current.Next
 			} else {
@@ -94,25 +101,22 @@ func (h *HashMap) Remove(key string) bool {
 			return true
 		}
 		prev = current
-		current = current.Next
 	}
 
 	return false
 }
 
 func (h *HashMap) resize() {
-
 	oldBuckets := h.Buckets
 
-	newCapacity := h.Capacity * 2
-	h.Buckets = make([]*Pair, newCapacity)
-	h.Capacity = newCapacity
+	h.Capacity *= 2
+	h.Buckets = make([]*Pair, h.Capacity)
 
 	for _, head := range oldBuckets {
 		current := head
 		for current != nil {
 			next := current.Next
-			newIndex := h.Hash(current.Key)
+			newIndex := h.bucket(current.Hash)
 			current.Next = h.Buckets[newIndex]
 			h.Buckets[newIndex] = current
 
@@ -121,15 +125,23 @@ func (h *HashMap) resize() {
 	}
 }
 
-func (h *HashMap) Items() map[string]any {
-	allItems := make(map[string]any)
+// Range обходит пары без копирования; fn возвращает false, чтобы остановиться
+func (h *HashMap) Range(fn func(key string, value any) bool) bool {
 	for _, head := range h.Buckets {
-		current := head
-		for current != nil {
-			allItems[current.Key] = current.Value
-			current = current.Next
+		for current := head; current != nil; current = current.Next {
+			if !fn(current.Key, current.Value) {
+				return false
+			}
 		}
 	}
+	return true
+}
 
+func (h *HashMap) Items() map[string]any {
+	allItems := make(map[string]any, h.Size)
+	h.Range(func(key string, value any) bool {
+		allItems[key] = value
+		return true
+	})
 	return allItems
 }
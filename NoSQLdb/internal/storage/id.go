@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sync"
+	"time"
+)
+
+// IDField — поле с идентификатором документа
+const IDField = "_id"
+
+// ErrDuplicateID — документ с таким _id уже есть в коллекции
+var ErrDuplicateID = errors.New("duplicate _id")
+
+// NodeID — номер узла в сгенерированных _id, задаётся из main (DB_NODE_ID).
+// По умолчанию берётся из имени хоста
+var NodeID = defaultNodeID()
+
+// maxIDCounter — сколько _id помещается в одну миллисекунду (6 hex-цифр)
+const maxIDCounter = 1<<24 - 1
+
+// idGenerator выдаёт _id вида <миллисекунды:13>-<узел:4 hex>-<счётчик:6 hex>.
+// Строки одной длины, поэтому сравнение строк совпадает с порядком вставки
+type idGenerator struct {
+	mu      sync.Mutex
+	lastMS  int64
+	counter uint32
+}
+
+var ids idGenerator
+
+// next возвращает следующий _id; если часы ушли назад, время не уменьшается
+func (g *idGenerator) next(now time.Time) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	ms := now.UnixMilli()
+	if ms > g.lastMS {
+		g.lastMS, g.counter = ms, 0
+	} else if g.counter++; g.counter > maxIDCounter {
+		// счётчик миллисекунды кончился — занимаем следующую
+		g.lastMS, g.counter = g.lastMS+1, 0
+	}
+	return fmt.Sprintf("%013d-%04x-%06x", g.lastMS, NodeID, g.counter)
+}
+
+func generateID() string {
+	return ids.next(time.Now())
+}
+
+// isGeneratedID — _id в формате idGenerator; только такие идут по порядку вставки
+func isGeneratedID(id string) bool {
+	if len(id) != 25 || id[13] != '-' || id[18] != '-' {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case i == 13 || i == 18:
+		case i < 13 && c >= '0' && c <= '9':
+		case i > 13 && (c >= '0' && c <= '9' || c >= 'a' && c <= 'f'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func defaultNodeID() uint16 {
+	host, err := os.Hostname()
+	if err != nil {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(host))
+	return uint16(h.Sum32())
+}
+
+// documentID возвращает _id, заданный клиентом, или "" если его нет
+func documentID(doc map[string]any) (string, error) {
+	raw, ok := doc[IDField]
+	if !ok {
+		return "", nil
+	}
+	id, ok := raw.(string)
+	if !ok || id == "" {
+		return "", fmt.Errorf("_id must be a non-empty string, got %v", raw)
+	}
+	return id, nil
+}
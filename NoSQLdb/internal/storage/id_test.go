@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIDGeneratorMonotonic(t *testing.T) {
+	var g idGenerator
+	base := time.UnixMilli(1_700_000_000_000)
+
+	// время идёт вперёд, стоит на месте и уходит назад — _id всё равно растут
+	clock := []time.Time{base, base, base.Add(-time.Second), base.Add(time.Millisecond), base}
+	prev := ""
+	for i, now := range clock {
+		id := g.next(now)
+		if len(id) != 25 {
+			t.Fatalf("id %q has length %d, want 25", id, len(id))
+		}
+		if id <= prev {
+			t.Fatalf("step %d: id %q is not greater than %q", i, id, prev)
+		}
+		prev = id
+	}
+
+	// переполнение счётчика переносит _id в следующую миллисекунду
+	g.counter = maxIDCounter
+	id := g.next(base)
+	if id <= prev {
+		t.Fatalf("after counter overflow id %q is not greater than %q", id, prev)
+	}
+}
+
+func TestInsertManyRejectsDuplicateIDs(t *testing.T) {
+	coll := NewCollection("ids")
+	if _, err := coll.Insert(map[string]any{"_id": "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, batch := range [][]map[string]any{
+		{{"_id": "b"}, {"_id": "a"}},
+		{{"_id": "c"}, {"_id": "c"}},
+		{{"_id": 5.0}},
+	} {
+		if _, err := coll.InsertMany(batch, nil); err == nil {
+			t.Fatalf("batch %v: expected an error", batch)
+		}
+	}
+	if coll.Len() != 1 {
+		t.Fatalf("rejected batches inserted documents: Len = %d", coll.Len())
+	}
+
+	result, err := coll.InsertMany([]map[string]any{{"_id": "b"}, {"n": 1.0}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IDs[0] != "b" || result.IDs[1] == "" {
+		t.Fatalf("unexpected ids %v", result.IDs)
+	}
+}
+
+func TestIsGeneratedID(t *testing.T) {
+	if id := generateID(); !isGeneratedID(id) {
+		t.Fatalf("generated _id %s not recognized", id)
+	}
+	for _, id := range []string{"mine", "1", "1792375044427-c22c-00000g", "1792375044427-C22C-000001", "1792375044427_c22c_000001"} {
+		if isGeneratedID(id) {
+			t.Errorf("%q recognized as a generated _id", id)
+		}
+	}
+}
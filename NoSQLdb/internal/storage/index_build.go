@@ -0,0 +1,334 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nosql_db/internal/index"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Фоновая постройка индекса не держит блокировку писателя, пока обходит
+// документы и пишет файл индекса:
+//  1. в очереди коллекции: снимок документов и начало записи изменений поля;
+//  2. без блокировок: дерево строится по снимку и пишется во временный файл;
+//  3. в очереди коллекции: изменения, сделанные во время постройки, применяются
+//     к дереву и дописываются в журнал индекса, файл переименовывается,
+//     индекс публикуется для снимков читателей
+
+// IndexBuildState — стадия фоновой постройки
+type IndexBuildState string
+
+const (
+	BuildRunning  IndexBuildState = "running"
+	BuildDone     IndexBuildState = "done"
+	BuildFailed   IndexBuildState = "failed"
+	BuildCanceled IndexBuildState = "canceled"
+)
+
+// ErrBuildCanceled — постройка отменена
+var ErrBuildCanceled = errors.New("index build canceled")
+
+// buildCheckEvery — как часто обход снимка проверяет отмену
+const buildCheckEvery = 1024
+
+// IndexBuild — фоновая постройка одного индекса
+type IndexBuild struct {
+	Collection string
+	Field      string
+	Kind       index.KeyKind
+	Started    time.Time
+
+	order       int
+	compression Compression
+	total       int
+	processed   atomic.Int64
+	ctx         context.Context
+	cancel      context.CancelFunc
+	done        chan struct{}
+
+	snap    *Snapshot
+	tree    *index.BTree
+	usage   fileUsage
+	pending []indexOp // изменения поля после снимка, пишутся под блокировкой коллекции
+
+	mu       sync.Mutex
+	state    IndexBuildState
+	err      error
+	finished time.Time
+}
+
+// IndexBuildProgress — состояние постройки для admin-команды
+type IndexBuildProgress struct {
+	Collection string
+	Field      string
+	Kind       index.KeyKind
+	State      IndexBuildState
+	Processed  int
+	Total      int
+	Elapsed    time.Duration
+	Error      string
+}
+
+// Progress возвращает текущее состояние постройки
+func (b *IndexBuild) Progress() IndexBuildProgress {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := IndexBuildProgress{
+		Collection: b.Collection,
+		Field:      b.Field,
+		Kind:       b.Kind,
+		State:      b.state,
+		Processed:  int(b.processed.Load()),
+		Total:      b.total,
+	}
+	if b.state == BuildRunning {
+		p.Elapsed = time.Since(b.Started)
+	} else {
+		p.Elapsed = b.finished.Sub(b.Started)
+	}
+	if b.err != nil {
+		p.Error = b.err.Error()
+	}
+	return p
+}
+
+// Cancel отменяет постройку; завершённую постройку не меняет
+func (b *IndexBuild) Cancel() {
+	b.cancel()
+}
+
+// Done закрывается, когда постройка завершена, отменена или упала
+func (b *IndexBuild) Done() <-chan struct{} {
+	return b.done
+}
+
+// Err — итог завершённой постройки
+func (b *IndexBuild) Err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+func (b *IndexBuild) finish(err error) {
+	b.mu.Lock()
+	switch {
+	case err == nil:
+		b.state = BuildDone
+	case errors.Is(err, ErrBuildCanceled):
+		b.state = BuildCanceled
+	default:
+		b.state = BuildFailed
+	}
+	b.err = err
+	b.finished = time.Now()
+	b.mu.Unlock()
+	b.cancel()
+	close(b.done)
+}
+
+func buildTempPath(collName, fieldName string) string {
+	return indexPath(collName, fieldName) + ".build"
+}
+
+// startIndexBuild регистрирует постройку и открывает снимок, вызывается из очереди коллекции
+func (c *Collection) startIndexBuild(fieldName string, order int, kind index.KeyKind) (*IndexBuild, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, exists := c.Indexes[fieldName]; exists || fieldName == IDField {
+		return nil, fmt.Errorf("index on field '%s' already exists", fieldName)
+	}
+	if _, building := c.builds[fieldName]; building {
+		return nil, fmt.Errorf("index on field '%s' is already being built", fieldName)
+	}
+
+	// снимок должен видеть все изменения до начала записи изменений поля
+	c.commitInternal()
+	tree := index.NewBPlusTree(order)
+	tree.SetKind(kind)
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &IndexBuild{
+		Collection:  c.Name,
+		Field:       fieldName,
+		Kind:        kind,
+		Started:     time.Now(),
+		order:       order,
+		compression: c.Options.Compression,
+		ctx:         ctx,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+		snap:        c.Snapshot(),
+		tree:        tree,
+		state:       BuildRunning,
+	}
+	b.total = b.snap.Len()
+	c.builds[fieldName] = b
+	return b, nil
+}
+
+// recordBuilds запоминает изменение документа для идущих построек, вызывается под блокировкой
+func (c *Collection) recordBuilds(op, docID string, doc map[string]any) {
+	for fieldName, b := range c.builds {
+		if fieldValue, exists := doc[fieldName]; exists {
+			b.pending = append(b.pending, indexOp{Op: op, Key: b.tree.Key(fieldValue), Value: []byte(docID)})
+		}
+	}
+}
+
+// scan строит дерево по снимку и пишет его во временный файл, блокировок не берёт
+func (b *IndexBuild) scan() error {
+	defer b.snap.Release()
+
+	var n int64
+	b.snap.Scan(func(doc map[string]any) bool {
+		if n++; n%buildCheckEvery == 0 && b.ctx.Err() != nil {
+			return false
+		}
+		if fieldValue, exists := doc[b.Field]; exists {
+			id, _ := doc[IDField].(string)
+			b.tree.Insert(b.tree.Key(fieldValue), []byte(id))
+		}
+		b.processed.Add(1)
+		return true
+	})
+	if b.ctx.Err() != nil {
+		return ErrBuildCanceled
+	}
+
+	jsonData, err := json.MarshalIndent(serializeBTree(b.tree, b.Field, b.order), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal index: %w", err)
+	}
+	path := buildTempPath(b.Collection, b.Field)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create index directory: %w", err)
+	}
+	b.usage, err = writeEncodedFile(path, jsonData, b.compression)
+	if err != nil {
+		return fmt.Errorf("failed to write index file: %w", err)
+	}
+	return nil
+}
+
+// publishIndexBuild догоняет изменения, сделанные во время постройки, и
+// публикует индекс; при ошибке постройки только снимает её. Вызывается из
+// очереди коллекции, поэтому писатели не меняют поле между догонкой и публикацией
+func (c *Collection) publishIndexBuild(b *IndexBuild, buildErr error) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.builds, b.Field)
+	if buildErr == nil && b.ctx.Err() != nil {
+		buildErr = ErrBuildCanceled
+	}
+	if buildErr != nil {
+		os.Remove(buildTempPath(c.Name, b.Field))
+		return buildErr
+	}
+
+	// старый журнал поля остался бы от индекса, которого уже нет
+	logPath := indexLogPath(c.Name, b.Field)
+	if err := os.Remove(logPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove index log: %w", err)
+	}
+	if err := os.Rename(buildTempPath(c.Name, b.Field), indexPath(c.Name, b.Field)); err != nil {
+		return fmt.Errorf("failed to publish index file: %w", err)
+	}
+
+	j := &indexJournal{pending: b.pending}
+	for _, op := range b.pending {
+		switch op.Op {
+		case opIndexInsert:
+			b.tree.Insert(op.Key, op.Value)
+		case opIndexDelete:
+			b.tree.Delete(op.Key, op.Value)
+		}
+	}
+	c.journals[b.Field] = j
+	c.Indexes[b.Field] = b.tree
+	c.setIndexUsage(b.Field, b.usage)
+	c.dirty = true
+
+	if len(j.pending) > 0 {
+		if err := c.appendIndexLog(b.Field, j); err != nil {
+			// индекс в памяти верен: при следующем сохранении он запишется целиком
+			j.full, j.pending = true, nil
+		}
+	}
+	return nil
+}
+
+// BuildIndex запускает фоновую постройку индекса. Ошибка возвращается,
+// если индекс уже есть или строится; итог постройки — в IndexBuild
+func (m *CollectionMng) BuildIndex(name, fieldName string, order int, kind index.KeyKind) (*IndexBuild, error) {
+	var b *IndexBuild
+	result := m.Enqueue(context.Background(), name, func(coll *Collection) (WriteResult, error) {
+		var err error
+		b, err = coll.startIndexBuild(fieldName, order, kind)
+		return WriteResult{}, err
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	m.mu.Lock()
+	m.builds[name+"/"+fieldName] = b
+	m.mu.Unlock()
+
+	go m.runIndexBuild(b)
+	return b, nil
+}
+
+func (m *CollectionMng) runIndexBuild(b *IndexBuild) {
+	scanErr := b.scan()
+	for {
+		result := m.Enqueue(context.Background(), b.Collection, func(coll *Collection) (WriteResult, error) {
+			return WriteResult{}, coll.publishIndexBuild(b, scanErr)
+		})
+		// задача не попала в занятую очередь — постройку всё равно нужно снять
+		if errors.Is(result.Error, ErrQueueFull) {
+			continue
+		}
+		b.finish(result.Error)
+		return
+	}
+}
+
+// IndexBuilds возвращает идущие и последние завершённые постройки
+// по коллекции, пустое имя — по всем
+func (m *CollectionMng) IndexBuilds(name string) []IndexBuildProgress {
+	m.mu.Lock()
+	builds := make([]*IndexBuild, 0, len(m.builds))
+	for _, b := range m.builds {
+		if name == "" || b.Collection == name {
+			builds = append(builds, b)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(builds, func(i, j int) bool { return builds[i].Started.Before(builds[j].Started) })
+	progress := make([]IndexBuildProgress, len(builds))
+	for i, b := range builds {
+		progress[i] = b.Progress()
+	}
+	return progress
+}
+
+// CancelIndexBuild отменяет идущую постройку индекса
+func (m *CollectionMng) CancelIndexBuild(name, fieldName string) error {
+	m.mu.Lock()
+	b, ok := m.builds[name+"/"+fieldName]
+	m.mu.Unlock()
+	if !ok || b.Progress().State != BuildRunning {
+		return fmt.Errorf("no index build running on field '%s'", fieldName)
+	}
+	b.Cancel()
+	return nil
+}
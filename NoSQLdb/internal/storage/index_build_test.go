@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"nosql_db/internal/index"
+	"os"
+	"testing"
+)
+
+// searchHost возвращает _id документов с host по индексу
+func searchHost(t *testing.T, btree *index.BTree, host string) []string {
+	t.Helper()
+	return index.ValuesToStrings(btree.Search(index.ValueToKey(host)))
+}
+
+func TestIndexBuildCatchesUpWritesDuringScan(t *testing.T) {
+	DataDir = t.TempDir()
+	coll := NewCollection("build")
+	old, _ := coll.Insert(map[string]any{"host": "a"})
+	kept, _ := coll.Insert(map[string]any{"host": "b"})
+
+	b, err := coll.startIndexBuild("host", 4, index.KeyValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// писатели не ждут постройку: изменения после снимка догоняются при публикации
+	added, _ := coll.Insert(map[string]any{"host": "a"})
+	coll.Delete(old)
+
+	if err := coll.publishIndexBuild(b, b.scan()); err != nil {
+		t.Fatal(err)
+	}
+	btree, ok := coll.GetIndex("host")
+	if !ok {
+		t.Fatal("index not published")
+	}
+	if got := searchHost(t, btree, "a"); len(got) != 1 || got[0] != added {
+		t.Fatalf("host a: %v, want [%s]", got, added)
+	}
+	if got := searchHost(t, btree, "b"); len(got) != 1 || got[0] != kept {
+		t.Fatalf("host b: %v, want [%s]", got, kept)
+	}
+
+	// на диске — файл по снимку и журнал догонки
+	if got := searchHost(t, reloadIndexOf(t, "build", "host"), "a"); len(got) != 1 || got[0] != added {
+		t.Fatalf("reloaded host a: %v, want [%s]", got, added)
+	}
+	if _, err := os.Stat(buildTempPath("build", "host")); !os.IsNotExist(err) {
+		t.Fatalf("temporary index file left: %v", err)
+	}
+}
+
+func TestIndexBuildCancel(t *testing.T) {
+	DataDir = t.TempDir()
+	coll := NewCollection("build")
+	coll.Insert(map[string]any{"host": "a"})
+
+	b, err := coll.startIndexBuild("host", 4, index.KeyValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := coll.startIndexBuild("host", 4, index.KeyValue); err == nil {
+		t.Fatal("second build of the same field started")
+	}
+	b.Cancel()
+	err = coll.publishIndexBuild(b, b.scan())
+	if !errors.Is(err, ErrBuildCanceled) {
+		t.Fatalf("got %v, want ErrBuildCanceled", err)
+	}
+	if coll.HasIndex("host") || len(coll.builds) != 0 {
+		t.Fatal("canceled build left an index or a registration")
+	}
+	if _, err := os.Stat(indexPath("build", "host")); !os.IsNotExist(err) {
+		t.Fatalf("canceled build wrote an index file: %v", err)
+	}
+}
+
+func TestManagerBuildIndexInBackground(t *testing.T) {
+	DataDir = t.TempDir()
+	m := NewManager()
+	defer m.Stop()
+	m.Enqueue(context.Background(), "build", func(coll *Collection) (WriteResult, error) {
+		for range 3000 {
+			coll.Insert(map[string]any{"host": "a"})
+		}
+		return WriteResult{}, coll.Save()
+	})
+
+	b, err := m.BuildIndex("build", "host", 64, index.KeyValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-b.Done()
+	if err := b.Err(); err != nil {
+		t.Fatal(err)
+	}
+	p := m.IndexBuilds("build")
+	if len(p) != 1 || p[0].State != BuildDone || p[0].Processed != 3000 || p[0].Total != 3000 {
+		t.Fatalf("progress %+v", p)
+	}
+	coll, _ := m.GetCollection("build")
+	btree, _ := coll.GetIndex("host")
+	if got := searchHost(t, btree, "a"); len(got) != 3000 {
+		t.Fatalf("indexed %d documents, want 3000", len(got))
+	}
+	if err := m.CancelIndexBuild("build", "host"); err == nil {
+		t.Fatal("canceled a finished build")
+	}
+}
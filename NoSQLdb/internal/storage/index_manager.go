@@ -6,40 +6,50 @@ import (
 	"nosql_db/internal/index"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // CreateIndex создает индекс на указанном поле
 func (c *Collection) CreateIndex(fieldName string, order int) error {
+	return c.CreateTypedIndex(fieldName, order, index.KeyValue)
+}
+
+// CreateTypedIndex создает индекс с заданным типом ключей, например index.KeyIP.
+// Строит индекс под блокировкой писателя; сервер строит индексы в фоне через
+// CollectionMng.BuildIndex
+func (c *Collection) CreateTypedIndex(fieldName string, order int, kind index.KeyKind) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	if _, exists := c.Indexes[fieldName]; exists {
+	if _, exists := c.Indexes[fieldName]; exists || fieldName == IDField {
 		return fmt.Errorf("index on field '%s' already exists", fieldName)
 	}
-	btree := index.NewBPlusTree(order)
+	if _, building := c.builds[fieldName]; building {
+		return fmt.Errorf("index on field '%s' is already being built", fieldName)
+	}
+	c.Indexes[fieldName] = c.buildIndex(fieldName, order, kind)
+	c.dirty = true
 
-	items := c.Data.Items()
-	for _, v := range items {
-		doc, ok := v.(map[string]any)
-		if !ok {
-			continue
-		}
+	return c.saveIndexInternal(fieldName)
+}
+
+// buildIndex строит индекс по всем документам, вызывается под блокировкой писателя
+func (c *Collection) buildIndex(fieldName string, order int, kind index.KeyKind) *index.BTree {
+	btree := index.NewBPlusTree(order)
+	btree.SetKind(kind)
+	c.Data.Range(func(docID string, doc map[string]any) bool {
 		if fieldValue, exists := doc[fieldName]; exists {
-			docID := doc["_id"].(string)
-			key := index.ValueToKey(fieldValue)
+			key := btree.Key(fieldValue)
 			btree.Insert(key, []byte(docID))
 		}
-	}
-	c.Indexes[fieldName] = btree
-
-	return c.saveIndexInternal(fieldName)
+		return true
+	})
+	return btree
 }
 
-// HasIndex проверяет существование индекса на поле
+// HasIndex проверяет существование индекса на поле; _id индексирован всегда
 func (c *Collection) HasIndex(fieldName string) bool {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
-	_, exists := c.Indexes[fieldName]
+	_, exists := c.GetIndex(fieldName)
 	return exists
 }
 
@@ -47,6 +57,9 @@ func (c *Collection) HasIndex(fieldName string) bool {
 func (c *Collection) GetIndex(fieldName string) (*index.BTree, bool) {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
+	if fieldName == IDField {
+		return c.ids, true
+	}
 	btree, exists := c.Indexes[fieldName]
 	return btree, exists
 }
@@ -60,11 +73,11 @@ func (c *Collection) LoadIndex(fieldName string) error {
 
 // loadIndexInternal - приватная версия без блокировок
 func (c *Collection) loadIndexInternal(fieldName string) error {
-	indexPath := filepath.Join("data", "indexes", fmt.Sprintf("%s_%s.idx", c.Name, fieldName))
-	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+	path := indexPath(c.Name, fieldName)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
 		return nil
 	}
-	jsonData, err := os.ReadFile(indexPath)
+	jsonData, _, usage, err := readEncodedFile(path)
 	if err != nil {
 		return fmt.Errorf("failed to read index file: %w", err)
 	}
@@ -72,8 +85,24 @@ func (c *Collection) loadIndexInternal(fieldName string) error {
 	if err := json.Unmarshal(jsonData, &indexData); err != nil {
 		return fmt.Errorf("failed to unmarshal index: %w", err)
 	}
+	c.dirty = true
+	c.setIndexUsage(fieldName, usage)
+
+	if indexData.Keys != index.KeyVersion {
+		// ключи записаны прежним кодированием: индекс строится заново по данным
+		// и при следующем сохранении записывается целиком, старый журнал не нужен
+		c.Indexes[fieldName] = c.buildIndex(fieldName, indexData.Order, indexData.Type)
+		c.journals[fieldName] = &indexJournal{full: true}
+		return nil
+	}
+
 	btree := deserializeBTree(&indexData)
+	logBytes, err := replayIndexLog(btree, indexLogPath(c.Name, fieldName))
+	if err != nil {
+		return err
+	}
 	c.Indexes[fieldName] = btree
+	c.journals[fieldName] = &indexJournal{logBytes: logBytes}
 	return nil
 }
 
@@ -82,11 +111,11 @@ func (c *Collection) LoadAllIndexes() error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	indexDir := filepath.Join("data", "indexes")
-	if _, err := os.Stat(indexDir); os.IsNotExist(err) {
+	dir := indexDir()
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		return nil
 	}
-	entries, err := os.ReadDir(indexDir)
+	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return fmt.Errorf("failed to read index directory: %w", err)
 	}
@@ -98,6 +127,9 @@ func (c *Collection) LoadAllIndexes() error {
 		name := entry.Name()
 		if len(name) > len(prefix) && name[:len(prefix)] == prefix && filepath.Ext(name) == ".idx" {
 			fieldName := name[len(prefix) : len(name)-4]
+			if fieldName == IDField {
+				continue // индекс по _id встроенный и строится при загрузке
+			}
 			if err := c.loadIndexInternal(fieldName); err != nil {
 				return err
 			}
@@ -108,73 +140,79 @@ func (c *Collection) LoadAllIndexes() error {
 
 // SaveIndex сохраняет индекс на диск (Публичный метод)
 func (c *Collection) SaveIndex(fieldName string) error {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	return c.saveIndexInternal(fieldName)
 }
 
-// saveIndexInternal - сохранение без блокировок (для использования внутри CreateIndex)
+// saveIndexInternal - сохранение без блокировок (для использования внутри CreateIndex).
+// Индекс пишется целиком, журнал изменений после этого не нужен
 func (c *Collection) saveIndexInternal(fieldName string) error {
-	btree, exists := c.Indexes[fieldName]
-	if !exists {
-		return fmt.Errorf("index on field '%s' does not exist", fieldName)
+	start := time.Now()
+	defer func() { saveDuration.Observe(time.Since(start).Seconds(), c.Name, "index") }()
+
+	jsonData, err := c.marshalIndex(fieldName)
+	if err != nil {
+		return err
 	}
-	indexPath := filepath.Join("data", "indexes", fmt.Sprintf("%s_%s.idx", c.Name, fieldName))
-	if err := os.MkdirAll(filepath.Dir(indexPath), 0755); err != nil {
+	path := indexPath(c.Name, fieldName)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return fmt.Errorf("failed to create index directory: %w", err)
 	}
-	indexData := serializeBTree(btree, fieldName, 64)
-	jsonData, err := json.MarshalIndent(indexData, "", "  ")
+	usage, err := writeEncodedFile(path, jsonData, c.Options.Compression)
 	if err != nil {
-		return fmt.Errorf("failed to marshal index: %w", err)
-	}
-	if err := os.WriteFile(indexPath, jsonData, 0644); err != nil {
 		return fmt.Errorf("failed to write index file: %w", err)
 	}
+	c.setIndexUsage(fieldName, usage)
+
+	if err := os.Remove(indexLogPath(c.Name, fieldName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove index log: %w", err)
+	}
+	c.journals[fieldName] = &indexJournal{}
 	return nil
 }
 
-// SaveAllIndexes сохраняет все индексы на диск
-func (c *Collection) SaveAllIndexes() error {
-	c.mutex.RLock()
-	defer c.mutex.RUnlock()
-
-	for fieldName := range c.Indexes {
-		if err := c.saveIndexInternal(fieldName); err != nil {
-			return err
-		}
+// marshalIndex сериализует индекс в json, вызывается под блокировкой
+func (c *Collection) marshalIndex(fieldName string) ([]byte, error) {
+	btree, exists := c.Indexes[fieldName]
+	if !exists {
+		return nil, fmt.Errorf("index on field '%s' does not exist", fieldName)
 	}
-	return nil
+	indexData := serializeBTree(btree, fieldName, 64)
+	jsonData, err := json.MarshalIndent(indexData, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal index: %w", err)
+	}
+	return jsonData, nil
 }
 
-// RebuildAllIndexes пересоздает все индексы
-func (c *Collection) RebuildAllIndexes() error {
+// setIndexUsage запоминает размер файла индекса для статистики
+func (c *Collection) setIndexUsage(fieldName string, usage fileUsage) {
+	c.usageMu.Lock()
+	defer c.usageMu.Unlock()
+	c.indexUsage[fieldName] = usage
+}
+
+// SaveAllIndexes сохраняет изменения индексов на диск: дописывает их в журнал
+// индекса, а целиком переписывает только новые индексы и индексы с большим журналом
+func (c *Collection) SaveAllIndexes() error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	fields := make([]string, 0, len(c.Indexes))
 	for fieldName := range c.Indexes {
-		fields = append(fields, fieldName)
-	}
-	c.Indexes = make(map[string]*index.BTree)
-
-	items := c.Data.Items()
-
-	for _, fieldName := range fields {
-		btree := index.NewBPlusTree(64)
-		for _, v := range items {
-			doc, ok := v.(map[string]any)
-			if !ok {
-				continue
-			}
-
-			if fieldValue, exists := doc[fieldName]; exists {
-				docID := doc["_id"].(string)
-				key := index.ValueToKey(fieldValue)
-				btree.Insert(key, []byte(docID))
+		j := c.journal(fieldName)
+		if !j.full {
+			if _, err := os.Stat(indexPath(c.Name, fieldName)); err == nil {
+				if len(j.pending) > 0 {
+					if err := c.appendIndexLog(fieldName, j); err != nil {
+						return err
+					}
+				}
+				if !c.needsCompaction(fieldName, j) {
+					continue
+				}
 			}
 		}
-		c.Indexes[fieldName] = btree
 		if err := c.saveIndexInternal(fieldName); err != nil {
 			return err
 		}
@@ -182,22 +220,34 @@ func (c *Collection) RebuildAllIndexes() error {
 	return nil
 }
 
+// rewriteAllIndexes помечает индексы для полной записи при следующем сохранении
+func (c *Collection) rewriteAllIndexes() {
+	for fieldName := range c.Indexes {
+		j := c.journal(fieldName)
+		j.full, j.pending = true, nil
+	}
+}
+
 // updateIndexesOnInsert (Приватный) - вызывается внутри Insert, мьютексы не нужны
 func (c *Collection) updateIndexesOnInsert(docID string, doc map[string]any) {
 	for fieldName, btree := range c.Indexes {
 		if fieldValue, exists := doc[fieldName]; exists {
-			key := index.ValueToKey(fieldValue)
+			key := btree.Key(fieldValue)
 			btree.Insert(key, []byte(docID))
+			c.logIndexOp(fieldName, opIndexInsert, key, docID)
 		}
 	}
+	c.recordBuilds(opIndexInsert, docID, doc)
 }
 
 // updateIndexesOnDelete (Приватный) - вызывается внутри Delete, мьютексы не нужны
 func (c *Collection) updateIndexesOnDelete(docID string, doc map[string]any) {
 	for fieldName, btree := range c.Indexes {
 		if fieldValue, exists := doc[fieldName]; exists {
-			key := index.ValueToKey(fieldValue)
+			key := btree.Key(fieldValue)
 			btree.Delete(key, []byte(docID))
+			c.logIndexOp(fieldName, opIndexDelete, key, docID)
 		}
 	}
+	c.recordBuilds(opIndexDelete, docID, doc)
 }
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"nosql_db/internal/index"
+	"os"
+)
+
+// Журнал индекса: изменения B+ дерева с последней полной записи файла .idx
+// дописываются в <коллекция>_<поле>.idx.log по одной операции на строку.
+// При загрузке журнал применяется к дереву из .idx. Когда журнал становится
+// больше половины .idx, индекс записывается целиком, а журнал удаляется.
+// С шифрованием каждая дописанная пачка операций — одна строка base64
+// с зашифрованными строками операций внутри
+
+// minIndexLogCompact — журнал меньше этого размера не сжимается
+const minIndexLogCompact = 64 << 10
+
+const (
+	opIndexInsert = "+"
+	opIndexDelete = "-"
+)
+
+// indexOp — одна операция над индексом, ключ и значение в json — base64
+type indexOp struct {
+	Op    string `json:"op"`
+	Key   []byte `json:"k"`
+	Value []byte `json:"v"`
+}
+
+// indexJournal — несохранённые операции индекса и размер его журнала на диске
+type indexJournal struct {
+	pending  []indexOp
+	logBytes int64
+	full     bool // индекс нужно записать целиком: новый, перестроен или сменился формат
+}
+
+func indexLogPath(collName, fieldName string) string {
+	return indexPath(collName, fieldName) + ".log"
+}
+
+// journal возвращает журнал индекса, вызывается под блокировкой писателя
+func (c *Collection) journal(fieldName string) *indexJournal {
+	j, ok := c.journals[fieldName]
+	if !ok {
+		j = &indexJournal{}
+		c.journals[fieldName] = j
+	}
+	return j
+}
+
+// logIndexOp запоминает изменение индекса до следующего сохранения
+func (c *Collection) logIndexOp(fieldName, op string, key index.Key, docID string) {
+	j := c.journal(fieldName)
+	if j.full {
+		return // индекс всё равно будет записан целиком
+	}
+	j.pending = append(j.pending, indexOp{Op: op, Key: key, Value: []byte(docID)})
+}
+
+// appendIndexLog дописывает несохранённые операции в журнал индекса
+func (c *Collection) appendIndexLog(fieldName string, j *indexJournal) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, op := range j.pending {
+		if err := encoder.Encode(op); err != nil {
+			return fmt.Errorf("failed to encode index log: %w", err)
+		}
+	}
+	record, err := sealRecord(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to encrypt index log: %w", err)
+	}
+
+	f, err := os.OpenFile(indexLogPath(c.Name, fieldName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open index log: %w", err)
+	}
+	n, err := f.Write(record)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write index log: %w", err)
+	}
+	j.logBytes += int64(n)
+	j.pending = j.pending[:0]
+	return nil
+}
+
+// needsCompaction — журнал вырос настолько, что дешевле переписать индекс
+func (c *Collection) needsCompaction(fieldName string, j *indexJournal) bool {
+	c.usageMu.Lock()
+	base := c.indexUsage[fieldName].Raw
+	c.usageMu.Unlock()
+	return j.logBytes > minIndexLogCompact && j.logBytes*2 > base
+}
+
+// replayIndexLog применяет журнал к загруженному дереву и возвращает размер журнала.
+// Недописанная последняя строка (сбой во время записи) пропускается.
+// Повтор безопасен: если сбой случился после записи .idx, но до удаления
+// журнала, его операции уже есть в дереве и вставка не создаст дубль
+func replayIndexLog(btree *index.BTree, path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read index log: %w", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64<<10), len(data)+1)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if bytes.HasPrefix(line, []byte("{")) {
+			if !applyIndexOp(btree, line) {
+				break
+			}
+			continue
+		}
+		chunk, err := unsealRecord(line)
+		if errors.Is(err, ErrNoKey) || errors.Is(err, ErrUnknownKey) {
+			return 0, fmt.Errorf("failed to read index log: %w", err)
+		}
+		if err != nil {
+			break
+		}
+		ops := bufio.NewScanner(bytes.NewReader(chunk))
+		ops.Buffer(make([]byte, 64<<10), len(chunk)+1)
+		for ops.Scan() {
+			applyIndexOp(btree, ops.Bytes())
+		}
+	}
+	return int64(len(data)), nil
+}
+
+// applyIndexOp применяет строку журнала, false — строка не разобрана
+func applyIndexOp(btree *index.BTree, line []byte) bool {
+	var op indexOp
+	if err := json.Unmarshal(line, &op); err != nil {
+		return false
+	}
+	switch op.Op {
+	case opIndexInsert:
+		btree.Delete(op.Key, op.Value)
+		btree.Insert(op.Key, op.Value)
+	case opIndexDelete:
+		btree.Delete(op.Key, op.Value)
+	}
+	return true
+}
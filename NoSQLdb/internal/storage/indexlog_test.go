@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"encoding/json"
+	"nosql_db/internal/index"
+	"os"
+	"testing"
+)
+
+// reloadIndex читает индекс с диска в новую коллекцию
+func reloadIndex(t *testing.T, field string) *index.BTree {
+	t.Helper()
+	return reloadIndexOf(t, "journal", field)
+}
+
+// reloadIndexOf читает индекс коллекции name с диска
+func reloadIndexOf(t *testing.T, name, field string) *index.BTree {
+	t.Helper()
+	coll := NewCollection(name)
+	if err := coll.LoadAllIndexes(); err != nil {
+		t.Fatal(err)
+	}
+	btree, ok := coll.Indexes[field]
+	if !ok {
+		t.Fatalf("index %s not loaded", field)
+	}
+	return btree
+}
+
+func TestIndexJournalAppendsAndReplays(t *testing.T) {
+	DataDir = t.TempDir()
+	coll := NewCollection("journal")
+	a, _ := coll.Insert(map[string]any{"host": "a"})
+	if err := coll.CreateIndex("host", 4); err != nil {
+		t.Fatal(err)
+	}
+	base, err := os.ReadFile(indexPath("journal", "host"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := coll.Insert(map[string]any{"host": "b"})
+	coll.Delete(a)
+	if err := coll.SaveAllIndexes(); err != nil {
+		t.Fatal(err)
+	}
+
+	after, _ := os.ReadFile(indexPath("journal", "host"))
+	if string(after) != string(base) {
+		t.Fatal("small change rewrote the index file instead of appending to the log")
+	}
+	if _, err := os.Stat(indexLogPath("journal", "host")); err != nil {
+		t.Fatalf("index log not written: %v", err)
+	}
+
+	btree := reloadIndex(t, "host")
+	if got := btree.Search(index.ValueToKey("a")); len(got) != 0 {
+		t.Fatalf("deleted document still indexed: %v", got)
+	}
+	if got := index.ValuesToStrings(btree.Search(index.ValueToKey("b"))); len(got) != 1 || got[0] != b {
+		t.Fatalf("inserted document not indexed: %v", got)
+	}
+}
+
+func TestIndexJournalToleratesTornTail(t *testing.T) {
+	DataDir = t.TempDir()
+	coll := NewCollection("journal")
+	if err := coll.CreateIndex("host", 4); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := coll.Insert(map[string]any{"host": "a"})
+	if err := coll.SaveAllIndexes(); err != nil {
+		t.Fatal(err)
+	}
+
+	// сбой посреди записи следующей операции
+	f, err := os.OpenFile(indexLogPath("journal", "host"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"-","k":"`)
+	f.Close()
+
+	got := index.ValuesToStrings(reloadIndex(t, "host").Search(index.ValueToKey("a")))
+	if len(got) != 1 || got[0] != id {
+		t.Fatalf("journal before torn tail not applied: %v", got)
+	}
+}
+
+func TestIndexJournalReplayIsIdempotent(t *testing.T) {
+	DataDir = t.TempDir()
+	coll := NewCollection("journal")
+	if err := coll.CreateIndex("host", 4); err != nil {
+		t.Fatal(err)
+	}
+	coll.Insert(map[string]any{"host": "a"})
+	if err := coll.SaveAllIndexes(); err != nil {
+		t.Fatal(err)
+	}
+	logData, _ := os.ReadFile(indexLogPath("journal", "host"))
+
+	// сбой после полной записи индекса, но до удаления журнала
+	if err := coll.SaveIndex("host"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(indexLogPath("journal", "host"), logData, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := reloadIndex(t, "host").Search(index.ValueToKey("a")); len(got) != 1 {
+		t.Fatalf("replayed insert duplicated: %v", got)
+	}
+}
+
+func TestIndexWithOldKeyVersionIsRebuilt(t *testing.T) {
+	DataDir = t.TempDir()
+	coll := NewCollection("journal")
+	id, _ := coll.Insert(map[string]any{"ts": "2025-01-01T03:00:00+03:00"})
+	if err := coll.Save(); err != nil {
+		t.Fatal(err)
+	}
+	// индекс прежней версии: ключ — байты строки
+	old := index.NewBPlusTree(64)
+	old.Insert(index.Key("2025-01-01T03:00:00+03:00"), []byte(id))
+	file := serializeBTree(old, "ts", 64)
+	file.Keys = 0
+	data, _ := json.Marshal(file)
+	os.MkdirAll(indexDir(), 0755)
+	if err := os.WriteFile(indexPath("journal", "ts"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadCollection("journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.LoadAllIndexes(); err != nil {
+		t.Fatal(err)
+	}
+	btree, _ := loaded.GetIndex("ts")
+	if got := btree.Search(index.ValueToKey("2025-01-01T00:00:00Z")); len(got) != 1 {
+		t.Fatalf("rebuilt index lookup by UTC instant: %v", got)
+	}
+}
@@ -1,8 +1,13 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // WriteJob — задача в очереди модификации
@@ -10,33 +15,86 @@ type WriteJob struct {
 	DBName     string                                      // имя базы/коллекции
 	Operation  func(coll *Collection) (WriteResult, error) // операция для выполнения
 	ResultChan chan WriteResult                            // канал для ответа
+	EnqueuedAt time.Time                                   // время постановки в очередь
+	Group      bool                                        // операция только меняет память, сохраняет воркер
+
+	state *atomic.Int32 // jobQueued, jobTaken или jobAbandoned; nil — задачу нельзя отменить
+}
+
+// состояния задачи: ждущий результата отказывается от задачи, только пока
+// воркер её не взял, дальше она выполняется до конца
+const (
+	jobQueued int32 = iota
+	jobTaken
+	jobAbandoned
+)
+
+// take отмечает, что воркер взял задачу; false — от неё уже отказались
+func (j *WriteJob) take() bool {
+	return j.state == nil || j.state.CompareAndSwap(jobQueued, jobTaken)
 }
 
 // WriteResult — результат выполнения write-операции
 type WriteResult struct {
 	InsertedIDs  []string // ID вставленных документов
 	DeletedCount int      // количество удаленных документов
+	Deduplicated int      // сколько документов пропущено как повторы
 	Message      string   // сообщение
 	Error        error    // ошибка, если есть
 }
 
+// ErrQueueFull — очередь коллекции не освободилась за QueueTimeout
+var ErrQueueFull = errors.New("write queue is full")
+
+// ErrShuttingDown — сервер останавливается и новые записи не принимает
+var ErrShuttingDown = errors.New("server is shutting down")
+
+var (
+	// WriteQueueSize — ёмкость очереди одной коллекции
+	WriteQueueSize = 100
+	// QueueTimeout — сколько ждать места в очереди; 0 — ждать бесконечно
+	QueueTimeout = 5 * time.Second
+	// MaxGroupSize — сколько задач одной коллекции сохраняются одним шагом
+	MaxGroupSize = 64
+	// QueueIdleTimeout — через сколько простоя воркер коллекции останавливается
+	// и очередь удаляется; 0 — воркеры живут до остановки сервера
+	QueueIdleTimeout = time.Minute
+)
+
 type CollectionMng struct {
 	mu          sync.Mutex
 	collections map[string]*Collection
-	writeQueue  chan WriteJob
+	queues      map[string]*writeQueue
+	builds      map[string]*IndexBuild // последняя постройка по "коллекция/поле"
+	rekey       *Rekey                 // последнее перешифрование
 	stopChan    chan struct{}
+
+	// shutdown закрывается в Shutdown и запрещает новые задачи. Постановка
+	// в очередь держит RLock, пока кладёт задачу, но не пока ждёт результата:
+	// после Lock в Shutdown в очередях нет задач, о которых он не знает
+	closeMu      sync.RWMutex
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
 }
 
-const writeQueueSize = 100
+// writeQueue — очередь и воркер одной коллекции: медленная операция
+// над одной коллекцией не задерживает запись в другие
+type writeQueue struct {
+	name    string
+	jobs    chan WriteJob
+	busy    atomic.Int64  // начало текущей задачи в UnixNano, 0 — воркер свободен
+	pending atomic.Int64  // сколько задач взяли очередь и ещё не положили в неё
+	idle    time.Duration // QueueIdleTimeout на момент создания очереди
+}
 
 func NewManager() *CollectionMng {
-	m := &CollectionMng{
+	return &CollectionMng{
 		collections: make(map[string]*Collection),
-		writeQueue:  make(chan WriteJob, writeQueueSize),
+		queues:      make(map[string]*writeQueue),
+		builds:      make(map[string]*IndexBuild),
 		stopChan:    make(chan struct{}),
+		shutdown:    make(chan struct{}),
 	}
-	go m.worker()
-	return m
 }
 
 var GlobalManager = NewManager()
@@ -57,24 +115,150 @@ func (m *CollectionMng) GetCollection(name string) (*Collection, error) {
 	if err := coll.LoadAllIndexes(); err != nil {
 		return nil, fmt.Errorf("failed to load index %w", err)
 	}
+	coll.Commit()
 
 	m.collections[name] = coll
 
 	return coll, nil
 }
 
-func (m *CollectionMng) worker() {
+// queue возвращает очередь коллекции, при первом обращении запускает её воркер.
+// Очередь не удаляется, пока задача не положена в неё: вызывающий отмечает
+// это через q.pending.Add(-1)
+func (m *CollectionMng) queue(name string) *writeQueue {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	q, ok := m.queues[name]
+	if !ok {
+		q = &writeQueue{name: name, jobs: make(chan WriteJob, WriteQueueSize), idle: QueueIdleTimeout}
+		m.queues[name] = q
+		go m.worker(q)
+	}
+	q.pending.Add(1)
+	return q
+}
+
+// retire удаляет простаивающую очередь; false — в неё кладут задачи
+// или сервер останавливается и ждёт очереди
+func (m *CollectionMng) retire(q *writeQueue) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	select {
+	case <-m.shutdown:
+		return false
+	default:
+	}
+	if q.pending.Load() > 0 || len(q.jobs) > 0 {
+		return false
+	}
+	delete(m.queues, q.name)
+	return true
+}
+
+func (m *CollectionMng) worker(q *writeQueue) {
+	var idle <-chan time.Time
+	var idleTimer *time.Timer
+	if q.idle > 0 {
+		idleTimer = time.NewTimer(q.idle)
+		defer idleTimer.Stop()
+	}
+
+	var next *WriteJob
 	for {
-		select {
-		case job := <-m.writeQueue:
+		var job WriteJob
+		if next != nil {
+			job, next = *next, nil
+		} else {
+			if idleTimer != nil {
+				idleTimer.Reset(q.idle)
+				idle = idleTimer.C
+			}
+			select {
+			case job = <-q.jobs:
+			case <-idle:
+				if m.retire(q) {
+					return
+				}
+				continue
+			case <-m.stopChan:
+				return
+			}
+		}
+		if !job.take() {
+			continue
+		}
+
+		q.busy.Store(time.Now().UnixNano())
+		if !job.Group {
+			queueWait.Observe(time.Since(job.EnqueuedAt).Seconds(), job.DBName)
 			result := m.processJob(job)
+			m.commit(job.DBName)
+			q.busy.Store(0)
 			job.ResultChan <- result
-		case <-m.stopChan:
-			return
+			continue
 		}
+
+		// group commit: забираем уже ждущие групповые задачи и сохраняем их вместе
+		group := []WriteJob{job}
+	drain:
+		for len(group) < MaxGroupSize {
+			select {
+			case j := <-q.jobs:
+				if !j.Group {
+					next = &j
+					break drain
+				}
+				if j.take() {
+					group = append(group, j)
+				}
+			default:
+				break drain
+			}
+		}
+		m.processGroup(group)
+		q.busy.Store(0)
 	}
 }
 
+// CollectionStatus — коллекция в памяти сервера и её очередь записи
+type CollectionStatus struct {
+	Name          string
+	Loaded        bool // коллекция загружена в память
+	Documents     int
+	QueueDepth    int           // задач ждут в очереди
+	QueueCapacity int           // ёмкость очереди, 0 — очереди ещё нет
+	Busy          time.Duration // сколько выполняется текущая задача, 0 — воркер свободен
+}
+
+// Status возвращает загруженные коллекции и очереди записи по имени
+func (m *CollectionMng) Status() []CollectionStatus {
+	m.mu.Lock()
+	byName := make(map[string]*CollectionStatus, len(m.collections))
+	for name, coll := range m.collections {
+		byName[name] = &CollectionStatus{Name: name, Loaded: true, Documents: coll.Data.Len()}
+	}
+	for name, q := range m.queues {
+		st, ok := byName[name]
+		if !ok {
+			st = &CollectionStatus{Name: name}
+			byName[name] = st
+		}
+		st.QueueDepth, st.QueueCapacity = len(q.jobs), cap(q.jobs)
+		if started := q.busy.Load(); started != 0 {
+			st.Busy = time.Since(time.Unix(0, started))
+		}
+	}
+	m.mu.Unlock()
+
+	status := make([]CollectionStatus, 0, len(byName))
+	for _, st := range byName {
+		status = append(status, *st)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Name < status[j].Name })
+	return status
+}
+
 func (m *CollectionMng) processJob(job WriteJob) WriteResult {
 	coll, err := m.GetCollection(job.DBName)
 	if err != nil {
@@ -88,17 +272,159 @@ func (m *CollectionMng) processJob(job WriteJob) WriteResult {
 	return result
 }
 
-func (m *CollectionMng) Enqueue(dbName string, operation func(coll *Collection) (WriteResult, error)) WriteResult {
+// processGroup применяет задачи в памяти и сохраняет коллекцию один раз.
+// Ошибка сохранения возвращается всем задачам группы
+func (m *CollectionMng) processGroup(group []WriteJob) {
+	groupSize.Observe(float64(len(group)), group[0].DBName)
+
+	results := make([]WriteResult, len(group))
+	applied := false
+	for i, job := range group {
+		queueWait.Observe(time.Since(job.EnqueuedAt).Seconds(), job.DBName)
+		results[i] = m.processJob(job)
+		if results[i].Error == nil {
+			applied = true
+		}
+	}
+
+	if applied {
+		if err := m.persist(group[0].DBName); err != nil {
+			for i := range results {
+				if results[i].Error == nil {
+					results[i] = WriteResult{Error: err}
+				}
+			}
+		}
+	}
+	m.commit(group[0].DBName)
+
+	for i, job := range group {
+		job.ResultChan <- results[i]
+	}
+}
+
+// commit публикует изменения задачи для новых снимков читателей
+func (m *CollectionMng) commit(name string) {
+	if coll, err := m.GetCollection(name); err == nil {
+		coll.Commit()
+	}
+}
+
+func (m *CollectionMng) persist(name string) error {
+	coll, err := m.GetCollection(name)
+	if err != nil {
+		return fmt.Errorf("failed to get collection: %w", err)
+	}
+	if err := coll.Save(); err != nil {
+		return fmt.Errorf("failed to save data: %w", err)
+	}
+	if err := coll.SaveAllIndexes(); err != nil {
+		return fmt.Errorf("failed to save indexes: %w", err)
+	}
+	return nil
+}
+
+// Enqueue выполняет операцию в воркере коллекции; операция сама сохраняет изменения.
+// Отмена ctx снимает задачу, пока воркер её не взял; взятая выполняется до конца
+func (m *CollectionMng) Enqueue(ctx context.Context, dbName string, operation func(coll *Collection) (WriteResult, error)) WriteResult {
+	return m.enqueue(ctx, dbName, operation, false)
+}
+
+// EnqueueGroup выполняет операцию, которая только меняет коллекцию в памяти.
+// Воркер сохраняет коллекцию и индексы один раз для всех таких задач,
+// скопившихся в очереди (group commit), и отвечает после записи на диск
+func (m *CollectionMng) EnqueueGroup(ctx context.Context, dbName string, operation func(coll *Collection) (WriteResult, error)) WriteResult {
+	return m.enqueue(ctx, dbName, operation, true)
+}
+
+func (m *CollectionMng) enqueue(ctx context.Context, dbName string, operation func(coll *Collection) (WriteResult, error), group bool) WriteResult {
 	resultChan := make(chan WriteResult, 1)
 	job := WriteJob{
 		DBName:     dbName,
 		Operation:  operation,
 		ResultChan: resultChan,
+		EnqueuedAt: time.Now(),
+		Group:      group,
+		state:      new(atomic.Int32),
+	}
+
+	m.closeMu.RLock()
+	err := m.push(ctx, dbName, job)
+	m.closeMu.RUnlock()
+	if err != nil {
+		return WriteResult{Error: err}
+	}
+
+	select {
+	case result := <-resultChan:
+		return result
+	case <-ctx.Done():
+		if job.state.CompareAndSwap(jobQueued, jobAbandoned) {
+			return WriteResult{Error: context.Cause(ctx)}
+		}
+		// воркер уже взял задачу: её точка отмены — внутри операции
+		return <-resultChan
+	}
+}
+
+// push кладёт задачу в очередь коллекции: ждёт места не дольше QueueTimeout
+// и не ждёт, если сервер останавливается или ctx отменён
+func (m *CollectionMng) push(ctx context.Context, dbName string, job WriteJob) error {
+	select {
+	case <-m.shutdown:
+		return ErrShuttingDown
+	default:
+	}
+
+	q := m.queue(dbName)
+	defer q.pending.Add(-1)
+	var timeout <-chan time.Time
+	if QueueTimeout > 0 {
+		timer := time.NewTimer(QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case q.jobs <- job:
+		return nil
+	case <-m.shutdown:
+		return ErrShuttingDown
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case <-timeout:
+		queueRejected.Inc(dbName)
+		return fmt.Errorf("%w: collection %s, waited %v", ErrQueueFull, dbName, QueueTimeout)
 	}
-	m.writeQueue <- job
-	return <-resultChan
 }
 
 func (m *CollectionMng) Stop() {
 	close(m.stopChan)
 }
+
+// Shutdown перестаёт принимать записи и дожидается, пока воркеры выполнят
+// и сохранят уже поставленные задачи
+func (m *CollectionMng) Shutdown() {
+	m.shutdownOnce.Do(func() { close(m.shutdown) })
+	// дожидаемся тех, кто уже кладёт задачу в очередь
+	m.closeMu.Lock()
+	m.closeMu.Unlock()
+
+	m.mu.Lock()
+	queues := make([]*writeQueue, 0, len(m.queues))
+	for _, q := range m.queues {
+		queues = append(queues, q)
+	}
+	m.mu.Unlock()
+
+	// пустая задача выполнится после всех, что стоят перед ней
+	for _, q := range queues {
+		done := make(chan WriteResult, 1)
+		q.jobs <- WriteJob{
+			DBName:     q.name,
+			Operation:  func(*Collection) (WriteResult, error) { return WriteResult{}, nil },
+			ResultChan: done,
+			EnqueuedAt: time.Now(),
+		}
+		<-done
+	}
+}
@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+// blockWorker занимает воркер коллекции, пока не закрыт release
+func blockWorker(m *CollectionMng, name string) (release chan struct{}) {
+	release = make(chan struct{})
+	started := make(chan struct{})
+	go m.Enqueue(context.Background(), name, func(*Collection) (WriteResult, error) {
+		close(started)
+		<-release
+		return WriteResult{}, nil
+	})
+	<-started
+	return release
+}
+
+// waitQueued ждёт, пока в очереди коллекции наберётся n задач
+func waitQueued(t *testing.T, m *CollectionMng, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if queuedJobs(m, "events") == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%d jobs queued, want %d", queuedJobs(m, "events"), n)
+}
+
+// queuedJobs — длина очереди коллекции, -1 — очереди нет
+func queuedJobs(m *CollectionMng, name string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q, ok := m.queues[name]
+	if !ok {
+		return -1
+	}
+	return len(q.jobs)
+}
+
+func TestGroupCommitSavesOnce(t *testing.T) {
+	DataDir = t.TempDir()
+	m := NewManager()
+	defer m.Stop()
+	if r := m.Enqueue(context.Background(), "events", func(coll *Collection) (WriteResult, error) {
+		coll.Insert(map[string]any{"n": 0.0})
+		return WriteResult{}, coll.Save()
+	}); r.Error != nil {
+		t.Fatal(r.Error)
+	}
+
+	release := blockWorker(m, "events")
+	const jobs = 5
+	sizes := make(chan int64, jobs)
+	results := make(chan WriteResult, jobs)
+	for range jobs {
+		go func() {
+			results <- m.EnqueueGroup(context.Background(), "events", func(coll *Collection) (WriteResult, error) {
+				// размер файла до сохранения группы одинаков для всех задач
+				info, err := os.Stat(dataPath("events"))
+				if err != nil {
+					return WriteResult{}, err
+				}
+				sizes <- info.Size()
+				_, err = coll.Insert(map[string]any{"n": 1.0})
+				return WriteResult{}, err
+			})
+		}()
+	}
+	waitQueued(t, m, jobs)
+	close(release)
+
+	for range jobs {
+		if r := <-results; r.Error != nil {
+			t.Fatal(r.Error)
+		}
+	}
+	first := <-sizes
+	for range jobs - 1 {
+		if size := <-sizes; size != first {
+			t.Fatal("collection saved between jobs of one group")
+		}
+	}
+	// задача получает ответ, когда группа уже на диске
+	loaded, err := LoadCollection("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Data.Len() != jobs+1 {
+		t.Fatalf("%d documents on disk, want %d", loaded.Data.Len(), jobs+1)
+	}
+}
+
+func TestEnqueueQueueFullTimeout(t *testing.T) {
+	defer func(size int, timeout time.Duration) { WriteQueueSize, QueueTimeout = size, timeout }(WriteQueueSize, QueueTimeout)
+	WriteQueueSize, QueueTimeout = 1, 30*time.Millisecond
+	DataDir = t.TempDir()
+	m := NewManager()
+	defer m.Stop()
+
+	release := blockWorker(m, "events")
+	queued := make(chan WriteResult, 1)
+	go func() {
+		queued <- m.Enqueue(context.Background(), "events", func(*Collection) (WriteResult, error) { return WriteResult{}, nil })
+	}()
+	waitQueued(t, m, 1)
+	defer func() {
+		close(release)
+		<-queued
+	}()
+
+	start := time.Now()
+	r := m.Enqueue(context.Background(), "events", func(*Collection) (WriteResult, error) {
+		t.Error("job ran after the queue was full")
+		return WriteResult{}, nil
+	})
+	if !errors.Is(r.Error, ErrQueueFull) {
+		t.Fatalf("got %v, want ErrQueueFull", r.Error)
+	}
+	if elapsed := time.Since(start); elapsed < QueueTimeout {
+		t.Fatalf("rejected after %v, before the queue timeout", elapsed)
+	}
+}
+
+func TestShutdownDrainsQueuedJobs(t *testing.T) {
+	defer func(size int, timeout time.Duration) { WriteQueueSize, QueueTimeout = size, timeout }(WriteQueueSize, QueueTimeout)
+	WriteQueueSize, QueueTimeout = 2, 0
+	DataDir = t.TempDir()
+	m := NewManager()
+	defer m.Stop()
+
+	release := blockWorker(m, "events")
+	queued := make(chan WriteResult, 2)
+	for range 2 {
+		go func() {
+			queued <- m.EnqueueGroup(context.Background(), "events", func(coll *Collection) (WriteResult, error) {
+				_, err := coll.Insert(map[string]any{"n": 1.0})
+				return WriteResult{}, err
+			})
+		}()
+	}
+	waitQueued(t, m, 2)
+	// очередь полна: эта задача ждёт места
+	waiting := make(chan WriteResult, 1)
+	go func() {
+		waiting <- m.Enqueue(context.Background(), "events", func(*Collection) (WriteResult, error) { return WriteResult{}, nil })
+	}()
+
+	stopped := make(chan struct{})
+	go func() {
+		m.Shutdown()
+		close(stopped)
+	}()
+	<-m.shutdown
+
+	// новые записи и ждущие места в очереди получают отказ сразу,
+	// а не ждут задач, которые уже в очереди
+	rejected := make(chan WriteResult, 1)
+	go func() {
+		rejected <- m.Enqueue(context.Background(), "events", func(*Collection) (WriteResult, error) { return WriteResult{}, nil })
+	}()
+	for _, ch := range []chan WriteResult{rejected, waiting} {
+		select {
+		case r := <-ch:
+			if !errors.Is(r.Error, ErrShuttingDown) {
+				t.Fatalf("write during shutdown: %v", r.Error)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("write during shutdown blocked behind queued jobs")
+		}
+	}
+	select {
+	case <-stopped:
+		t.Fatal("shutdown returned before queued jobs ran")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not finish")
+	}
+	for range 2 {
+		if r := <-queued; r.Error != nil {
+			t.Fatalf("queued job: %v", r.Error)
+		}
+	}
+	loaded, err := LoadCollection("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Data.Len() != 2 {
+		t.Fatalf("%d documents saved, want both queued inserts", loaded.Data.Len())
+	}
+}
+
+func TestEnqueueCanceledBeforeTaken(t *testing.T) {
+	DataDir = t.TempDir()
+	m := NewManager()
+	defer m.Stop()
+
+	release := blockWorker(m, "events")
+	ctx, cancel := context.WithCancel(context.Background())
+	queued := make(chan WriteResult, 1)
+	go func() {
+		queued <- m.Enqueue(ctx, "events", func(*Collection) (WriteResult, error) {
+			t.Error("canceled job ran")
+			return WriteResult{}, nil
+		})
+	}()
+	waitQueued(t, m, 1)
+	cancel()
+
+	// ответ приходит сразу, не дожидаясь занятого воркера
+	select {
+	case r := <-queued:
+		if !errors.Is(r.Error, context.Canceled) {
+			t.Fatalf("got %v, want context.Canceled", r.Error)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("canceled write waited for the busy worker")
+	}
+	close(release)
+
+	// воркер пропускает снятую задачу и выполняет следующую
+	if r := m.Enqueue(context.Background(), "events", func(*Collection) (WriteResult, error) {
+		return WriteResult{Message: "next"}, nil
+	}); r.Error != nil || r.Message != "next" {
+		t.Fatalf("next job: %+v", r)
+	}
+}
+
+func TestEnqueueCanceledAfterTaken(t *testing.T) {
+	DataDir = t.TempDir()
+	m := NewManager()
+	defer m.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan WriteResult, 1)
+	go func() {
+		done <- m.Enqueue(ctx, "events", func(*Collection) (WriteResult, error) {
+			close(started)
+			<-release
+			return WriteResult{Message: "finished"}, nil
+		})
+	}()
+	<-started
+	cancel()
+
+	// взятая задача выполняется до конца, вызывающий получает её результат
+	select {
+	case r := <-done:
+		t.Fatalf("returned %+v while the job was running", r)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if r := <-done; r.Error != nil || r.Message != "finished" {
+		t.Fatalf("got %+v, want the job result", r)
+	}
+}
+
+func TestIdleQueueRetired(t *testing.T) {
+	defer func(idle time.Duration) { QueueIdleTimeout = idle }(QueueIdleTimeout)
+	QueueIdleTimeout = 10 * time.Millisecond
+	DataDir = t.TempDir()
+	m := NewManager()
+	defer m.Stop()
+
+	write := func() {
+		t.Helper()
+		if r := m.Enqueue(context.Background(), "events", func(coll *Collection) (WriteResult, error) {
+			_, err := coll.Insert(map[string]any{"n": 1.0})
+			return WriteResult{}, err
+		}); r.Error != nil {
+			t.Fatal(r.Error)
+		}
+	}
+	write()
+
+	deadline := time.Now().Add(time.Second)
+	for queuedJobs(m, "events") != -1 {
+		if time.Now().After(deadline) {
+			t.Fatal("idle queue was not retired")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// следующая запись заводит очередь заново
+	write()
+	coll, err := m.GetCollection("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if coll.Data.Len() != 2 {
+		t.Fatalf("%d documents, want 2", coll.Data.Len())
+	}
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"nosql_db/internal/metrics"
+)
+
+var (
+	saveDuration = metrics.NewHistogramVec("nosqldb_save_duration_seconds",
+		"Time spent writing collection and index files.", metrics.DefaultBuckets, "collection", "kind")
+	queueWait = metrics.NewHistogramVec("nosqldb_write_queue_wait_seconds",
+		"Time a write job waits in the queue before it starts.", metrics.DefaultBuckets, "collection")
+	groupSize = metrics.NewHistogramVec("nosqldb_group_commit_size",
+		"Write jobs persisted by one group commit.", []float64{1, 2, 4, 8, 16, 32, 64}, "collection")
+	queueRejected = metrics.NewCounterVec("nosqldb_write_queue_rejected_total",
+		"Write jobs rejected because the queue stayed full.", "collection")
+)
+
+func init() {
+	metrics.NewGaugeFunc("nosqldb_write_queue_depth", "Jobs waiting in the write queue.",
+		[]string{"collection"}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, q := range GlobalManager.writeQueues() {
+				samples = append(samples, metrics.Sample{Labels: []string{q.name}, Value: float64(len(q.jobs))})
+			}
+			return samples
+		})
+	metrics.NewGaugeFunc("nosqldb_write_queue_capacity", "Capacity of the write queue.",
+		[]string{"collection"}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, q := range GlobalManager.writeQueues() {
+				samples = append(samples, metrics.Sample{Labels: []string{q.name}, Value: float64(cap(q.jobs))})
+			}
+			return samples
+		})
+	metrics.NewGaugeFunc("nosqldb_collection_documents", "Documents per loaded collection.",
+		[]string{"collection"}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, coll := range GlobalManager.loaded() {
+				samples = append(samples, metrics.Sample{Labels: []string{coll.Name}, Value: float64(coll.Len())})
+			}
+			return samples
+		})
+	metrics.NewGaugeFunc("nosqldb_index_size_bytes", "Size of index files on disk.",
+		[]string{"collection", "field", "compressed"}, func() []metrics.Sample {
+			var samples []metrics.Sample
+			for _, coll := range GlobalManager.loaded() {
+				for _, idx := range coll.Stats().Indexes {
+					samples = append(samples,
+						metrics.Sample{Labels: []string{coll.Name, idx.Field, "false"}, Value: float64(idx.DataSize)},
+						metrics.Sample{Labels: []string{coll.Name, idx.Field, "true"}, Value: float64(idx.StorageSize)},
+					)
+				}
+			}
+			return samples
+		})
+}
+
+// loaded возвращает коллекции, уже загруженные в память
+func (m *CollectionMng) loaded() []*Collection {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	colls := make([]*Collection, 0, len(m.collections))
+	for _, coll := range m.collections {
+		colls = append(colls, coll)
+	}
+	return colls
+}
+
+// writeQueues возвращает запущенные очереди коллекций
+func (m *CollectionMng) writeQueues() []*writeQueue {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	queues := make([]*writeQueue, 0, len(m.queues))
+	for _, q := range m.queues {
+		queues = append(queues, q)
+	}
+	return queues
+}
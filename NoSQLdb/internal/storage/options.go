@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// CollectionOptions — настройки коллекции, хранятся отдельно от данных
+type CollectionOptions struct {
+	Compression Compression    `json:"compression,omitempty"`
+	Validator   *Validator     `json:"validator,omitempty"` // схема документов, nil — без проверки
+	Capped      *CappedOptions `json:"capped,omitempty"`    // nil — коллекция без ограничения размера
+}
+
+func optionsPath(name string) string {
+	return filepath.Join(DataDir, "meta", name+".json")
+}
+
+// loadOptions читает настройки коллекции, ok=false если файла нет
+func loadOptions(name string) (CollectionOptions, bool, error) {
+	var opts CollectionOptions
+	bytes, err := os.ReadFile(optionsPath(name))
+	if os.IsNotExist(err) {
+		return opts, false, nil
+	}
+	if err != nil {
+		return opts, false, fmt.Errorf("failed to read options: %w", err)
+	}
+	if err := json.Unmarshal(bytes, &opts); err != nil {
+		return opts, false, fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.Validator != nil {
+		if err := opts.Validator.compile(); err != nil {
+			return opts, false, fmt.Errorf("invalid validator in options: %w", err)
+		}
+	}
+	return opts, true, nil
+}
+
+// saveOptionsInternal сохраняет настройки без блокировок
+func (c *Collection) saveOptionsInternal() error {
+	path := optionsPath(c.Name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create meta directory: %w", err)
+	}
+	data, err := json.MarshalIndent(c.Options, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal options: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write options: %w", err)
+	}
+	return nil
+}
+
+// SetCompression меняет формат хранения и перезаписывает данные и индексы
+func (c *Collection) SetCompression(comp Compression) error {
+	c.mutex.Lock()
+	c.Options.Compression = comp
+	c.rewriteAllIndexes()
+	err := c.saveOptionsInternal()
+	c.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := c.Save(); err != nil {
+		return err
+	}
+	return c.SaveAllIndexes()
+}
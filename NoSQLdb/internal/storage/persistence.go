@@ -3,36 +3,75 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"nosql_db/internal/index"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
+// DataDir — каталог с файлами коллекций, индексов и настроек
+var DataDir = "data"
+
+func dataPath(name string) string {
+	return filepath.Join(DataDir, name+".json")
+}
+
+func indexDir() string {
+	return filepath.Join(DataDir, "indexes")
+}
+
+func indexPath(collName, fieldName string) string {
+	return filepath.Join(indexDir(), fmt.Sprintf("%s_%s.idx", collName, fieldName))
+}
+
 // LoadCollection загружает коллекцию из базы данных
 func LoadCollection(name string) (*Collection, error) {
-	path := filepath.Join("data", name+".json")
+	coll := NewCollection(name)
+
+	opts, hasOptions, err := loadOptions(name)
+	if err != nil {
+		return nil, err
+	}
+	if hasOptions {
+		coll.Options = opts
+	}
+
+	path := dataPath(name)
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return NewCollection(name), nil
+		return coll, nil
 	}
-	bytes, err := os.ReadFile(path)
+	bytes, format, usage, err := readEncodedFile(path)
 	if err != nil {
 		return nil, err
 	}
+	// без сохранённых настроек формат берётся из самого файла
+	if !hasOptions {
+		coll.Options.Compression = format
+	}
+	coll.dataUsage = usage
 
 	// Файл может существовать, но быть пустым или содержать только пробелы
 	if len(strings.TrimSpace(string(bytes))) == 0 {
-		return NewCollection(name), nil
+		return coll, nil
 	}
 	var raw map[string]any
 	if err := json.Unmarshal(bytes, &raw); err != nil {
 		return nil, fmt.Errorf("unmarshal error: %w", err)
 	}
-	hmap := NewHashMap()
+	store := NewDocumentStore()
 	for k, v := range raw {
-		hmap.Put(k, v)
+		if doc, ok := v.(map[string]any); ok {
+			store.Put(k, doc, coll.writeSeq)
+			coll.ids.Insert(index.ValueToKey(k), []byte(k))
+		}
+	}
+	coll.Data = store
+	coll.dirty = true
+	coll.recountCappedBytes()
+	if err := coll.loadDedup(); err != nil {
+		return nil, err
 	}
-	coll := NewCollection(name)
-	coll.Data = hmap
 	return coll, nil
 }
 
@@ -41,17 +80,48 @@ func (c *Collection) Save() error {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
-	items := c.Data.Items()
-	data, err := json.MarshalIndent(items, "", "  ")
+	start := time.Now()
+	defer func() { saveDuration.Observe(time.Since(start).Seconds(), c.Name, "data") }()
+
+	data, err := c.marshalData()
 	if err != nil {
-		return fmt.Errorf("marshal error: %w", err)
+		return err
 	}
-	if err := os.MkdirAll("data", 0755); err != nil {
+	if err := os.MkdirAll(DataDir, 0755); err != nil {
 		return fmt.Errorf("mkdir error: %w", err)
 	}
-	path := filepath.Join("data", c.Name+".json")
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	path := dataPath(c.Name)
+	usage, err := writeEncodedFile(path, data, c.Options.Compression)
+	if err != nil {
 		return fmt.Errorf("write file error: %w", err)
 	}
+
+	c.usageMu.Lock()
+	c.dataUsage = usage
+	c.usageMu.Unlock()
+	return c.saveDedup()
+}
+
+// marshalData сериализует документы коллекции, вызывается под блокировкой
+func (c *Collection) marshalData() ([]byte, error) {
+	items := c.Data.Items()
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal error: %w", err)
+	}
+	return data, nil
+}
+
+// writeFileAtomic пишет во временный файл и переименовывает его,
+// чтобы на диске никогда не оказался наполовину записанный файл
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
 	return nil
 }
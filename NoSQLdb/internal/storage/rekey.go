@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Смена ключа: новый ключ ставится первым, прежний остаётся в списке для
+// чтения. Новые файлы сразу шифруются новым ключом, а коллекции в фоне
+// перезаписываются целиком через свои очереди записи. Когда перешифрование
+// закончилось, прежний ключ можно убрать
+
+// RekeyState — стадия фонового перешифрования
+type RekeyState string
+
+const (
+	RekeyRunning RekeyState = "running"
+	RekeyDone    RekeyState = "done"
+	RekeyFailed  RekeyState = "failed"
+)
+
+// Rekey — фоновое перешифрование всех коллекций активным ключом
+type Rekey struct {
+	Started time.Time
+
+	total int
+	done  chan struct{}
+
+	mu        sync.Mutex
+	state     RekeyState
+	rewritten int
+	stale     int // файлов не под активным ключом после прохода
+	err       error
+	finished  time.Time
+}
+
+// RekeyProgress — состояние перешифрования для admin-команды
+type RekeyProgress struct {
+	State       RekeyState
+	Collections int
+	Rewritten   int
+	Stale       int
+	Elapsed     time.Duration
+	Error       string
+}
+
+// Progress возвращает текущее состояние перешифрования
+func (r *Rekey) Progress() RekeyProgress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := RekeyProgress{
+		State:       r.state,
+		Collections: r.total,
+		Rewritten:   r.rewritten,
+		Stale:       r.stale,
+	}
+	if r.state == RekeyRunning {
+		p.Elapsed = time.Since(r.Started)
+	} else {
+		p.Elapsed = r.finished.Sub(r.Started)
+	}
+	if r.err != nil {
+		p.Error = r.err.Error()
+	}
+	return p
+}
+
+// Done закрывается, когда перешифрование закончено
+func (r *Rekey) Done() <-chan struct{} {
+	return r.done
+}
+
+// storedFiles — файлы данных, индексов и журналов индексов в DataDir
+func storedFiles() ([]string, error) {
+	var files []string
+	for _, pattern := range []string{
+		filepath.Join(DataDir, "*.json"),
+		filepath.Join(indexDir(), "*.idx"),
+		filepath.Join(indexDir(), "*.idx.log"),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// fileKeys возвращает, какими ключами записан файл: id ключей и признак
+// незашифрованных частей. У журнала индекса записи могут быть под разными ключами
+func fileKeys(path string) (ids []KeyID, plain bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	if filepath.Ext(path) != ".log" {
+		header := make([]byte, sealHeader)
+		n, err := io.ReadFull(f, header)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return nil, false, err
+		}
+		if id, ok := sealedKeyID(header[:n]); ok {
+			return []KeyID{id}, false, nil
+		}
+		return nil, n > 0, nil
+	}
+
+	// у зашифрованной записи заголовок — в первых 20 символах base64
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<30)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if bytes.HasPrefix(line, []byte("{")) {
+			plain = true
+			continue
+		}
+		header := make([]byte, 15)
+		if len(line) < 20 {
+			continue // недописанная запись, при загрузке пропускается
+		}
+		if _, err := base64.StdEncoding.Decode(header, line[:20]); err != nil {
+			continue
+		}
+		if id, ok := sealedKeyID(header); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids, plain, scanner.Err()
+}
+
+// checkFiles проверяет, что ключами r читаются все файлы на диске, и считает
+// файлы, которые нужно перезаписать: под неактивным ключом, а при включённом
+// шифровании ещё и незашифрованные
+func checkFiles(r *KeyRing) (stale int, err error) {
+	files, err := storedFiles()
+	if err != nil {
+		return 0, err
+	}
+	active, encrypting := r.ActiveID()
+	for _, path := range files {
+		ids, plain, err := fileKeys(path)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", path, err)
+		}
+		outdated := plain && encrypting
+		for _, id := range ids {
+			if r == nil {
+				return 0, fmt.Errorf("%s: %w", path, ErrNoKey)
+			}
+			if _, ok := r.keys[id]; !ok {
+				return 0, fmt.Errorf("%s: %w (key id %s)", path, ErrUnknownKey, id)
+			}
+			outdated = outdated || !encrypting || id != active
+		}
+		if outdated {
+			stale++
+		}
+	}
+	return stale, nil
+}
+
+// CheckEncryption проверяет, что заданными ключами читаются все файлы на
+// диске, до загрузки коллекций. Возвращает число файлов, которые нужно
+// перешифровать
+func CheckEncryption() (stale int, err error) {
+	return checkFiles(CurrentKeyRing())
+}
+
+// Rewrite перезаписывает данные и индексы коллекции целиком
+// текущим форматом и активным ключом
+func (c *Collection) Rewrite() error {
+	c.mutex.Lock()
+	c.rewriteAllIndexes()
+	c.mutex.Unlock()
+
+	if err := c.Save(); err != nil {
+		return err
+	}
+	return c.SaveAllIndexes()
+}
+
+// StartRekey запускает фоновую перезапись всех коллекций на диске активным ключом
+func (m *CollectionMng) StartRekey() (*Rekey, error) {
+	names, err := m.ListCollections()
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.rekey != nil && m.rekey.Progress().State == RekeyRunning {
+		return nil, errors.New("re-encryption is already running")
+	}
+	r := &Rekey{
+		Started: time.Now(),
+		total:   len(names),
+		done:    make(chan struct{}),
+		state:   RekeyRunning,
+	}
+	m.rekey = r
+	go m.runRekey(r, names)
+	return r, nil
+}
+
+func (m *CollectionMng) runRekey(r *Rekey, names []string) {
+	var err error
+	for _, name := range names {
+		if err = m.rewriteCollection(name); err != nil {
+			err = fmt.Errorf("collection %s: %w", name, err)
+			break
+		}
+		r.mu.Lock()
+		r.rewritten++
+		r.mu.Unlock()
+	}
+
+	// файлы фоновых построек индексов, начатых до смены ключа, остаются под прежним
+	stale, checkErr := CheckEncryption()
+	if err == nil {
+		err = checkErr
+	}
+
+	r.mu.Lock()
+	r.stale = stale
+	r.err = err
+	r.state = RekeyDone
+	if err != nil {
+		r.state = RekeyFailed
+	}
+	r.finished = time.Now()
+	r.mu.Unlock()
+	close(r.done)
+}
+
+// rewriteCollection перезаписывает коллекцию через её очередь; если очередь
+// занята записью, перешифрование ждёт
+func (m *CollectionMng) rewriteCollection(name string) error {
+	for {
+		result := m.Enqueue(context.Background(), name, func(coll *Collection) (WriteResult, error) {
+			return WriteResult{}, coll.Rewrite()
+		})
+		if !errors.Is(result.Error, ErrQueueFull) {
+			return result.Error
+		}
+	}
+}
+
+// RekeyStatus возвращает последнее перешифрование, nil — его не было
+func (m *CollectionMng) RekeyStatus() *Rekey {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rekey
+}
+
+// RotateKey перечитывает ключи из файла EncryptionKeys.File, проверяет, что
+// ими читаются все файлы, и запускает перешифрование. Текущий активный ключ
+// должен остаться в файле, пока перешифрование не закончится
+func (m *CollectionMng) RotateKey() (*Rekey, error) {
+	if EncryptionKeys.File == "" {
+		return nil, errors.New("encryption keys are not loaded from a key file: change them and restart the server")
+	}
+	next, err := LoadKeyRing(EncryptionKeys)
+	if err != nil {
+		return nil, err
+	}
+	if current, ok := CurrentKeyRing().ActiveID(); ok {
+		if _, kept := next.keys[current]; !kept {
+			return nil, fmt.Errorf("key file must keep the current key %s until re-encryption finishes", current)
+		}
+	}
+	if _, err := checkFiles(next); err != nil {
+		return nil, err
+	}
+	SetKeyRing(next)
+	return m.StartRekey()
+}
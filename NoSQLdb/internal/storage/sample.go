@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"math/rand/v2"
+	"nosql_db/internal/index"
+)
+
+// SampleMatch решает, участвует ли документ в выборке; ошибка прерывает выбор
+type SampleMatch func(doc map[string]any) (bool, error)
+
+// Sample выбирает до n документов снимка равновероятно среди подходящих под match.
+// Reservoir sampling за один проход по корзинам хеш-таблиц: коллекция не
+// копируется, в памяти только n выбранных документов. Порядок результата случаен
+func (s *Snapshot) Sample(n int, match SampleMatch) ([]map[string]any, error) {
+	reservoir := make([]map[string]any, 0, min(n, s.Len()))
+	seen := 0
+	var err error
+	s.Scan(func(doc map[string]any) bool {
+		var ok bool
+		if ok, err = match(doc); err != nil {
+			return false
+		}
+		if !ok {
+			return true
+		}
+		seen++
+		if len(reservoir) < n {
+			reservoir = append(reservoir, doc)
+		} else if i := rand.IntN(seen); i < n {
+			// i-й подходящий документ остаётся в выборке с вероятностью n/i
+			reservoir[i] = doc
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	rand.Shuffle(len(reservoir), func(i, j int) {
+		reservoir[i], reservoir[j] = reservoir[j], reservoir[i]
+	})
+	return reservoir, nil
+}
+
+// SampleIDs выбирает до n документов среди кандидатов из индекса. Кандидаты
+// перемешиваются по ходу выбора (Фишер — Йетс), документы читаются только до
+// n подходящих, поэтому при селективном индексе коллекция почти не читается.
+// ids переставляются на месте
+func (s *Snapshot) SampleIDs(ids []index.Value, n int, match SampleMatch) ([]map[string]any, error) {
+	result := make([]map[string]any, 0, min(n, len(ids)))
+	for i := 0; i < len(ids) && len(result) < n; i++ {
+		j := i + rand.IntN(len(ids)-i)
+		ids[i], ids[j] = ids[j], ids[i]
+
+		doc, ok := s.GetByID(string(ids[i]))
+		if !ok {
+			continue
+		}
+		ok, err := match(doc)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, doc)
+		}
+	}
+	return result, nil
+}
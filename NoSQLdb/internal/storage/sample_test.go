@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"errors"
+	"nosql_db/internal/index"
+	"testing"
+)
+
+func matchAll(map[string]any) (bool, error) { return true, nil }
+
+// checkUniform проверяет, что каждый документ выбирался примерно одинаково часто
+func checkUniform(t *testing.T, counts map[string]int, docs, runs, size int) {
+	t.Helper()
+	if len(counts) != docs {
+		t.Fatalf("%d of %d documents ever sampled", len(counts), docs)
+	}
+	want := runs * size / docs
+	for id, n := range counts {
+		if n < want*3/4 || n > want*5/4 {
+			t.Fatalf("document %s sampled %d times, want about %d", id, n, want)
+		}
+	}
+}
+
+func TestSampleIsUniform(t *testing.T) {
+	DataDir = t.TempDir()
+	coll := NewCollection("sample")
+	for i := range 20 {
+		coll.Insert(map[string]any{"n": float64(i), "even": i%2 == 0})
+	}
+	coll.Commit()
+	snap := coll.Snapshot()
+	defer snap.Release()
+
+	const runs, size = 4000, 3
+	counts := make(map[string]int)
+	for range runs {
+		docs, err := snap.Sample(size, func(doc map[string]any) (bool, error) {
+			return doc["even"] == true, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(docs) != size {
+			t.Fatalf("got %d documents, want %d", len(docs), size)
+		}
+		for _, doc := range docs {
+			if doc["even"] != true {
+				t.Fatalf("sampled a document not matching the filter: %v", doc)
+			}
+			counts[doc[IDField].(string)]++
+		}
+	}
+	checkUniform(t, counts, 10, runs, size)
+
+	// выборка больше коллекции — все подходящие документы
+	docs, _ := snap.Sample(100, matchAll)
+	if len(docs) != 20 {
+		t.Fatalf("got %d documents, want all 20", len(docs))
+	}
+}
+
+func TestSampleIDsReadsOnlyWhatItNeeds(t *testing.T) {
+	DataDir = t.TempDir()
+	coll := NewCollection("sample")
+	var ids []string
+	for i := range 10 {
+		id, _ := coll.Insert(map[string]any{"n": float64(i)})
+		ids = append(ids, id)
+	}
+	coll.Commit()
+	snap := coll.Snapshot()
+	defer snap.Release()
+
+	const runs, size = 4000, 2
+	counts := make(map[string]int)
+	for range runs {
+		candidates := make([]index.Value, len(ids))
+		for i, id := range ids {
+			candidates[i] = index.Value(id)
+		}
+		read := 0
+		docs, err := snap.SampleIDs(candidates, size, func(map[string]any) (bool, error) {
+			read++
+			return true, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(docs) != size || read != size {
+			t.Fatalf("got %d documents after reading %d, want %d", len(docs), read, size)
+		}
+		for _, doc := range docs {
+			counts[doc[IDField].(string)]++
+		}
+	}
+	checkUniform(t, counts, 10, runs, size)
+
+	stop := errors.New("stop")
+	if _, err := snap.SampleIDs([]index.Value{index.Value(ids[0])}, 1, func(map[string]any) (bool, error) {
+		return false, stop
+	}); !errors.Is(err, stop) {
+		t.Fatalf("got %v, want match error", err)
+	}
+}
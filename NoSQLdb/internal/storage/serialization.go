@@ -7,6 +7,8 @@ import (
 // IndexFile структура для сохранения индекса
 type IndexFile struct {
 	Field string           `json:"field"`
+	Type  index.KeyKind    `json:"type,omitempty"`        // тип ключей, пустой — ValueToKey
+	Keys  int              `json:"key_version,omitempty"` // index.KeyVersion, с которой записаны ключи
 	Order int              `json:"order"`
 	Nodes []SerializedNode `json:"nodes"`
 }
@@ -22,8 +24,14 @@ type SerializedNode struct {
 // serializeBTree сериализует b-tree в структуру для json
 func serializeBTree(tree *index.BTree, fieldName string, order int) *IndexFile {
 	if tree == nil || tree.GetRoot() == nil {
+		var kind index.KeyKind
+		if tree != nil {
+			kind = tree.Kind()
+		}
 		return &IndexFile{
 			Field: fieldName,
+			Type:  kind,
+			Keys:  index.KeyVersion,
 			Order: order,
 			Nodes: []SerializedNode{},
 		}
@@ -87,6 +95,8 @@ func serializeBTree(tree *index.BTree, fieldName string, order int) *IndexFile {
 	}
 	return &IndexFile{
 		Field: fieldName,
+		Type:  tree.Kind(),
+		Keys:  index.KeyVersion,
 		Order: order,
 		Nodes: nodes,
 	}
@@ -95,7 +105,9 @@ func serializeBTree(tree *index.BTree, fieldName string, order int) *IndexFile {
 // deserializeBTree восстанавливает b-tree из сериализованных данных
 func deserializeBTree(data *IndexFile) *index.BTree {
 	if len(data.Nodes) == 0 {
-		return index.NewBPlusTree(data.Order)
+		tree := index.NewBPlusTree(data.Order)
+		tree.SetKind(data.Type)
+		return tree
 	}
 	nodes := make([]*index.Node, len(data.Nodes))
 	for i, sn := range data.Nodes {
@@ -119,21 +131,12 @@ func deserializeBTree(data *IndexFile) *index.BTree {
 			for _, childIdx := range sn.Children {
 				if childIdx < len(nodes) {
 					nodes[i].AddChild(nodes[childIdx])
-					nodes[childIdx].SetParent(nodes[i])
 				}
 			}
 		}
 	}
-	var prevLeaf *index.Node
-	for _, node := range nodes {
-		if node.GetIsLeaf() {
-			if prevLeaf != nil {
-				prevLeaf.SetNext(node)
-			}
-			prevLeaf = node
-		}
-	}
 	tree := index.NewBPlusTree(data.Order)
+	tree.SetKind(data.Type)
 	tree.SetRoot(nodes[0])
 	return tree
 }
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"nosql_db/internal/index"
+	"sort"
+	"sync"
+)
+
+// version — опубликованное состояние коллекции: номер версии документов
+// и неизменяемые копии индексов на этот момент
+type version struct {
+	seq     uint64
+	indexes map[string]*index.BTree
+	ids     *index.BTree
+	docs    int
+	capped  bool // обход от новых документов к старым
+}
+
+// mvccState — опубликованная версия и активные снимки
+type mvccState struct {
+	mu      sync.Mutex
+	current *version
+	readers map[uint64]int // число открытых снимков по версии
+}
+
+// garbageDoc — документ, удалённый в версии seq; убирается, когда его не видит ни один снимок
+type garbageDoc struct {
+	id  string
+	seq uint64
+}
+
+// Snapshot — согласованная версия документов и индексов для чтения.
+// Писатель не ждёт читателей и не меняет то, что видит снимок.
+// Снимок нужно закрыть через Release, иначе удалённые документы не будут собраны
+type Snapshot struct {
+	coll    *Collection
+	version *version
+	once    sync.Once
+}
+
+// Snapshot открывает снимок последней опубликованной версии
+func (c *Collection) Snapshot() *Snapshot {
+	c.mvcc.mu.Lock()
+	v := c.mvcc.current
+	c.mvcc.readers[v.seq]++
+	c.mvcc.mu.Unlock()
+	return &Snapshot{coll: c, version: v}
+}
+
+// Release закрывает снимок, повторный вызов ничего не делает
+func (s *Snapshot) Release() {
+	s.once.Do(func() {
+		m := &s.coll.mvcc
+		m.mu.Lock()
+		if m.readers[s.version.seq]--; m.readers[s.version.seq] == 0 {
+			delete(m.readers, s.version.seq)
+		}
+		m.mu.Unlock()
+	})
+}
+
+// Seq — номер версии снимка
+func (s *Snapshot) Seq() uint64 {
+	return s.version.seq
+}
+
+// Len — число документов в снимке
+func (s *Snapshot) Len() int {
+	return s.version.docs
+}
+
+// GetByID возвращает документ, каким он был в версии снимка
+func (s *Snapshot) GetByID(id string) (map[string]any, bool) {
+	return s.coll.Data.GetAt(id, s.version.seq)
+}
+
+// Scan обходит документы снимка; fn возвращает false, чтобы остановиться.
+// Capped-коллекция обходится в порядке вставки от новых к старым,
+// остальные — в неопределённом порядке
+func (s *Snapshot) Scan(fn func(doc map[string]any) bool) {
+	if s.version.capped {
+		s.version.ids.Descend(func(value index.Value) bool {
+			doc, ok := s.GetByID(string(value))
+			return !ok || fn(doc)
+		})
+		return
+	}
+	s.coll.Data.RangeAt(s.version.seq, func(_ string, doc map[string]any) bool {
+		return fn(doc)
+	})
+}
+
+// HasIndex проверяет, был ли индекс на поле в версии снимка; _id индексирован всегда
+func (s *Snapshot) HasIndex(fieldName string) bool {
+	_, ok := s.GetIndex(fieldName)
+	return ok
+}
+
+// GetIndex возвращает неизменяемую копию индекса на момент снимка
+func (s *Snapshot) GetIndex(fieldName string) (*index.BTree, bool) {
+	if fieldName == IDField {
+		return s.version.ids, true
+	}
+	btree, ok := s.version.indexes[fieldName]
+	return btree, ok
+}
+
+// IndexFields возвращает поля индексов снимка по алфавиту
+func (s *Snapshot) IndexFields() []string {
+	fields := make([]string, 0, len(s.version.indexes))
+	for field := range s.version.indexes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Commit публикует изменения писателя для новых снимков и собирает
+// удалённые документы, которые больше никому не видны. Вызывается воркером
+// коллекции после каждой задачи
+func (c *Collection) Commit() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.commitInternal()
+}
+
+// commitInternal — Commit под уже взятой блокировкой
+func (c *Collection) commitInternal() {
+	if !c.dirty {
+		return
+	}
+
+	indexes := make(map[string]*index.BTree, len(c.Indexes))
+	for field, btree := range c.Indexes {
+		indexes[field] = btree.Snapshot()
+	}
+	v := &version{
+		seq:     c.writeSeq,
+		indexes: indexes,
+		ids:     c.ids.Snapshot(),
+		docs:    c.Data.Len(),
+		capped:  c.Options.Capped != nil,
+	}
+
+	c.mvcc.mu.Lock()
+	c.mvcc.current = v
+	horizon := v.seq
+	for seq := range c.mvcc.readers {
+		horizon = min(horizon, seq)
+	}
+	c.mvcc.mu.Unlock()
+
+	c.writeSeq++
+	c.dirty = false
+	c.collectGarbage(horizon)
+}
+
+// collectGarbage убирает документы, удалённые не позже horizon
+func (c *Collection) collectGarbage(horizon uint64) {
+	n := 0
+	for n < len(c.garbage) && c.garbage[n].seq <= horizon {
+		c.Data.Vacuum(c.garbage[n].id, horizon)
+		n++
+	}
+	if n > 0 {
+		c.garbage = append(c.garbage[:0], c.garbage[n:]...)
+	}
+}
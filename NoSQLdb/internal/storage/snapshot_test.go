@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"fmt"
+	"nosql_db/internal/index"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Стресс-тесты снимков, запускать с детектором гонок:
+//
+//	go test -race -run Snapshot ./internal/storage/
+
+func newSnapshotCollection(t *testing.T) *Collection {
+	t.Helper()
+	DataDir = t.TempDir()
+	coll := NewCollection("snap")
+	if err := coll.CreateIndex("pair", 4); err != nil {
+		t.Fatal(err)
+	}
+	coll.Commit()
+	return coll
+}
+
+// writePairs вставляет и удаляет документы парами, каждая пара — один коммит,
+// поэтому любой снимок видит чётное число документов
+func writePairs(coll *Collection, rounds int) {
+	var live [][2]string
+	for i := range rounds {
+		if i%3 == 2 && len(live) > 0 {
+			pair := live[0]
+			live = live[1:]
+			coll.Delete(pair[0])
+			coll.Delete(pair[1])
+		} else {
+			a, _ := coll.Insert(map[string]any{"pair": float64(i), "n": 0.0})
+			b, _ := coll.Insert(map[string]any{"pair": float64(i), "n": 1.0})
+			live = append(live, [2]string{a, b})
+		}
+		coll.Commit()
+	}
+}
+
+func TestSnapshotStress(t *testing.T) {
+	coll := newSnapshotCollection(t)
+
+	const rounds = 3000
+	var done atomic.Bool
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+
+	for range 8 {
+		wg.Go(func() {
+			for !done.Load() {
+				if err := checkSnapshot(coll); err != nil {
+					errs <- err
+					return
+				}
+			}
+		})
+	}
+
+	writePairs(coll, rounds)
+	done.Store(true)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+// checkSnapshot сверяет полный обход снимка с его индексом и счётчиком
+func checkSnapshot(coll *Collection) error {
+	snap := coll.Snapshot()
+	defer snap.Release()
+
+	scanned := make(map[string]bool)
+	snap.Scan(func(doc map[string]any) bool {
+		scanned[doc["_id"].(string)] = true
+		return true
+	})
+	if len(scanned)%2 != 0 {
+		return fmt.Errorf("seq %d: odd number of documents %d", snap.Seq(), len(scanned))
+	}
+	if len(scanned) != snap.Len() {
+		return fmt.Errorf("seq %d: scan found %d documents, Len %d", snap.Seq(), len(scanned), snap.Len())
+	}
+
+	btree, ok := snap.GetIndex("pair")
+	if !ok {
+		return fmt.Errorf("seq %d: index missing", snap.Seq())
+	}
+	ids := index.ValuesToStrings(btree.GetAllValues())
+	if len(ids) != len(scanned) {
+		return fmt.Errorf("seq %d: index has %d ids, scan %d", snap.Seq(), len(ids), len(scanned))
+	}
+	for _, id := range ids {
+		if !scanned[id] {
+			return fmt.Errorf("seq %d: index id %s not in scan", snap.Seq(), id)
+		}
+		if _, ok := snap.GetByID(id); !ok {
+			return fmt.Errorf("seq %d: index id %s not found by GetByID", snap.Seq(), id)
+		}
+	}
+	return nil
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	coll := newSnapshotCollection(t)
+
+	id, _ := coll.Insert(map[string]any{"pair": 1.0})
+	coll.Commit()
+
+	snap := coll.Snapshot()
+	defer snap.Release()
+
+	coll.Delete(id)
+	coll.Insert(map[string]any{"pair": 2.0})
+	coll.Commit()
+
+	if _, ok := snap.GetByID(id); !ok {
+		t.Fatal("deleted document is not visible in an older snapshot")
+	}
+	if snap.Len() != 1 {
+		t.Fatalf("snapshot Len = %d, want 1", snap.Len())
+	}
+	btree, _ := snap.GetIndex("pair")
+	if got := btree.Search(index.ValueToKey(2.0)); len(got) != 0 {
+		t.Fatalf("later insert visible in snapshot index: %v", got)
+	}
+
+	latest := coll.Snapshot()
+	defer latest.Release()
+	if _, ok := latest.GetByID(id); ok {
+		t.Fatal("deleted document is visible in a new snapshot")
+	}
+}
+
+func TestSnapshotGarbageCollection(t *testing.T) {
+	coll := newSnapshotCollection(t)
+
+	id, _ := coll.Insert(map[string]any{"pair": 1.0})
+	coll.Commit()
+
+	snap := coll.Snapshot()
+	coll.Delete(id)
+	coll.Commit()
+
+	// старый снимок держит удалённую версию
+	if coll.Data.head(id) == nil {
+		t.Fatal("version collected while a snapshot still sees it")
+	}
+
+	snap.Release()
+	snap.Release()
+	coll.Insert(map[string]any{"pair": 2.0})
+	coll.Commit()
+
+	if coll.Data.head(id) != nil {
+		t.Fatal("deleted version not collected after the snapshot was released")
+	}
+	if len(coll.garbage) != 0 {
+		t.Fatalf("garbage list has %d entries, want 0", len(coll.garbage))
+	}
+}
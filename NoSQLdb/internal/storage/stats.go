@@ -0,0 +1,69 @@
+package storage
+
+import "nosql_db/internal/index"
+
+// IndexStats — статистика одного индекса
+type IndexStats struct {
+	Field            string
+	Type             index.KeyKind
+	DataSize         int64
+	StorageSize      int64
+	CompressionRatio float64
+}
+
+// CollectionStats — статистика коллекции для команды stats. Размеры
+// и коэффициент сжатия считаются по файлу документов, индексы — отдельно
+type CollectionStats struct {
+	Name             string
+	Documents        int
+	Compression      Compression
+	DataSize         int64
+	StorageSize      int64
+	CompressionRatio float64
+	Indexes          []IndexStats
+	Validator        *Validator
+	Capped           *CappedOptions
+}
+
+// Stats собирает статистику по последнему сохранённому состоянию файлов
+func (c *Collection) Stats() CollectionStats {
+	// список индексов берётся из снимка, чтобы не ждать писателя
+	snap := c.Snapshot()
+	defer snap.Release()
+	fields := snap.IndexFields()
+
+	stats := CollectionStats{
+		Name:        c.Name,
+		Documents:   snap.Len(),
+		Compression: c.Options.Compression,
+		Validator:   c.Validator(),
+		Capped:      c.Capped(),
+	}
+
+	c.usageMu.Lock()
+	defer c.usageMu.Unlock()
+
+	stats.DataSize = c.dataUsage.Raw
+	stats.StorageSize = c.dataUsage.Stored
+	stats.CompressionRatio = compressionRatio(c.dataUsage.Raw, c.dataUsage.Stored)
+	for _, fieldName := range fields {
+		usage := c.indexUsage[fieldName]
+		btree, _ := snap.GetIndex(fieldName)
+		stats.Indexes = append(stats.Indexes, IndexStats{
+			Field:            fieldName,
+			Type:             btree.Kind(),
+			DataSize:         usage.Raw,
+			StorageSize:      usage.Stored,
+			CompressionRatio: compressionRatio(usage.Raw, usage.Stored),
+		})
+	}
+	return stats
+}
+
+// compressionRatio — во сколько раз файлы меньше несжатого содержимого
+func compressionRatio(raw, stored int64) float64 {
+	if stored == 0 {
+		return 1
+	}
+	return float64(raw) / float64(stored)
+}
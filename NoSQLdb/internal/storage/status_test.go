@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestManagerStatusShowsBusyWorkerAndQueue(t *testing.T) {
+	DataDir = t.TempDir()
+	m := NewManager()
+	defer m.Stop()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go m.Enqueue(context.Background(), "status", func(coll *Collection) (WriteResult, error) {
+		close(started)
+		<-release
+		return WriteResult{}, nil
+	})
+	<-started
+	waiting := make(chan WriteResult, 2)
+	for range 2 {
+		go func() {
+			waiting <- m.Enqueue(context.Background(), "status", func(*Collection) (WriteResult, error) { return WriteResult{}, nil })
+		}()
+	}
+	// задачи за занятым воркером стоят в очереди
+	deadline := time.Now().Add(time.Second)
+	var st CollectionStatus
+	for time.Now().Before(deadline) {
+		st = m.Status()[0]
+		if st.QueueDepth == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if st.Name != "status" || !st.Loaded || st.QueueDepth != 2 || st.QueueCapacity != WriteQueueSize || st.Busy <= 0 {
+		t.Fatalf("status while busy %+v", st)
+	}
+
+	close(release)
+	<-waiting
+	<-waiting
+	if st := m.Status()[0]; st.QueueDepth != 0 || st.Busy != 0 {
+		t.Fatalf("status when idle %+v", st)
+	}
+}
@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"nosql_db/internal/index"
+	"os"
+	"path/filepath"
+)
+
+// maxReportExamples — сколько примеров каждого нарушения попадает в отчёт
+const maxReportExamples = 5
+
+// IndexReport — результат проверки одного индекса по документам
+type IndexReport struct {
+	Collection string
+	Field      string
+	Entries    int      // пар ключ-_id в индексе
+	Missing    []string // документы с полем, которых нет в индексе (примеры)
+	Dangling   []string // _id удалённых документов или с устаревшим ключом (примеры)
+	Duplicates []string // _id, записанные в индекс больше одного раза (примеры)
+	Structure  []string // нарушения структуры дерева
+	Repaired   bool
+
+	MissingCount, DanglingCount, DuplicateCount int
+}
+
+// OK — индекс согласован с документами
+func (r IndexReport) OK() bool {
+	return r.MissingCount == 0 && r.DanglingCount == 0 && r.DuplicateCount == 0 && len(r.Structure) == 0
+}
+
+func addExample(examples []string, id string) []string {
+	if len(examples) < maxReportExamples {
+		examples = append(examples, id)
+	}
+	return examples
+}
+
+// ValidateIndexes сверяет индексы с документами по снимку, писателей не задерживает
+func (c *Collection) ValidateIndexes() []IndexReport {
+	snap := c.Snapshot()
+	defer snap.Release()
+
+	fields := snap.IndexFields()
+	reports := make([]IndexReport, 0, len(fields))
+	for _, field := range fields {
+		btree, _ := snap.GetIndex(field)
+		reports = append(reports, validateIndex(snap, c.Name, field, btree))
+	}
+	return reports
+}
+
+// validateIndex ищет записи без документов и с устаревшим ключом, повторы,
+// документы без записи и нарушения структуры дерева
+func validateIndex(snap *Snapshot, collName, field string, btree *index.BTree) IndexReport {
+	r := IndexReport{Collection: collName, Field: field, Structure: btree.Check(maxReportExamples)}
+
+	seen := make(map[string]bool)
+	btree.Ascend(func(key index.Key, values []index.Value) bool {
+		for _, value := range values {
+			id := string(value)
+			r.Entries++
+			if seen[id] {
+				r.DuplicateCount++
+				r.Duplicates = addExample(r.Duplicates, id)
+				continue
+			}
+			seen[id] = true
+			doc, ok := snap.GetByID(id)
+			if !ok {
+				r.DanglingCount++
+				r.Dangling = addExample(r.Dangling, id)
+				continue
+			}
+			if fieldValue, exists := doc[field]; !exists || !bytes.Equal(btree.Key(fieldValue), key) {
+				r.DanglingCount++
+				r.Dangling = addExample(r.Dangling, id)
+			}
+		}
+		return true
+	})
+
+	snap.Scan(func(doc map[string]any) bool {
+		if _, exists := doc[field]; !exists {
+			return true
+		}
+		if id, _ := doc[IDField].(string); !seen[id] {
+			r.MissingCount++
+			r.Missing = addExample(r.Missing, id)
+		}
+		return true
+	})
+	return r
+}
+
+// RepairIndexes перестраивает индексы полей по документам и записывает их целиком
+func (c *Collection) RepairIndexes(fields []string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, field := range fields {
+		btree, ok := c.Indexes[field]
+		if !ok {
+			continue
+		}
+		c.Indexes[field] = c.buildIndex(field, btree.GetOrder(), btree.Kind())
+		c.dirty = true
+		if err := c.saveIndexInternal(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate проверяет индексы коллекции; с repair перестраивает только сломанные
+func (m *CollectionMng) Validate(name string, repair bool) ([]IndexReport, error) {
+	coll, err := m.GetCollection(name)
+	if err != nil {
+		return nil, err
+	}
+	reports := coll.ValidateIndexes()
+	if !repair {
+		return reports, nil
+	}
+
+	var broken []string
+	for _, r := range reports {
+		if !r.OK() {
+			broken = append(broken, r.Field)
+		}
+	}
+	if len(broken) == 0 {
+		return reports, nil
+	}
+	result := m.Enqueue(context.Background(), name, func(coll *Collection) (WriteResult, error) {
+		return WriteResult{}, coll.RepairIndexes(broken)
+	})
+	if result.Error != nil {
+		return reports, fmt.Errorf("repair failed: %w", result.Error)
+	}
+	for i := range reports {
+		reports[i].Repaired = !reports[i].OK()
+	}
+	return reports, nil
+}
+
+// runningMarker — файл, который есть на диске, пока сервер работает.
+// Если он остался при запуске, прошлый процесс не завершился штатно
+func runningMarker() string {
+	return filepath.Join(DataDir, ".running")
+}
+
+// MarkRunning создаёт маркер работы сервера и сообщает, остался ли он от прошлого запуска
+func MarkRunning() (unclean bool, err error) {
+	if _, err := os.Stat(runningMarker()); err == nil {
+		unclean = true
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	if err := os.MkdirAll(DataDir, 0755); err != nil {
+		return unclean, err
+	}
+	return unclean, os.WriteFile(runningMarker(), []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644)
+}
+
+// MarkStopped удаляет маркер после штатной остановки
+func MarkStopped() error {
+	err := os.Remove(runningMarker())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// RepairAll проверяет и чинит индексы всех коллекций на диске и убирает
+// временные файлы прерванных построек. Вызывается при запуске после
+// нештатной остановки, возвращает отчёты по всем индексам
+func (m *CollectionMng) RepairAll() ([]IndexReport, error) {
+	stale, _ := filepath.Glob(filepath.Join(indexDir(), "*.idx.build"))
+	for _, path := range stale {
+		os.Remove(path)
+	}
+
+	names, err := m.ListCollections()
+	if err != nil {
+		return nil, err
+	}
+	var all []IndexReport
+	for _, name := range names {
+		reports, err := m.Validate(name, true)
+		if err != nil {
+			return all, fmt.Errorf("collection %s: %w", name, err)
+		}
+		all = append(all, reports...)
+	}
+	return all, nil
+}
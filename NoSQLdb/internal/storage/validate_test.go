@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"nosql_db/internal/index"
+	"testing"
+)
+
+func TestValidateFindsAndRepairsBrokenIndex(t *testing.T) {
+	DataDir = t.TempDir()
+	m := NewManager()
+	defer m.Stop()
+
+	var kept, lost string
+	m.Enqueue(context.Background(), "check", func(coll *Collection) (WriteResult, error) {
+		kept, _ = coll.Insert(map[string]any{"host": "a", "port": 1.0})
+		lost, _ = coll.Insert(map[string]any{"host": "b", "port": 2.0})
+		if err := coll.CreateIndex("host", 4); err != nil {
+			return WriteResult{}, err
+		}
+		if err := coll.CreateIndex("port", 4); err != nil {
+			return WriteResult{}, err
+		}
+		// запись без документа, пропавшая запись и повтор — только в индексе host
+		btree := coll.Indexes["host"]
+		btree.Insert(index.ValueToKey("ghost"), []byte("no-such-id"))
+		btree.Delete(index.ValueToKey("b"), []byte(lost))
+		btree.Insert(index.ValueToKey("a"), []byte(kept))
+		return WriteResult{}, coll.Save()
+	})
+
+	reports, err := m.Validate("check", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byField := make(map[string]IndexReport)
+	for _, r := range reports {
+		byField[r.Field] = r
+	}
+	host := byField["host"]
+	if host.OK() || host.DanglingCount != 1 || host.MissingCount != 1 || host.DuplicateCount != 1 {
+		t.Fatalf("host report %+v", host)
+	}
+	if host.Missing[0] != lost || host.Dangling[0] != "no-such-id" || host.Duplicates[0] != kept {
+		t.Fatalf("host examples %+v", host)
+	}
+	if !byField["port"].OK() {
+		t.Fatalf("port report %+v", byField["port"])
+	}
+
+	reports, err = m.Validate("check", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range reports {
+		if r.Repaired != (r.Field == "host") {
+			t.Fatalf("%s repaired = %v", r.Field, r.Repaired)
+		}
+	}
+	reports, _ = m.Validate("check", false)
+	for _, r := range reports {
+		if !r.OK() {
+			t.Fatalf("after repair %+v", r)
+		}
+	}
+	// починенный индекс записан на диск целиком
+	if got := searchHost(t, reloadIndexOf(t, "check", "host"), "b"); len(got) != 1 || got[0] != lost {
+		t.Fatalf("reloaded host b: %v, want [%s]", got, lost)
+	}
+}
+
+func TestCheckAcceptsValidTree(t *testing.T) {
+	btree := index.NewBPlusTree(4)
+	for _, host := range []string{"a", "b", "c", "d", "e", "f"} {
+		btree.Insert(index.ValueToKey(host), []byte(host))
+	}
+	if problems := btree.Check(5); len(problems) != 0 {
+		t.Fatalf("valid tree reported %v", problems)
+	}
+}
+
+func TestMarkRunningDetectsUncleanShutdown(t *testing.T) {
+	DataDir = t.TempDir()
+	unclean, err := MarkRunning()
+	if err != nil || unclean {
+		t.Fatalf("first start: unclean=%v err=%v", unclean, err)
+	}
+	// процесс упал, маркер остался
+	if unclean, _ = MarkRunning(); !unclean {
+		t.Fatal("leftover marker not detected")
+	}
+	if err := MarkStopped(); err != nil {
+		t.Fatal(err)
+	}
+	if unclean, _ = MarkRunning(); unclean {
+		t.Fatal("clean stop reported as unclean")
+	}
+}
+
+func TestShutdownRejectsNewWrites(t *testing.T) {
+	DataDir = t.TempDir()
+	m := NewManager()
+	defer m.Stop()
+	if result := m.Enqueue(context.Background(), "down", func(coll *Collection) (WriteResult, error) {
+		_, err := coll.Insert(map[string]any{"host": "a"})
+		return WriteResult{}, err
+	}); result.Error != nil {
+		t.Fatal(result.Error)
+	}
+	m.Shutdown()
+	result := m.Enqueue(context.Background(), "down", func(coll *Collection) (WriteResult, error) { return WriteResult{}, nil })
+	if !errors.Is(result.Error, ErrShuttingDown) {
+		t.Fatalf("got %v, want ErrShuttingDown", result.Error)
+	}
+}
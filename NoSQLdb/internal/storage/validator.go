@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// ValidationMode — что делать с документом, не прошедшим проверку
+type ValidationMode string
+
+const (
+	ValidationStrict ValidationMode = "strict" // вставка отклоняется
+	ValidationWarn   ValidationMode = "warn"   // документ вставляется, нарушения возвращаются в ответе
+)
+
+// FormatRFC3339 — строка с датой в формате RFC3339
+const FormatRFC3339 = "rfc3339"
+
+// Validator — схема документов коллекции, хранится в настройках коллекции
+type Validator struct {
+	Mode     ValidationMode       `json:"mode"`
+	Required []string             `json:"required,omitempty"`
+	Fields   map[string]FieldRule `json:"fields,omitempty"`
+}
+
+// FieldRule — ограничения одного поля, проверяются, если поле есть в документе
+type FieldRule struct {
+	Type    string `json:"type,omitempty"`    // string, number, integer, bool, object, array
+	Enum    []any  `json:"enum,omitempty"`    // допустимые значения
+	Pattern string `json:"pattern,omitempty"` // регулярное выражение для строк
+	Format  string `json:"format,omitempty"`  // rfc3339
+
+	pattern *regexp.Regexp
+}
+
+var fieldTypes = map[string]bool{
+	"string": true, "number": true, "integer": true, "bool": true, "object": true, "array": true,
+}
+
+// ParseValidator разбирает описание схемы из запроса и проверяет его
+func ParseValidator(spec map[string]any) (*Validator, error) {
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid validator: %w", err)
+	}
+	var v Validator
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, fmt.Errorf("invalid validator: %w", err)
+	}
+	if err := v.compile(); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// compile проверяет схему и компилирует шаблоны
+func (v *Validator) compile() error {
+	switch v.Mode {
+	case "":
+		v.Mode = ValidationStrict
+	case ValidationStrict, ValidationWarn:
+	default:
+		return fmt.Errorf("unknown validation mode '%s', expected strict or warn", v.Mode)
+	}
+
+	for field, rule := range v.Fields {
+		if rule.Type != "" && !fieldTypes[rule.Type] {
+			return fmt.Errorf("field '%s': unknown type '%s'", field, rule.Type)
+		}
+		if rule.Format != "" && rule.Format != FormatRFC3339 {
+			return fmt.Errorf("field '%s': unknown format '%s'", field, rule.Format)
+		}
+		if rule.Pattern != "" {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return fmt.Errorf("field '%s': invalid pattern: %w", field, err)
+			}
+			rule.pattern = re
+			v.Fields[field] = rule
+		}
+	}
+	return nil
+}
+
+// Validate возвращает нарушения схемы в документе, nil если их нет
+func (v *Validator) Validate(doc map[string]any) []string {
+	var violations []string
+	for _, field := range v.Required {
+		if _, ok := doc[field]; !ok {
+			violations = append(violations, fmt.Sprintf("field '%s' is required", field))
+		}
+	}
+
+	// поля по алфавиту, чтобы сообщения не зависели от порядка обхода map
+	fields := make([]string, 0, len(v.Fields))
+	for field := range v.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		value, ok := doc[field]
+		if !ok {
+			continue
+		}
+		if msg := v.Fields[field].check(value); msg != "" {
+			violations = append(violations, fmt.Sprintf("field '%s' %s", field, msg))
+		}
+	}
+	return violations
+}
+
+// check проверяет значение поля, возвращает описание нарушения или ""
+func (r FieldRule) check(value any) string {
+	if r.Type != "" && !hasType(value, r.Type) {
+		return fmt.Sprintf("must be %s, got %s", r.Type, typeName(value))
+	}
+	if len(r.Enum) > 0 && !inEnum(value, r.Enum) {
+		return fmt.Sprintf("must be one of %v, got %v", r.Enum, value)
+	}
+	if r.pattern != nil || r.Format != "" {
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Sprintf("must be a string, got %s", typeName(value))
+		}
+		if r.pattern != nil && !r.pattern.MatchString(s) {
+			return fmt.Sprintf("does not match pattern '%s'", r.Pattern)
+		}
+		if r.Format == FormatRFC3339 {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				return fmt.Sprintf("must be an RFC3339 date, got '%s'", s)
+			}
+		}
+	}
+	return ""
+}
+
+func hasType(value any, want string) bool {
+	switch want {
+	case "integer":
+		f, ok := value.(float64)
+		return ok && f == math.Trunc(f)
+	default:
+		return typeName(value) == want
+	}
+}
+
+// typeName — тип значения после разбора JSON
+func typeName(value any) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func inEnum(value any, enum []any) bool {
+	for _, allowed := range enum {
+		if reflect.DeepEqual(value, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetValidator задаёт схему коллекции, nil снимает проверку
+func (c *Collection) SetValidator(v *Validator) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Options.Validator = v
+	return c.saveOptionsInternal()
+}
+
+// Validator возвращает схему коллекции или nil
+func (c *Collection) Validator() *Validator {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.Options.Validator
+}
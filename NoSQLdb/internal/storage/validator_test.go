@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseValidatorRejectsBadSchema(t *testing.T) {
+	for spec, want := range map[string]map[string]any{
+		"unknown validation mode": {"mode": "loose"},
+		"unknown type":            {"fields": map[string]any{"port": map[string]any{"type": "int"}}},
+		"unknown format":          {"fields": map[string]any{"ts": map[string]any{"format": "unix"}}},
+		"invalid pattern":         {"fields": map[string]any{"host": map[string]any{"pattern": "("}}},
+	} {
+		if _, err := ParseValidator(want); err == nil || !strings.Contains(err.Error(), spec) {
+			t.Errorf("%v: got %v, want %q", want, err, spec)
+		}
+	}
+
+	v, err := ParseValidator(map[string]any{"required": []any{"host"}})
+	if err != nil || v.Mode != ValidationStrict {
+		t.Fatalf("default mode: %v, %v", v, err)
+	}
+}
+
+func TestValidateReportsEveryViolation(t *testing.T) {
+	v, err := ParseValidator(map[string]any{
+		"mode":     "warn",
+		"required": []any{"host", "severity"},
+		"fields": map[string]any{
+			"port":     map[string]any{"type": "integer"},
+			"severity": map[string]any{"enum": []any{"low", "high"}},
+			"host":     map[string]any{"pattern": "^web-[0-9]+$"},
+			"ts":       map[string]any{"format": "rfc3339"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok := map[string]any{"host": "web-1", "severity": "high", "port": 22.0, "ts": "2026-01-02T03:04:05Z"}
+	if errs := v.Validate(ok); errs != nil {
+		t.Fatalf("valid document rejected: %v", errs)
+	}
+
+	bad := map[string]any{"host": "db-1", "port": 22.5, "ts": "yesterday", "extra": true}
+	want := []string{
+		"field 'severity' is required",
+		"field 'host' does not match pattern '^web-[0-9]+$'",
+		"field 'port' must be integer, got number",
+		"field 'ts' must be an RFC3339 date, got 'yesterday'",
+	}
+	if errs := v.Validate(bad); !reflect.DeepEqual(errs, want) {
+		t.Fatalf("violations:\n%q\nwant:\n%q", errs, want)
+	}
+	if errs := v.Validate(map[string]any{"host": 7.0, "severity": "mid"}); len(errs) != 2 {
+		t.Fatalf("type and enum violations: %q", errs)
+	}
+}
+
+func TestValidatorSurvivesReload(t *testing.T) {
+	DataDir = t.TempDir()
+	m := NewManager()
+	v, err := ParseValidator(map[string]any{
+		"mode":   "warn",
+		"fields": map[string]any{"host": map[string]any{"pattern": "^web-"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res := m.Enqueue(context.Background(), "schema", func(coll *Collection) (WriteResult, error) {
+		return WriteResult{}, coll.SetValidator(v)
+	}); res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	m.Stop()
+
+	m = NewManager()
+	defer m.Stop()
+	coll, err := m.GetCollection("schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// шаблон компилируется заново при загрузке настроек
+	loaded := coll.Validator()
+	if loaded == nil || loaded.Mode != ValidationWarn || len(loaded.Validate(map[string]any{"host": "db-1"})) != 1 {
+		t.Fatalf("validator after reload: %+v", loaded)
+	}
+}
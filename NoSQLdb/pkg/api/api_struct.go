@@ -0,0 +1,73 @@
+package api
+
+type Request struct {
+	RequestID string           `json:"request_id,omitempty"` // идентификатор для сопоставления ответа
+	Database  string           `json:"database"`             // имя бд
+	Command   string           `json:"operation"`            // операция
+	Data      []map[string]any `json:"data,omitempty"`       // данные
+	Query     map[string]any   `json:"query,omitempty"`      // условия поиска
+
+	MaxTimeMS      int64 `json:"max_time_ms,omitempty"`      // лимит времени выполнения
+	MaxResultBytes int64 `json:"max_result_bytes,omitempty"` // лимит размера ответа
+	Limit          int   `json:"limit,omitempty"`            // сколько документов вернуть find, 0 — все
+
+	BatchID string `json:"batch_id,omitempty"` // ключ идемпотентности пакета insert
+}
+
+type Response struct {
+	RequestID string           `json:"request_id,omitempty"` // request_id из запроса
+	Status    string           `json:"status"`               // success или error
+	Message   string           `json:"message,omitempty"`    // сообщение, если есть ошибка
+	Code      string           `json:"code,omitempty"`       // класс ошибки, см. Code*
+	Data      []map[string]any `json:"data,omitempty"`       // результат запроса
+	Count     int              `json:"count,omitempty"`      // количество документов
+
+	Deduplicated int         `json:"deduplicated,omitempty"` // insert: пропущено повторов по ключу идемпотентности
+	Violations   []Violation `json:"violations,omitempty"`   // нарушения схемы при insert
+}
+
+// Violation — нарушения схемы коллекции в одном документе insert
+type Violation struct {
+	Index  int      `json:"index"`         // номер документа в data
+	ID     string   `json:"_id,omitempty"` // _id, если документ вставлен
+	Errors []string `json:"errors"`
+}
+
+const (
+	StatusSuccess = "success"
+	StatusError   = "error"
+)
+
+// Классы ошибок в Response.Code: по ним шлюз выбирает http-код, а клиенты
+// решают, что делать, не разбирая текст сообщения. Без кода — ошибка запроса
+const (
+	CodeTimeLimit       = "time_limit"       // превышен max_time_ms
+	CodeCanceled        = "canceled"         // запрос отменён клиентом или kill_op
+	CodeUnavailable     = "unavailable"      // очередь записи полна или сервер останавливается
+	CodeUnknownCommand  = "unknown_command"  // неизвестная операция
+	CodeNotKillable     = "not_killable"     // kill_op для запроса, который нельзя прервать
+	CodeSchemaViolation = "schema_violation" // insert нарушил схему коллекции
+)
+
+const (
+	CmdInsert           = "insert"
+	CmdFind             = "find"
+	CmdSample           = "sample" // случайные документы, размер выборки — limit
+	CmdDelete           = "delete"
+	CmdDeleteOne        = "delete_one"         // delete не больше одного документа
+	CmdCreateIndex      = "create_index"       // фоновая постройка индекса
+	CmdIndexBuilds      = "index_builds"       // ход построек индексов
+	CmdCancelIndexBuild = "cancel_index_build" // отмена постройки индекса
+	CmdStats            = "stats"
+	CmdConfigure        = "configure"
+	CmdBackup           = "backup"
+	CmdSetValidator     = "set_validator"     // схема документов коллекции
+	CmdPing             = "ping"              // проверка доступности сервера
+	CmdHello            = "hello"             // настройка режима соединения
+	CmdValidate         = "validate"          // проверка и починка индексов
+	CmdRotateKey        = "rotate_key"        // перечитать ключи и перешифровать данные
+	CmdEncryptionStatus = "encryption_status" // ключи и ход перешифрования
+	CmdServerStatus     = "server_status"     // время работы, соединения, память, очереди
+	CmdCurrentOps       = "current_ops"       // выполняющиеся запросы
+	CmdKillOp           = "kill_op"           // отмена запроса по op_id
+)
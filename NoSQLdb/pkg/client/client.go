@@ -0,0 +1,424 @@
+// Package client — клиент NoSQLdb с пулом соединений, проверкой
+// доступности и переподключением
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"nosql_db/pkg/api"
+	"nosql_db/pkg/wire"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrClosed возвращается после вызова Close
+var ErrClosed = errors.New("client is closed")
+
+// ServerError — ошибка, которую вернул сервер (status=error)
+type ServerError struct {
+	Command string
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Command, e.Message)
+}
+
+// Options — настройки клиента
+type Options struct {
+	Address             string        // host:port сервера
+	PoolSize            int           // максимум одновременно открытых соединений
+	DialTimeout         time.Duration // таймаут установки соединения
+	RequestTimeout      time.Duration // таймаут запроса, если в контексте нет дедлайна; 0 — без таймаута
+	HealthCheckInterval time.Duration // как часто проверять простаивающие соединения; 0 — не проверять
+	MaxRetries          int           // сколько раз повторять запрос после сетевой ошибки
+	InitialBackoff      time.Duration // пауза перед первым повтором
+	MaxBackoff          time.Duration // верхняя граница паузы
+	Protocol            string        // "json" (по умолчанию) или "msgpack" — кадровый бинарный протокол
+	Compression         string        // "gzip" — сжимать крупные кадры; только с Protocol "msgpack"
+}
+
+// DefaultOptions возвращает настройки по умолчанию для адреса
+func DefaultOptions(address string) Options {
+	return Options{
+		Address:             address,
+		PoolSize:            4,
+		DialTimeout:         5 * time.Second,
+		HealthCheckInterval: 30 * time.Second,
+		MaxRetries:          3,
+		InitialBackoff:      100 * time.Millisecond,
+		MaxBackoff:          5 * time.Second,
+	}
+}
+
+// Client безопасен для использования из нескольких горутин
+type Client struct {
+	opts Options
+
+	idle  chan *conn    // свободные соединения
+	slots chan struct{} // ограничивает число соединений PoolSize
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// conn — одно соединение пула; сервер отвечает на запросы по порядку
+type conn struct {
+	net.Conn
+	encoder *json.Encoder
+	decoder *json.Decoder
+
+	framer   *wire.Framer // не nil после перехода на msgpack
+	compress bool
+}
+
+// exchange отправляет запрос и читает ответ в формате соединения
+func (cn *conn) exchange(req api.Request) (api.Response, error) {
+	var resp api.Response
+	if cn.framer == nil {
+		err := cn.encoder.Encode(req)
+		if err == nil {
+			err = cn.decoder.Decode(&resp)
+		}
+		return resp, err
+	}
+
+	payload, err := wire.MarshalRequest(req)
+	if err != nil {
+		return resp, err
+	}
+	if err := cn.framer.WriteFrame(payload, cn.compress); err != nil {
+		return resp, err
+	}
+	if payload, err = cn.framer.ReadFrame(); err != nil {
+		return resp, err
+	}
+	return wire.UnmarshalResponse(payload)
+}
+
+// dialError — сервер не получил запрос, его всегда можно повторить
+type dialError struct{ err error }
+
+func (e *dialError) Error() string { return fmt.Sprintf("connect: %v", e.err) }
+func (e *dialError) Unwrap() error { return e.err }
+
+// New создаёт клиента; соединения открываются по мере надобности
+func New(opts Options) (*Client, error) {
+	if opts.Address == "" {
+		return nil, errors.New("address is required")
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 1
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff < opts.InitialBackoff {
+		opts.MaxBackoff = opts.InitialBackoff
+	}
+	switch opts.Protocol {
+	case "", "json", wire.Protocol:
+	default:
+		return nil, fmt.Errorf("unknown protocol '%s'", opts.Protocol)
+	}
+	switch opts.Compression {
+	case "", "none":
+	case wire.CompressionGzip:
+		if opts.Protocol != wire.Protocol {
+			return nil, fmt.Errorf("compression requires protocol '%s'", wire.Protocol)
+		}
+	default:
+		return nil, fmt.Errorf("unknown compression '%s'", opts.Compression)
+	}
+
+	c := &Client{
+		opts:  opts,
+		idle:  make(chan *conn, opts.PoolSize),
+		slots: make(chan struct{}, opts.PoolSize),
+		done:  make(chan struct{}),
+	}
+	if opts.HealthCheckInterval > 0 {
+		go c.healthLoop()
+	}
+	return c, nil
+}
+
+// Dial — New с настройками по умолчанию
+func Dial(address string) (*Client, error) {
+	return New(DefaultOptions(address))
+}
+
+// Close закрывает все простаивающие соединения; занятые закроются по завершении запроса
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		for {
+			select {
+			case cn := <-c.idle:
+				cn.Close()
+			default:
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// Do отправляет произвольный запрос. Ответ со status=error возвращается
+// вместе с *ServerError
+func (c *Client) Do(ctx context.Context, req api.Request) (*api.Response, error) {
+	backoff := c.opts.InitialBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.roundTrip(ctx, req)
+		if err == nil {
+			if resp.Status == api.StatusError {
+				return resp, &ServerError{Command: req.Command, Message: resp.Message}
+			}
+			return resp, nil
+		}
+		if attempt >= c.opts.MaxRetries || !retryable(err, req) {
+			return nil, err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-c.done:
+			timer.Stop()
+			return nil, ErrClosed
+		}
+		backoff = min(backoff*2, c.opts.MaxBackoff)
+	}
+}
+
+// retryable: ошибку соединения повторяем всегда, обрыв посреди запроса —
+// только для команд без побочных эффектов и insert с batch_id, иначе запись
+// может выполниться дважды
+func retryable(err error, req api.Request) bool {
+	if errors.Is(err, ErrClosed) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var de *dialError
+	if errors.As(err, &de) {
+		return true
+	}
+	switch req.Command {
+	case api.CmdFind, api.CmdSample, api.CmdStats, api.CmdPing, api.CmdIndexBuilds,
+		api.CmdServerStatus, api.CmdCurrentOps:
+		return true
+	case api.CmdInsert:
+		return req.BatchID != ""
+	}
+	return false
+}
+
+// roundTrip выполняет один запрос на соединении из пула
+func (c *Client) roundTrip(ctx context.Context, req api.Request) (*api.Response, error) {
+	if c.opts.RequestTimeout > 0 {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.opts.RequestTimeout)
+			defer cancel()
+		}
+	}
+
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// серверу передаём оставшееся время, чтобы он не работал впустую
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline && req.MaxTimeMS == 0 {
+		req.MaxTimeMS = max(time.Until(deadline).Milliseconds(), 1)
+	}
+	_ = cn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		_ = cn.SetDeadline(time.Now())
+	})
+
+	resp, err := cn.exchange(req)
+	if !stop() || err != nil {
+		// соединение в неизвестном состоянии: в пул его не возвращаем
+		cn.Close()
+		c.release(nil)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+
+	_ = cn.SetDeadline(time.Time{})
+	c.release(cn)
+	return &resp, nil
+}
+
+// get занимает слот пула и возвращает свободное или новое соединение
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, ErrClosed
+	}
+
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+
+	cn, err := c.dial(ctx)
+	if err != nil {
+		<-c.slots
+		return nil, err
+	}
+	return cn, nil
+}
+
+// release освобождает слот; живое соединение возвращается в пул
+func (c *Client) release(cn *conn) {
+	defer func() { <-c.slots }()
+	if cn == nil {
+		return
+	}
+	select {
+	case <-c.done:
+		cn.Close()
+		return
+	default:
+	}
+	select {
+	case c.idle <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	dialer := net.Dialer{Timeout: c.opts.DialTimeout}
+	nc, err := dialer.DialContext(ctx, "tcp", c.opts.Address)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, &dialError{err: err}
+	}
+	cn := &conn{
+		Conn:    nc,
+		encoder: json.NewEncoder(nc),
+		decoder: json.NewDecoder(nc),
+	}
+	if c.opts.Protocol == wire.Protocol {
+		if err := c.negotiate(ctx, cn); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// negotiate переводит соединение на кадровый протокол. Сервер, который
+// не знает о протоколах, отвечает на hello ошибкой или не возвращает
+// protocol в ответе — соединение остаётся на JSON
+func (c *Client) negotiate(ctx context.Context, cn *conn) error {
+	var deadline time.Time
+	if c.opts.DialTimeout > 0 {
+		deadline = time.Now().Add(c.opts.DialTimeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	_ = cn.SetDeadline(deadline)
+
+	query := map[string]any{"protocol": wire.Protocol}
+	if c.opts.Compression != "" {
+		query["compression"] = c.opts.Compression
+	}
+	resp, err := cn.exchange(api.Request{Command: api.CmdHello, Query: query})
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return &dialError{err: err}
+	}
+	_ = cn.SetDeadline(time.Time{})
+	if resp.Status == api.StatusError {
+		if legacyHello(resp.Message) {
+			return nil
+		}
+		return &ServerError{Command: api.CmdHello, Message: resp.Message}
+	}
+
+	if len(resp.Data) == 0 || resp.Data[0]["protocol"] != wire.Protocol {
+		return nil
+	}
+	// ответ на hello прочитан целиком: всё, что после него, — кадры
+	cn.framer = wire.NewFramer(wire.AfterJSON(io.MultiReader(cn.decoder.Buffered(), cn.Conn)), cn.Conn)
+	cn.compress = resp.Data[0]["compression"] == wire.CompressionGzip
+	return nil
+}
+
+// legacyHello — ответ сервера, который не знает команду hello: до протоколов
+// он требовал database у каждой команды, а неизвестные отклонял
+func legacyHello(message string) bool {
+	return strings.HasPrefix(message, "unknown command") || message == "database name is required"
+}
+
+// healthLoop пингует простаивающие соединения: мёртвые закрываются,
+// живые не успевают упасть по таймауту простоя на сервере
+func (c *Client) healthLoop() {
+	ticker := time.NewTicker(c.opts.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		for range len(c.idle) {
+			select {
+			case c.slots <- struct{}{}:
+			default:
+				// все слоты заняты запросами — проверка не нужна
+				continue
+			}
+			var cn *conn
+			select {
+			case cn = <-c.idle:
+			default:
+				<-c.slots
+				continue
+			}
+			c.check(cn)
+		}
+	}
+}
+
+func (c *Client) check(cn *conn) {
+	timeout := c.opts.DialTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	_ = cn.SetDeadline(time.Now().Add(timeout))
+
+	resp, err := cn.exchange(api.Request{Command: api.CmdPing})
+	if err != nil || resp.Status != api.StatusSuccess {
+		cn.Close()
+		c.release(nil)
+		return
+	}
+	_ = cn.SetDeadline(time.Time{})
+	c.release(cn)
+}
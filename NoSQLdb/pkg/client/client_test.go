@@ -0,0 +1,385 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"nosql_db/pkg/api"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer отвечает на запросы в JSON по строке. handle возвращает ответ;
+// drop=true — соединение закрывается, не ответив
+type fakeServer struct {
+	ln     net.Listener
+	handle func(req api.Request) (resp api.Response, drop bool)
+
+	mu        sync.Mutex
+	conns     int // сколько соединений было принято
+	inflight  int
+	maxFlight int
+	requests  []api.Request
+}
+
+func newFakeServer(t *testing.T, handle func(req api.Request) (api.Response, bool)) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{ln: ln, handle: handle}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+// ok — ответ по умолчанию
+func ok(api.Request) (api.Response, bool) {
+	return api.Response{Status: api.StatusSuccess}, false
+}
+
+func (s *fakeServer) serve() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns++
+		s.mu.Unlock()
+		go s.serveConn(nc)
+	}
+}
+
+func (s *fakeServer) serveConn(nc net.Conn) {
+	defer nc.Close()
+	decoder := json.NewDecoder(nc)
+	encoder := json.NewEncoder(nc)
+	for {
+		var req api.Request
+		if err := decoder.Decode(&req); err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.requests = append(s.requests, req)
+		s.inflight++
+		s.maxFlight = max(s.maxFlight, s.inflight)
+		s.mu.Unlock()
+
+		resp, drop := s.handle(req)
+
+		s.mu.Lock()
+		s.inflight--
+		s.mu.Unlock()
+		if drop {
+			return
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// commands — команды, которые получил сервер
+func (s *fakeServer) commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, len(s.requests))
+	for i, req := range s.requests {
+		out[i] = req.Command
+	}
+	return out
+}
+
+func (s *fakeServer) connCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+func testOptions(addr string) Options {
+	return Options{
+		Address:        addr,
+		PoolSize:       2,
+		DialTimeout:    time.Second,
+		MaxRetries:     3,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     40 * time.Millisecond,
+	}
+}
+
+func newTestClient(t *testing.T, opts Options) *Client {
+	t.Helper()
+	c, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestPoolLimitsConnections(t *testing.T) {
+	gate := make(chan struct{})
+	srv := newFakeServer(t, func(req api.Request) (api.Response, bool) {
+		<-gate
+		return api.Response{Status: api.StatusSuccess}, false
+	})
+	c := newTestClient(t, testOptions(srv.ln.Addr().String()))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 6)
+	for range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- c.Ping(context.Background())
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(gate)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv.mu.Lock()
+	maxFlight := srv.maxFlight
+	srv.mu.Unlock()
+	if maxFlight != 2 || srv.connCount() != 2 {
+		t.Fatalf("pool of 2: %d requests at once over %d connections", maxFlight, srv.connCount())
+	}
+	if len(c.idle) != 2 {
+		t.Fatalf("%d idle connections after requests, want 2 kept for reuse", len(c.idle))
+	}
+}
+
+func TestRequestWaitsForPoolSlot(t *testing.T) {
+	gate := make(chan struct{})
+	srv := newFakeServer(t, func(req api.Request) (api.Response, bool) {
+		<-gate
+		return api.Response{Status: api.StatusSuccess}, false
+	})
+	defer close(gate)
+	opts := testOptions(srv.ln.Addr().String())
+	opts.PoolSize = 1
+	c := newTestClient(t, opts)
+
+	go c.Ping(context.Background())
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := c.Ping(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("request past a full pool: %v, want deadline exceeded", err)
+	}
+}
+
+func TestReconnectsWithBackoff(t *testing.T) {
+	// адрес, на котором сервер появится не сразу
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	started := make(chan struct{})
+	go func() {
+		defer close(started)
+		time.Sleep(60 * time.Millisecond)
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return
+		}
+		t.Cleanup(func() { ln.Close() })
+		srv := &fakeServer{ln: ln, handle: ok}
+		go srv.serve()
+	}()
+
+	opts := testOptions(addr)
+	opts.MaxRetries = 10
+	c := newTestClient(t, opts)
+	begin := time.Now()
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatalf("no reconnect after the server came up: %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed < 60*time.Millisecond {
+		t.Fatalf("succeeded in %v, before the server started", elapsed)
+	}
+	<-started
+}
+
+func TestBackoffGivesUpAfterMaxRetries(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	opts := testOptions(addr)
+	opts.MaxRetries = 3
+	c := newTestClient(t, opts)
+	begin := time.Now()
+	err = c.Ping(context.Background())
+	var de *dialError
+	if !errors.As(err, &de) {
+		t.Fatalf("got %v, want a connect error", err)
+	}
+	// паузы 10, 20 и 40 мс перед повторами
+	if elapsed := time.Since(begin); elapsed < 70*time.Millisecond {
+		t.Fatalf("gave up after %v, backoff not applied", elapsed)
+	}
+}
+
+func TestDroppedConnectionRetriesOnlySafeRequests(t *testing.T) {
+	var mu sync.Mutex
+	dropped := make(map[string]bool)
+	srv := newFakeServer(t, func(req api.Request) (api.Response, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		// первый запрос каждой команды обрывается посреди ответа
+		key := req.Command + req.BatchID
+		if !dropped[key] {
+			dropped[key] = true
+			return api.Response{}, true
+		}
+		return api.Response{Status: api.StatusSuccess, Count: 1}, false
+	})
+	c := newTestClient(t, testOptions(srv.ln.Addr().String()))
+	ctx := context.Background()
+
+	if _, err := c.Find(ctx, "events", nil); err != nil {
+		t.Fatalf("find not retried: %v", err)
+	}
+	if _, err := c.Insert(ctx, "events", map[string]any{"n": 1}); err == nil {
+		t.Fatal("insert without batch_id was retried after a dropped connection")
+	}
+	if _, _, err := c.InsertBatch(ctx, "events", "batch-1", map[string]any{"n": 1}); err != nil {
+		t.Fatalf("insert with batch_id not retried: %v", err)
+	}
+
+	want := []string{api.CmdFind, api.CmdFind, api.CmdInsert, api.CmdInsert, api.CmdInsert}
+	got := srv.commands()
+	if len(got) != len(want) {
+		t.Fatalf("server got %v, want %v", got, want)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	dropped := io.ErrUnexpectedEOF
+	cases := []struct {
+		name string
+		err  error
+		req  api.Request
+		want bool
+	}{
+		{"connect error", &dialError{err: errors.New("refused")}, api.Request{Command: api.CmdInsert}, true},
+		{"find", dropped, api.Request{Command: api.CmdFind}, true},
+		{"sample", dropped, api.Request{Command: api.CmdSample}, true},
+		{"stats", dropped, api.Request{Command: api.CmdStats}, true},
+		{"ping", dropped, api.Request{Command: api.CmdPing}, true},
+		{"insert", dropped, api.Request{Command: api.CmdInsert}, false},
+		{"insert with batch_id", dropped, api.Request{Command: api.CmdInsert, BatchID: "b1"}, true},
+		{"delete", dropped, api.Request{Command: api.CmdDelete}, false},
+		{"configure", dropped, api.Request{Command: api.CmdConfigure}, false},
+		{"kill_op", dropped, api.Request{Command: api.CmdKillOp}, false},
+		{"canceled", context.Canceled, api.Request{Command: api.CmdFind}, false},
+		{"deadline", context.DeadlineExceeded, api.Request{Command: api.CmdFind}, false},
+		{"closed", ErrClosed, api.Request{Command: api.CmdFind}, false},
+	}
+	for _, tc := range cases {
+		if got := retryable(tc.err, tc.req); got != tc.want {
+			t.Errorf("%s: retryable = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestHealthCheckDropsDeadConnections(t *testing.T) {
+	var mu sync.Mutex
+	pingsOnIdle := 0
+	srv := newFakeServer(t, func(req api.Request) (api.Response, bool) {
+		if req.Command != api.CmdPing {
+			return api.Response{Status: api.StatusSuccess}, false
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		pingsOnIdle++
+		// после первой проверки сервер «умирает» для этого соединения
+		return api.Response{Status: api.StatusSuccess}, pingsOnIdle > 1
+	})
+	opts := testOptions(srv.ln.Addr().String())
+	opts.HealthCheckInterval = 20 * time.Millisecond
+	c := newTestClient(t, opts)
+
+	if _, err := c.Stats(context.Background(), "events"); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.idle) != 1 {
+		t.Fatalf("%d idle connections, want 1", len(c.idle))
+	}
+
+	pings := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return pingsOnIdle
+	}
+	// первая проверка оставляет соединение в пуле, вторая его закрывает
+	deadline := time.Now().Add(time.Second)
+	for (pings() < 2 || len(c.idle) != 0) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if pings() < 2 || len(c.idle) != 0 {
+		t.Fatalf("after %d health check pings %d idle connections, want the dead one dropped", pings(), len(c.idle))
+	}
+
+	// слот освобождён: следующий запрос открывает новое соединение
+	if _, err := c.Stats(context.Background(), "events"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.connCount() != 2 {
+		t.Fatalf("%d connections, want a new one after the dead was dropped", srv.connCount())
+	}
+}
+
+func TestMsgpackFallsBackToJSONOnOldServer(t *testing.T) {
+	for _, message := range []string{"unknown command: hello", "database name is required"} {
+		srv := newFakeServer(t, func(req api.Request) (api.Response, bool) {
+			if req.Command == api.CmdHello {
+				return api.Response{Status: api.StatusError, Message: message}, false
+			}
+			return api.Response{Status: api.StatusSuccess}, false
+		})
+		opts := testOptions(srv.ln.Addr().String())
+		opts.Protocol = "msgpack"
+		c := newTestClient(t, opts)
+		if err := c.Ping(context.Background()); err != nil {
+			t.Fatalf("hello answered %q: %v", message, err)
+		}
+		if got := srv.commands(); len(got) != 2 || got[1] != api.CmdPing {
+			t.Fatalf("server got %v, want hello then ping over json", got)
+		}
+	}
+}
+
+func TestMsgpackHelloErrorIsReported(t *testing.T) {
+	srv := newFakeServer(t, func(req api.Request) (api.Response, bool) {
+		return api.Response{Status: api.StatusError, Message: "unknown compression 'gzip'"}, false
+	})
+	opts := testOptions(srv.ln.Addr().String())
+	opts.Protocol = "msgpack"
+	opts.Compression = "gzip"
+	opts.MaxRetries = 0
+	c := newTestClient(t, opts)
+	var se *ServerError
+	if err := c.Ping(context.Background()); !errors.As(err, &se) || se.Command != api.CmdHello {
+		t.Fatalf("got %v, want the hello error", err)
+	}
+}
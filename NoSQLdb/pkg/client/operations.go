@@ -0,0 +1,280 @@
+package client
+
+import (
+	"context"
+	"nosql_db/pkg/api"
+)
+
+// Insert добавляет документы в коллекцию, возвращает число вставленных
+func (c *Client) Insert(ctx context.Context, collection string, docs ...map[string]any) (int, error) {
+	resp, err := c.Do(ctx, api.Request{
+		Database: collection,
+		Command:  api.CmdInsert,
+		Data:     docs,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
+// InsertBatch добавляет пакет идемпотентно: повтор с тем же batchID в пределах
+// окна сервера не создаёт дублей. Возвращает число вставленных и пропущенных документов
+func (c *Client) InsertBatch(ctx context.Context, collection, batchID string, docs ...map[string]any) (inserted, deduplicated int, err error) {
+	resp, err := c.Do(ctx, api.Request{
+		Database: collection,
+		Command:  api.CmdInsert,
+		Data:     docs,
+		BatchID:  batchID,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return resp.Count, resp.Deduplicated, nil
+}
+
+// Find возвращает документы, подходящие под запрос; nil — все документы
+func (c *Client) Find(ctx context.Context, collection string, query map[string]any) ([]map[string]any, error) {
+	resp, err := c.Do(ctx, api.Request{
+		Database: collection,
+		Command:  api.CmdFind,
+		Query:    query,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// FindAfter возвращает до limit документов с _id больше afterID по возрастанию _id.
+// Пустой afterID — с начала коллекции; следующая страница — от _id последнего документа
+func (c *Client) FindAfter(ctx context.Context, collection, afterID string, limit int) ([]map[string]any, error) {
+	query := map[string]any{"_id": map[string]any{"$gt": afterID}}
+	resp, err := c.Do(ctx, api.Request{
+		Database: collection,
+		Command:  api.CmdFind,
+		Query:    query,
+		Limit:    limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// Sample возвращает до size случайных документов, подходящих под запрос; nil — из всех.
+// Каждый подходящий документ попадает в выборку с равной вероятностью
+func (c *Client) Sample(ctx context.Context, collection string, query map[string]any, size int) ([]map[string]any, error) {
+	resp, err := c.Do(ctx, api.Request{
+		Database: collection,
+		Command:  api.CmdSample,
+		Query:    query,
+		Limit:    size,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// Delete удаляет документы по запросу, возвращает число удалённых
+func (c *Client) Delete(ctx context.Context, collection string, query map[string]any) (int, error) {
+	resp, err := c.Do(ctx, api.Request{
+		Database: collection,
+		Command:  api.CmdDelete,
+		Query:    query,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
+// DeleteOne удаляет один документ по запросу, false — подходящих нет
+func (c *Client) DeleteOne(ctx context.Context, collection string, query map[string]any) (bool, error) {
+	resp, err := c.Do(ctx, api.Request{
+		Database: collection,
+		Command:  api.CmdDeleteOne,
+		Query:    query,
+	})
+	if err != nil {
+		return false, err
+	}
+	return resp.Count > 0, nil
+}
+
+// CreateIndex запускает фоновую постройку индекса по полю; ход постройки — IndexBuilds
+func (c *Client) CreateIndex(ctx context.Context, collection, field string) error {
+	_, err := c.Do(ctx, api.Request{
+		Database: collection,
+		Command:  api.CmdCreateIndex,
+		Query:    map[string]any{field: 1},
+	})
+	return err
+}
+
+// CreateIPIndex запускает постройку индекса по полю с IP-адресами: $cidr, $gt
+// и $lt по нему становятся обходом диапазона
+func (c *Client) CreateIPIndex(ctx context.Context, collection, field string) error {
+	_, err := c.Do(ctx, api.Request{
+		Database: collection,
+		Command:  api.CmdCreateIndex,
+		Query:    map[string]any{field: "ip"},
+	})
+	return err
+}
+
+// IndexBuilds возвращает идущие и последние завершённые постройки индексов
+// коллекции: state (running, done, failed, canceled), processed, total, percent
+func (c *Client) IndexBuilds(ctx context.Context, collection string) ([]map[string]any, error) {
+	resp, err := c.Do(ctx, api.Request{
+		Database: collection,
+		Command:  api.CmdIndexBuilds,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// CancelIndexBuild отменяет постройку индекса по полю
+func (c *Client) CancelIndexBuild(ctx context.Context, collection, field string) error {
+	_, err := c.Do(ctx, api.Request{
+		Database: collection,
+		Command:  api.CmdCancelIndexBuild,
+		Query:    map[string]any{"field": field},
+	})
+	return err
+}
+
+// Validate сверяет индексы коллекции с документами, пустое имя — всех коллекций.
+// С repair сломанные индексы перестраиваются; по элементу на индекс:
+// field, entries, ok, missing, dangling, duplicates, structure, repaired
+func (c *Client) Validate(ctx context.Context, collection string, repair bool) ([]map[string]any, error) {
+	req := api.Request{
+		Database: collection,
+		Command:  api.CmdValidate,
+	}
+	if repair {
+		req.Query = map[string]any{"repair": true}
+	}
+	resp, err := c.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// Stats возвращает статистику коллекции
+func (c *Client) Stats(ctx context.Context, collection string) (map[string]any, error) {
+	resp, err := c.Do(ctx, api.Request{
+		Database: collection,
+		Command:  api.CmdStats,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return map[string]any{}, nil
+	}
+	return resp.Data[0], nil
+}
+
+// Configure меняет настройки коллекции, например {"compression": "gzip"}
+// или {"max_docs": 10000, "max_bytes": 1048576} для capped-коллекции
+func (c *Client) Configure(ctx context.Context, collection string, settings map[string]any) error {
+	_, err := c.Do(ctx, api.Request{
+		Database: collection,
+		Command:  api.CmdConfigure,
+		Query:    settings,
+	})
+	return err
+}
+
+// SetValidator задаёт схему документов коллекции, nil снимает проверку.
+// Пример: {"mode": "strict", "required": ["timestamp"], "fields": {"severity": {"enum": ["low", "high"]}}}
+func (c *Client) SetValidator(ctx context.Context, collection string, schema map[string]any) error {
+	_, err := c.Do(ctx, api.Request{
+		Database: collection,
+		Command:  api.CmdSetValidator,
+		Query:    schema,
+	})
+	return err
+}
+
+// Backup создаёт архив выбранных коллекций (пустой список — все) и
+// возвращает ответ сервера с путём к архиву в Message
+func (c *Client) Backup(ctx context.Context, collections []string, name string) (*api.Response, error) {
+	query := map[string]any{}
+	if len(collections) > 0 {
+		list := make([]any, len(collections))
+		for i, coll := range collections {
+			list[i] = coll
+		}
+		query["collections"] = list
+	}
+	if name != "" {
+		query["name"] = name
+	}
+	return c.Do(ctx, api.Request{Command: api.CmdBackup, Query: query})
+}
+
+// RotateKey перечитывает файл ключей шифрования на сервере и запускает
+// фоновое перешифрование; ход — EncryptionStatus
+func (c *Client) RotateKey(ctx context.Context) (map[string]any, error) {
+	resp, err := c.Do(ctx, api.Request{Command: api.CmdRotateKey})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return map[string]any{}, nil
+	}
+	return resp.Data[0], nil
+}
+
+// EncryptionStatus возвращает enabled, active_key, keys и rekey — ход последнего перешифрования
+func (c *Client) EncryptionStatus(ctx context.Context) (map[string]any, error) {
+	resp, err := c.Do(ctx, api.Request{Command: api.CmdEncryptionStatus})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return map[string]any{}, nil
+	}
+	return resp.Data[0], nil
+}
+
+// ServerStatus возвращает uptime_s, connections, memory, operations, queued
+// и collections — загруженные коллекции с очередями записи
+func (c *Client) ServerStatus(ctx context.Context) (map[string]any, error) {
+	resp, err := c.Do(ctx, api.Request{Command: api.CmdServerStatus})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return map[string]any{}, nil
+	}
+	return resp.Data[0], nil
+}
+
+// CurrentOps возвращает выполняющиеся запросы: op_id, client, operation,
+// collection, elapsed_ms, query_shape. Пустое имя — по всем коллекциям
+func (c *Client) CurrentOps(ctx context.Context, collection string) ([]map[string]any, error) {
+	resp, err := c.Do(ctx, api.Request{Database: collection, Command: api.CmdCurrentOps})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// KillOp отменяет запрос по op_id из CurrentOps
+func (c *Client) KillOp(ctx context.Context, opID int64) error {
+	_, err := c.Do(ctx, api.Request{Command: api.CmdKillOp, Query: map[string]any{"op_id": opID}})
+	return err
+}
+
+// Ping проверяет, что сервер доступен и отвечает
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, api.Request{Command: api.CmdPing})
+	return err
+}
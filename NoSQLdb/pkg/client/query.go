@@ -0,0 +1,15 @@
+package client
+
+import "time"
+
+// Date оборачивает момент времени для запроса или документа;
+// сервер хранит и сравнивает даты в UTC
+func Date(t time.Time) map[string]any {
+	return map[string]any{"$date": t.UTC().Format(time.RFC3339Nano)}
+}
+
+// Since — условие «за последние d» для поля с меткой времени.
+// Граница считается на сервере: {"$gt": {"$date": "-24h0m0s"}}
+func Since(d time.Duration) map[string]any {
+	return map[string]any{"$gt": map[string]any{"$date": "-" + d.String()}}
+}
@@ -0,0 +1,162 @@
+// Package wire — кадровый бинарный протокол TCP-сервера.
+//
+// Соединение начинается в JSON; клиент переключает его командой hello
+// с query {"protocol": "msgpack", "compression": "gzip"}. Ответ на hello
+// приходит ещё в JSON, все следующие сообщения в обе стороны — кадры:
+//
+//	версия (1 байт) | флаги (1 байт) | длина payload (4 байта, big endian) | payload
+//
+// payload — запрос или ответ в MessagePack; флаг FlagGzip означает, что
+// payload сжат gzip. Граница кадра известна до разбора, поэтому битый
+// payload превращается в ответ с ошибкой, а соединение продолжает работать
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	Protocol        = "msgpack" // значение query.protocol в hello
+	CompressionGzip = "gzip"    // значение query.compression в hello
+
+	Version  byte = 1
+	FlagGzip byte = 1 << 0
+
+	headerSize = 6
+)
+
+var (
+	// CompressThreshold — кадры меньше этого размера не сжимаются
+	CompressThreshold = 1024
+	// MaxFrameSize — предельный размер payload до и после распаковки
+	MaxFrameSize = 64 << 20
+)
+
+// ErrFraming — поток кадров нарушен, дальше читать соединение нельзя
+var ErrFraming = errors.New("framing error")
+
+// Framer читает и пишет кадры. Запись одного кадра — один вызов Write,
+// сериализацию конкурентных писателей обеспечивает вызывающий
+type Framer struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+// NewFramer создаёт Framer. Входящие сжатые кадры распаковываются всегда
+func NewFramer(r io.Reader, w io.Writer) *Framer {
+	return &Framer{r: bufio.NewReader(r), w: w}
+}
+
+// AfterJSON — поток после JSON-сообщения hello: json.Encoder завершает
+// сообщение переводом строки, он может прийти уже после переключения.
+// Пробельные символы перед первым кадром пропускаются
+func AfterJSON(r io.Reader) io.Reader {
+	return &skipSpace{r: r}
+}
+
+type skipSpace struct {
+	r    io.Reader
+	done bool
+}
+
+func (s *skipSpace) Read(p []byte) (int, error) {
+	for !s.done {
+		n, err := s.r.Read(p)
+		i := 0
+		for i < n && (p[i] == ' ' || p[i] == '\t' || p[i] == '\r' || p[i] == '\n') {
+			i++
+		}
+		if i < n {
+			s.done = true
+			return copy(p, p[i:n]), err
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return s.r.Read(p)
+}
+
+// ReadFrame возвращает payload следующего кадра. Ошибка с ErrMalformed —
+// испорчен только этот кадр, с ErrFraming или ошибка чтения — весь поток
+func (f *Framer) ReadFrame() ([]byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(f.r, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != Version {
+		return nil, fmt.Errorf("%w: unsupported frame version %d", ErrFraming, header[0])
+	}
+	size := binary.BigEndian.Uint32(header[2:])
+	if uint64(size) > uint64(MaxFrameSize) {
+		return nil, fmt.Errorf("%w: frame of %d bytes exceeds limit %d", ErrFraming, size, MaxFrameSize)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(f.r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	flags := header[1]
+	if flags&^FlagGzip != 0 {
+		return nil, fmt.Errorf("%w: unknown frame flags 0x%02x", ErrMalformed, flags)
+	}
+	if flags&FlagGzip != 0 {
+		return gunzip(payload)
+	}
+	return payload, nil
+}
+
+// WriteFrame пишет payload одним кадром; compress — сжать gzip,
+// если payload не меньше CompressThreshold и сжатие его уменьшает
+func (f *Framer) WriteFrame(payload []byte, compress bool) error {
+	var flags byte
+	if compress && len(payload) >= CompressThreshold {
+		if packed, err := gzipBytes(payload); err == nil && len(packed) < len(payload) {
+			payload, flags = packed, FlagGzip
+		}
+	}
+	if len(payload) > MaxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds limit %d", len(payload), MaxFrameSize)
+	}
+	frame := make([]byte, headerSize, headerSize+len(payload))
+	frame[0], frame[1] = Version, flags
+	binary.BigEndian.PutUint32(frame[2:], uint32(len(payload)))
+	_, err := f.w.Write(append(frame, payload...))
+	return err
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	out, err := io.ReadAll(io.LimitReader(zr, int64(MaxFrameSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if len(out) > MaxFrameSize {
+		return nil, fmt.Errorf("%w: decompressed frame exceeds limit %d", ErrMalformed, MaxFrameSize)
+	}
+	return out, nil
+}
@@ -0,0 +1,202 @@
+package wire
+
+import (
+	"fmt"
+	"nosql_db/pkg/api"
+)
+
+// Запросы и ответы кодируются картами с теми же ключами, что и в JSON
+// (теги api.Request и api.Response); пустые поля опускаются
+
+// MarshalRequest кодирует запрос в MessagePack
+func MarshalRequest(req api.Request) ([]byte, error) {
+	m := map[string]any{"database": req.Database, "operation": req.Command}
+	putString(m, "request_id", req.RequestID)
+	putString(m, "batch_id", req.BatchID)
+	putInt(m, "max_time_ms", req.MaxTimeMS)
+	putInt(m, "max_result_bytes", req.MaxResultBytes)
+	putInt(m, "limit", int64(req.Limit))
+	if len(req.Data) > 0 {
+		m["data"] = req.Data
+	}
+	if len(req.Query) > 0 {
+		m["query"] = req.Query
+	}
+	return AppendValue(nil, m)
+}
+
+// UnmarshalRequest разбирает запрос; неизвестные ключи пропускаются
+func UnmarshalRequest(data []byte) (api.Request, error) {
+	var req api.Request
+	m, err := unmarshalMap(data)
+	if err != nil {
+		return req, err
+	}
+	f := fields{m: m}
+	req.RequestID = f.string("request_id")
+	req.Database = f.string("database")
+	req.Command = f.string("operation")
+	req.BatchID = f.string("batch_id")
+	req.MaxTimeMS = f.int("max_time_ms")
+	req.MaxResultBytes = f.int("max_result_bytes")
+	req.Limit = int(f.int("limit"))
+	req.Data = f.docs("data")
+	req.Query = f.object("query")
+	return req, f.err
+}
+
+// MarshalResponse кодирует ответ в MessagePack
+func MarshalResponse(resp api.Response) ([]byte, error) {
+	m := map[string]any{"status": resp.Status}
+	putString(m, "request_id", resp.RequestID)
+	putString(m, "message", resp.Message)
+	putInt(m, "count", int64(resp.Count))
+	putInt(m, "deduplicated", int64(resp.Deduplicated))
+	if len(resp.Data) > 0 {
+		m["data"] = resp.Data
+	}
+	if len(resp.Violations) > 0 {
+		violations := make([]any, len(resp.Violations))
+		for i, v := range resp.Violations {
+			item := map[string]any{"index": v.Index, "errors": v.Errors}
+			putString(item, "_id", v.ID)
+			violations[i] = item
+		}
+		m["violations"] = violations
+	}
+	return AppendValue(nil, m)
+}
+
+// UnmarshalResponse разбирает ответ
+func UnmarshalResponse(data []byte) (api.Response, error) {
+	var resp api.Response
+	m, err := unmarshalMap(data)
+	if err != nil {
+		return resp, err
+	}
+	f := fields{m: m}
+	resp.RequestID = f.string("request_id")
+	resp.Status = f.string("status")
+	resp.Message = f.string("message")
+	resp.Count = int(f.int("count"))
+	resp.Deduplicated = int(f.int("deduplicated"))
+	resp.Data = f.docs("data")
+	for _, item := range f.array("violations") {
+		vm, ok := item.(map[string]any)
+		if !ok {
+			return resp, fmt.Errorf("%w: violation must be a map", ErrMalformed)
+		}
+		vf := fields{m: vm}
+		v := api.Violation{Index: int(vf.int("index")), ID: vf.string("_id")}
+		for _, e := range vf.array("errors") {
+			s, _ := e.(string)
+			v.Errors = append(v.Errors, s)
+		}
+		if vf.err != nil {
+			return resp, vf.err
+		}
+		resp.Violations = append(resp.Violations, v)
+	}
+	return resp, f.err
+}
+
+func unmarshalMap(data []byte) (map[string]any, error) {
+	value, err := Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: message must be a map", ErrMalformed)
+	}
+	return m, nil
+}
+
+func putString(m map[string]any, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
+
+func putInt(m map[string]any, key string, value int64) {
+	if value != 0 {
+		m[key] = value
+	}
+}
+
+// fields читает поля сообщения; первая ошибка типа запоминается в err
+type fields struct {
+	m   map[string]any
+	err error
+}
+
+func (f *fields) fail(key string, want string) {
+	if f.err == nil {
+		f.err = fmt.Errorf("%w: field %s must be %s", ErrMalformed, key, want)
+	}
+}
+
+func (f *fields) string(key string) string {
+	v, ok := f.m[key]
+	if !ok || v == nil {
+		return ""
+	}
+	s, ok := v.(string)
+	if !ok {
+		f.fail(key, "a string")
+	}
+	return s
+}
+
+func (f *fields) int(key string) int64 {
+	v, ok := f.m[key]
+	if !ok || v == nil {
+		return 0
+	}
+	n, ok := v.(float64)
+	if !ok || n != float64(int64(n)) {
+		f.fail(key, "an integer")
+	}
+	return int64(n)
+}
+
+func (f *fields) object(key string) map[string]any {
+	v, ok := f.m[key]
+	if !ok || v == nil {
+		return nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		f.fail(key, "a map")
+	}
+	return m
+}
+
+func (f *fields) array(key string) []any {
+	v, ok := f.m[key]
+	if !ok || v == nil {
+		return nil
+	}
+	items, ok := v.([]any)
+	if !ok {
+		f.fail(key, "an array")
+	}
+	return items
+}
+
+func (f *fields) docs(key string) []map[string]any {
+	items := f.array(key)
+	if items == nil {
+		return nil
+	}
+	docs := make([]map[string]any, len(items))
+	for i, item := range items {
+		doc, ok := item.(map[string]any)
+		if !ok {
+			f.fail(key, "an array of maps")
+			return nil
+		}
+		docs[i] = doc
+	}
+	return docs
+}
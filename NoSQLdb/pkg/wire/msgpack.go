@@ -0,0 +1,340 @@
+package wire
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Подмножество MessagePack для значений, которые представимы в JSON:
+// nil, bool, числа, строки, массивы и карты со строковыми ключами.
+// Числа декодируются в float64, как их декодирует encoding/json, поэтому
+// операторы запросов видят одни и те же типы при любом протоколе
+
+// ErrMalformed — payload не разбирается как MessagePack
+var ErrMalformed = errors.New("malformed msgpack payload")
+
+// maxDepth ограничивает вложенность, чтобы чужой payload не исчерпал стек
+const maxDepth = 256
+
+// AppendValue дописывает значение в buf
+func AppendValue(buf []byte, value any) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, 0xc0), nil
+	case bool:
+		if v {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case float64:
+		// целые числа короче в int-форматах; при чтении всё равно float64
+		if v == math.Trunc(v) && v >= -(1<<63) && v < 1<<63 {
+			return appendInt(buf, int64(v)), nil
+		}
+		buf = append(buf, 0xcb)
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(v)), nil
+	case float32:
+		return AppendValue(buf, float64(v))
+	case int:
+		return appendInt(buf, int64(v)), nil
+	case int64:
+		return appendInt(buf, v), nil
+	case int32:
+		return appendInt(buf, int64(v)), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			buf = append(buf, 0xcf)
+			return binary.BigEndian.AppendUint64(buf, v), nil
+		}
+		return appendInt(buf, int64(v)), nil
+	case string:
+		return appendString(buf, v), nil
+	case []any:
+		buf = appendArrayHeader(buf, len(v))
+		for _, item := range v {
+			var err error
+			if buf, err = AppendValue(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case []string:
+		buf = appendArrayHeader(buf, len(v))
+		for _, item := range v {
+			buf = appendString(buf, item)
+		}
+		return buf, nil
+	case []map[string]any:
+		buf = appendArrayHeader(buf, len(v))
+		for _, item := range v {
+			var err error
+			if buf, err = AppendValue(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]any:
+		buf = appendMapHeader(buf, len(v))
+		for key, item := range v {
+			buf = appendString(buf, key)
+			var err error
+			if buf, err = AppendValue(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	default:
+		// прочие типы (структуры статистики, именованные строки) — через их JSON-вид
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("encode %T: %w", v, err)
+		}
+		var generic any
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return nil, fmt.Errorf("encode %T: %w", v, err)
+		}
+		return AppendValue(buf, generic)
+	}
+}
+
+func appendInt(buf []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n <= 127:
+		return append(buf, byte(n))
+	case n >= -32 && n < 0:
+		return append(buf, byte(n))
+	case n >= math.MinInt8 && n <= math.MaxInt8:
+		return append(buf, 0xd0, byte(n))
+	case n >= math.MinInt16 && n <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(n))
+	case n >= math.MinInt32 && n <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(n))
+	}
+}
+
+func appendString(buf []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = binary.BigEndian.AppendUint16(append(buf, 0xda), uint16(n))
+	default:
+		buf = binary.BigEndian.AppendUint32(append(buf, 0xdb), uint32(n))
+	}
+	return append(buf, s...)
+}
+
+func appendArrayHeader(buf []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(buf, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(buf, 0xdd), uint32(n))
+	}
+}
+
+func appendMapHeader(buf []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(buf, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(buf, 0xdf), uint32(n))
+	}
+}
+
+// Unmarshal разбирает одно значение, занимающее весь payload
+func Unmarshal(data []byte) (any, error) {
+	d := decoder{data: data}
+	value, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrMalformed, len(d.data)-d.pos)
+	}
+	return value, nil
+}
+
+// decoder читает из payload в памяти; все длины проверяются по остатку
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, fmt.Errorf("%w: unexpected end at offset %d", ErrMalformed, d.pos)
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// size читает длину из n байт
+func (d *decoder) size(n int) (int, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	default:
+		return int(binary.BigEndian.Uint32(b)), nil
+	}
+}
+
+func (d *decoder) value(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: nesting deeper than %d", ErrMalformed, maxDepth)
+	}
+	head, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	b := head[0]
+	switch {
+	case b <= 0x7f:
+		return float64(b), nil
+	case b >= 0xe0:
+		return float64(int8(b)), nil
+	case b&0xe0 == 0xa0:
+		return d.str(int(b & 0x1f))
+	case b&0xf0 == 0x90:
+		return d.array(int(b&0x0f), depth)
+	case b&0xf0 == 0x80:
+		return d.object(int(b&0x0f), depth)
+	}
+
+	switch b {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6, 0xd9, 0xda, 0xdb: // bin и str
+		n, err := d.size(sizeWidth(b))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xca:
+		raw, err := d.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(raw))), nil
+	case 0xcb:
+		raw, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		raw, err := d.next(1 << (b - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		var u uint64
+		for _, x := range raw {
+			u = u<<8 | uint64(x)
+		}
+		return float64(u), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		width := 1 << (b - 0xd0)
+		raw, err := d.next(width)
+		if err != nil {
+			return nil, err
+		}
+		var u uint64
+		for _, x := range raw {
+			u = u<<8 | uint64(x)
+		}
+		// знаковое расширение до 64 бит
+		shift := 64 - 8*width
+		return float64(int64(u<<shift) >> shift), nil
+	case 0xdc, 0xdd:
+		n, err := d.size(2 << (b - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.array(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.size(2 << (b - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.object(n, depth)
+	}
+	return nil, fmt.Errorf("%w: unsupported type 0x%02x at offset %d", ErrMalformed, b, d.pos-1)
+}
+
+// sizeWidth — ширина поля длины для bin8..bin32 и str8..str32
+func sizeWidth(b byte) int {
+	switch b {
+	case 0xc4, 0xd9:
+		return 1
+	case 0xc5, 0xda:
+		return 2
+	default:
+		return 4
+	}
+}
+
+func (d *decoder) str(n int) (string, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func (d *decoder) array(n int, depth int) ([]any, error) {
+	// каждый элемент занимает хотя бы байт — длина не может превышать остаток
+	if n > len(d.data)-d.pos {
+		return nil, fmt.Errorf("%w: array of %d items exceeds payload", ErrMalformed, n)
+	}
+	items := make([]any, n)
+	for i := range items {
+		var err error
+		if items[i], err = d.value(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func (d *decoder) object(n int, depth int) (map[string]any, error) {
+	if n > (len(d.data)-d.pos)/2 {
+		return nil, fmt.Errorf("%w: map of %d entries exceeds payload", ErrMalformed, n)
+	}
+	m := make(map[string]any, n)
+	for range n {
+		key, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: map key %v is not a string", ErrMalformed, key)
+		}
+		if m[s], err = d.value(depth + 1); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
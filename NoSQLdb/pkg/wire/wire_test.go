@@ -0,0 +1,242 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"nosql_db/pkg/api"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValueRoundTrip(t *testing.T) {
+	values := []any{
+		nil, true, false,
+		0.0, 1.0, 127.0, 128.0, -1.0, -32.0, -33.0, -200.0, 70000.0, -70000.0, 1e12, -1e15, 3.25, math.MaxFloat64,
+		"", "short", strings.Repeat("x", 31), strings.Repeat("y", 300), strings.Repeat("z", 70000),
+		[]any{}, []any{1.0, "a", nil, []any{true}},
+		map[string]any{}, map[string]any{"a": 1.0, "nested": map[string]any{"b": []any{"c"}}},
+	}
+	big := make([]any, 20)
+	for i := range big {
+		big[i] = float64(i)
+	}
+	values = append(values, big)
+
+	for _, value := range values {
+		data, err := AppendValue(nil, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Unmarshal(data)
+		if err != nil {
+			t.Fatalf("%v: %v", value, err)
+		}
+		if !reflect.DeepEqual(got, value) {
+			t.Errorf("round trip %v: got %v", value, got)
+		}
+	}
+}
+
+func TestIntegersDecodeAsFloat64(t *testing.T) {
+	// как encoding/json: операторы сравнения рассчитывают на float64
+	for _, value := range []any{int(-5), int64(1 << 40), int32(7), uint64(math.MaxUint64)} {
+		data, _ := AppendValue(nil, value)
+		got, err := Unmarshal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := got.(float64); !ok {
+			t.Errorf("%T decoded as %T", value, got)
+		}
+	}
+}
+
+func TestUnknownTypesEncodeAsJSON(t *testing.T) {
+	type stats struct {
+		MaxDocs int `json:"max_docs"`
+	}
+	data, err := AppendValue(nil, map[string]any{"capped": &stats{MaxDocs: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := Unmarshal(data)
+	want := map[string]any{"capped": map[string]any{"max_docs": 10.0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestMalformedPayloads(t *testing.T) {
+	cases := [][]byte{
+		{},
+		{0xa5, 'a'},                    // строка короче заявленной
+		{0xdd, 0xff, 0xff, 0xff, 0xff}, // массив больше payload
+		{0x81, 0x01, 0xc0},             // ключ карты не строка
+		{0xc1},                         // неиспользуемый код
+		{0xc0, 0xc0},                   // лишние байты
+	}
+	for _, data := range cases {
+		if _, err := Unmarshal(data); !errors.Is(err, ErrMalformed) {
+			t.Errorf("% x: got %v, want ErrMalformed", data, err)
+		}
+	}
+
+	deep := bytes.Repeat([]byte{0x91}, maxDepth+10)
+	if _, err := Unmarshal(append(deep, 0xc0)); !errors.Is(err, ErrMalformed) {
+		t.Errorf("deep nesting: got %v", err)
+	}
+}
+
+func TestRequestResponseRoundTrip(t *testing.T) {
+	req := api.Request{
+		RequestID: "r1", Database: "logs", Command: api.CmdInsert,
+		Data:    []map[string]any{{"host": "a", "n": 1.0}},
+		Query:   map[string]any{"n": map[string]any{"$gt": 0.0}},
+		BatchID: "b", MaxTimeMS: 500, MaxResultBytes: 1 << 20, Limit: 5,
+	}
+	data, err := MarshalRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotReq, err := UnmarshalRequest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotReq, req) {
+		t.Errorf("request: got %+v, want %+v", gotReq, req)
+	}
+
+	resp := api.Response{
+		RequestID: "r1", Status: api.StatusSuccess, Count: 1, Deduplicated: 2,
+		Data:       []map[string]any{{"_id": "x"}},
+		Violations: []api.Violation{{Index: 1, ID: "y", Errors: []string{"bad"}}},
+	}
+	data, err = MarshalResponse(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotResp, err := UnmarshalResponse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotResp, resp) {
+		t.Errorf("response: got %+v, want %+v", gotResp, resp)
+	}
+}
+
+func TestRequestWithWrongFieldTypeKeepsRequestID(t *testing.T) {
+	data, _ := AppendValue(nil, map[string]any{"request_id": "r7", "operation": "find", "limit": "ten"})
+	req, err := UnmarshalRequest(data)
+	if !errors.Is(err, ErrMalformed) {
+		t.Fatalf("got %v, want ErrMalformed", err)
+	}
+	if req.RequestID != "r7" {
+		t.Fatalf("request_id lost: %q", req.RequestID)
+	}
+}
+
+func TestFrames(t *testing.T) {
+	var stream bytes.Buffer
+	f := NewFramer(&stream, &stream)
+
+	small := []byte("small")
+	large := bytes.Repeat([]byte("compressible "), 1000)
+	for _, payload := range [][]byte{small, large} {
+		if err := f.WriteFrame(payload, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stream.Len() >= len(small)+len(large) {
+		t.Errorf("large frame not compressed: %d bytes on the wire", stream.Len())
+	}
+	for _, want := range [][]byte{small, large} {
+		got, err := f.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("frame payload mismatch: %d bytes, want %d", len(got), len(want))
+		}
+	}
+}
+
+func TestCorruptFrameDoesNotBreakStream(t *testing.T) {
+	var stream bytes.Buffer
+	// кадр с флагом gzip, но без gzip внутри, затем нормальный кадр
+	stream.Write([]byte{Version, FlagGzip, 0, 0, 0, 3, 'b', 'a', 'd'})
+	f := NewFramer(&stream, &stream)
+	f.WriteFrame([]byte("ok"), false)
+
+	if _, err := f.ReadFrame(); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("got %v, want ErrMalformed", err)
+	}
+	got, err := f.ReadFrame()
+	if err != nil || string(got) != "ok" {
+		t.Fatalf("next frame: %q, %v", got, err)
+	}
+}
+
+func TestFramingErrors(t *testing.T) {
+	cases := map[string][]byte{
+		"version": {2, 0, 0, 0, 0, 0},
+		"size":    {Version, 0, 0xff, 0xff, 0xff, 0xff},
+	}
+	for name, header := range cases {
+		f := NewFramer(bytes.NewReader(header), nil)
+		if _, err := f.ReadFrame(); !errors.Is(err, ErrFraming) {
+			t.Errorf("%s: got %v, want ErrFraming", name, err)
+		}
+	}
+}
+
+// benchBatch — пакет insert от агента
+func benchBatch() api.Request {
+	docs := make([]map[string]any, 1000)
+	for i := range docs {
+		docs[i] = map[string]any{
+			"timestamp": "2025-01-01T00:00:00Z",
+			"host":      fmt.Sprintf("host-%d", i%20),
+			"severity":  float64(i % 5),
+			"message":   "Accepted password for user from 10.0.0.1 port 22 ssh2",
+			"tags":      []any{"auth", "ssh"},
+		}
+	}
+	return api.Request{Database: "logs", Command: api.CmdInsert, Data: docs}
+}
+
+func BenchmarkDecodeBatchJSON(b *testing.B) {
+	data, _ := json.Marshal(benchBatch())
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		var req api.Request
+		if err := json.Unmarshal(data, &req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeBatchMsgpack(b *testing.B) {
+	data, _ := MarshalRequest(benchBatch())
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		if _, err := UnmarshalRequest(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestAfterJSONSkipsNewlineBeforeFirstFrame(t *testing.T) {
+	var frames bytes.Buffer
+	NewFramer(nil, &frames).WriteFrame([]byte("ok"), false)
+	// перевод строки после hello пришёл отдельным чтением
+	r := io.MultiReader(strings.NewReader("\n"), strings.NewReader(" \r\n"), &frames)
+	got, err := NewFramer(AfterJSON(r), nil).ReadFrame()
+	if err != nil || string(got) != "ok" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+}
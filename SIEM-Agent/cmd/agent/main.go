@@ -67,7 +67,7 @@ func main() {
 
 	parsedEvents := make(chan domain.Event, 100)
 
-	tcpSender := sender.NewTCPSender(cfg.Server.Host, cfg.Server.Port)
+	tcpSender := sender.NewTCPSender(cfg.Server.Host, cfg.Server.Port, cfg.Server.Protocol, cfg.Server.Compression)
 	tcpSender.SetCollection("security_events")
 	defer tcpSender.Close()
 
@@ -5,6 +5,9 @@ go 1.25.5
 require (
 	github.com/fsnotify/fsnotify v1.9.0
 	gopkg.in/yaml.v3 v3.0.1
+	nosql_db v0.0.0
 )
 
 require golang.org/x/sys v0.13.0 // indirect
+
+replace nosql_db => ../NoSQLdb
@@ -17,8 +17,10 @@ type Config struct {
 }
 
 type ServerConfig struct {
-	Host string `yaml:"host"`
-	Port int    `yaml:"port"`
+	Host        string `yaml:"host"`
+	Port        int    `yaml:"port"`
+	Protocol    string `yaml:"protocol"`    // json или msgpack
+	Compression string `yaml:"compression"` // gzip — только для msgpack
 }
 
 type LoggingConfig struct {
@@ -19,6 +19,7 @@ type Event struct {
 
 // Batch набор событий
 type Batch struct {
+	ID        string    `json:"id,omitempty"` // ключ идемпотентности: повторная отправка не создаёт дублей
 	AgentID   string    `json:"agent_id"`
 	Timestamp time.Time `json:"timestamp"`
 	Events    []Event   `json:"events"`
@@ -1,6 +1,7 @@
 package sender
 
 import (
+	"fmt"
 	"log"
 	"sync"
 	"time"
@@ -133,9 +134,11 @@ func (p *pipeline) flush() {
 		return
 	}
 
+	now := time.Now()
 	batch := domain.Batch{
+		ID:        fmt.Sprintf("%s-%d", p.config.AgentID, now.UnixNano()),
 		AgentID:   p.config.AgentID,
-		Timestamp: time.Now(),
+		Timestamp: now,
 		Events:    p.buffer,
 	}
 
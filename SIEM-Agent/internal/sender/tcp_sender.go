@@ -1,29 +1,43 @@
 package sender
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math"
 	"net"
-	"sync"
+	"strconv"
 	"time"
 
+	"nosql_db/pkg/api"
+	"nosql_db/pkg/client"
+
 	"github.com/Narotan/SIEM-Agent/internal/domain"
 )
 
+// sendTimeout — сколько ждём ответа на одну пачку
+const sendTimeout = 30 * time.Second
+
 type TCPSender struct {
-	host       string
-	port       int
-	conn       net.Conn
-	mu         sync.Mutex
+	client     *client.Client
 	collection string
 }
 
-func NewTCPSender(host string, port int) *TCPSender {
+func NewTCPSender(host string, port int, protocol, compression string) *TCPSender {
+	opts := client.DefaultOptions(net.JoinHostPort(host, strconv.Itoa(port)))
+	opts.Protocol = protocol
+	opts.Compression = compression
+	// пачки отправляются по одной, повторы делает SendWithRetry
+	opts.PoolSize = 1
+	opts.MaxRetries = 0
+
+	c, err := client.New(opts)
+	if err != nil {
+		log.Fatalf("Failed to create NoSQLdb client: %v", err)
+	}
 	return &TCPSender{
-		host:       host,
-		port:       port,
+		client:     c,
 		collection: "security_events",
 	}
 }
@@ -32,26 +46,7 @@ func (s *TCPSender) SetCollection(name string) {
 	s.collection = name
 }
 
-func (s *TCPSender) connect() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if s.conn != nil {
-		return nil
-	}
-
-	addr := fmt.Sprintf("%s:%d", s.host, s.port)
-	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
-	if err != nil {
-		return fmt.Errorf("failed to connect to %s: %w", addr, err)
-	}
-
-	s.conn = conn
-	log.Printf("Connected to NoSQLdb server at %s", addr)
-	return nil
-}
-
-func (s *TCPSender) batchToDBRequest(batch domain.Batch) DBRequest {
+func (s *TCPSender) batchToDBRequest(batch domain.Batch) api.Request {
 	data := make([]map[string]any, len(batch.Events))
 
 	for i, event := range batch.Events {
@@ -70,10 +65,12 @@ func (s *TCPSender) batchToDBRequest(batch domain.Batch) DBRequest {
 		}
 	}
 
-	return DBRequest{
+	// batch_id делает повторы SendWithRetry и отправку из дискового буфера идемпотентными
+	return api.Request{
 		Database: s.collection,
-		Command:  "insert",
+		Command:  api.CmdInsert,
 		Data:     data,
+		BatchID:  batch.ID,
 	}
 }
 
@@ -83,39 +80,20 @@ func (s *TCPSender) Send(batch domain.Batch) error {
 
 func (s *TCPSender) SendWithRetry(batch domain.Batch, maxAttempts int, initialDelay, maxDelay time.Duration) error {
 	var lastErr error
+	dbReq := s.batchToDBRequest(batch)
 
 	for attempt := 0; attempt < maxAttempts; attempt++ {
-		if s.conn == nil {
-			if err := s.connect(); err != nil {
-				lastErr = err
-				if attempt < maxAttempts-1 {
-					delay := s.calculateBackoff(attempt, initialDelay, maxDelay)
-					log.Printf("Connection failed (attempt %d/%d), retrying in %v: %v",
-						attempt+1, maxAttempts, delay, err)
-					time.Sleep(delay)
-					continue
-				}
-				return fmt.Errorf("failed to connect after %d attempts: %w", maxAttempts, err)
-			}
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		resp, err := s.client.Do(ctx, dbReq)
+		cancel()
+
+		var serverErr *client.ServerError
+		if errors.As(err, &serverErr) {
+			log.Printf("Warning: DB returned error: %s", serverErr.Message)
+			return fmt.Errorf("database error: %s", serverErr.Message)
 		}
-
-		dbReq := s.batchToDBRequest(batch)
-
-		data, err := json.Marshal(dbReq)
-		if err != nil {
-			return fmt.Errorf("failed to marshal DB request: %w", err)
-		}
-
-		data = append(data, '\n')
-
-		s.mu.Lock()
-
-		_, err = s.conn.Write(data)
 		if err != nil {
-			s.conn = nil
-			s.mu.Unlock()
 			lastErr = err
-
 			if attempt < maxAttempts-1 {
 				delay := s.calculateBackoff(attempt, initialDelay, maxDelay)
 				log.Printf("Send failed (attempt %d/%d), retrying in %v: %v",
@@ -126,23 +104,8 @@ func (s *TCPSender) SendWithRetry(batch domain.Batch, maxAttempts int, initialDe
 			return fmt.Errorf("failed to send after %d attempts: %w", maxAttempts, err)
 		}
 
-		decoder := json.NewDecoder(s.conn)
-		var resp DBResponse
-		if err := decoder.Decode(&resp); err != nil {
-			s.mu.Unlock()
-			log.Printf("Warning: failed to read response from DB: %v", err)
-			return nil
-		}
-
-		s.mu.Unlock()
-
-		if resp.Status != "success" {
-			log.Printf("Warning: DB returned error: %s", resp.Message)
-			return fmt.Errorf("database error: %s", resp.Message)
-		}
-
-		log.Printf("Successfully sent batch with %d events to NoSQLdb (inserted: %d)",
-			len(batch.Events), resp.Count)
+		log.Printf("Successfully sent batch with %d events to NoSQLdb (inserted: %d, deduplicated: %d)",
+			len(batch.Events), resp.Count, resp.Deduplicated)
 		return nil
 	}
 
@@ -158,13 +121,5 @@ func (s *TCPSender) calculateBackoff(attempt int, initialDelay, maxDelay time.Du
 }
 
 func (s *TCPSender) Close() error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if s.conn != nil {
-		err := s.conn.Close()
-		s.conn = nil
-		return err
-	}
-	return nil
+	return s.client.Close()
 }
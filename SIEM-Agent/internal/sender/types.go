@@ -8,20 +8,6 @@ import (
 	"github.com/Narotan/SIEM-Agent/internal/storage"
 )
 
-// DBRequest запрос к NoSQLdb
-type DBRequest struct {
-	Database string           `json:"database"`
-	Command  string           `json:"operation"`
-	Data     []map[string]any `json:"data,omitempty"`
-}
-
-// DBResponse ответ NoSQLdb
-type DBResponse struct {
-	Status  string `json:"status"`
-	Message string `json:"message,omitempty"`
-	Count   int    `json:"count,omitempty"`
-}
-
 type Sender interface {
 	Send(batch domain.Batch) error
 	Close() error
@@ -14,7 +14,10 @@ import (
 func main() {
 	cfg := config.GetConfig()
 
-	repo := repository.NewNosqlRepository(cfg.DBAddr)
+	repo, err := repository.NewNosqlRepository(cfg.DBAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	svc := service.NewSiemService(repo, cfg.DBName)
 
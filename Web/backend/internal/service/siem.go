@@ -155,8 +155,10 @@ func (s *siemService) GetStats() (*domain.DashboardStats, error) {
 	}
 
 	sort.Slice(stats.LastLogins, func(i, j int) bool {
-		t1, _ := time.Parse(time.RFC3339, stats.LastLogins[i]["timestamp"].(string))
-		t2, _ := time.Parse(time.RFC3339, stats.LastLogins[j]["timestamp"].(string))
+		s1, _ := stats.LastLogins[i]["timestamp"].(string)
+		s2, _ := stats.LastLogins[j]["timestamp"].(string)
+		t1, _ := time.Parse(time.RFC3339, s1)
+		t2, _ := time.Parse(time.RFC3339, s2)
 		return t1.After(t2)
 	})
 